@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+)
+
+// Bench runs synthetic signaling clients in pairs. The first client of a
+// pair calls the second one in rounds, each an SDP offer and answer
+// followed by ICE candidates in both directions.
+type Bench struct {
+	// Clients is the number of clients, rounded down to pairs.
+	Clients int
+
+	// Rounds is the number of call setups per pair, Interval the pause
+	// between them.
+	Rounds   int
+	Interval time.Duration
+
+	// Candidates is the number of ICE candidates per peer and call setup.
+	Candidates int
+
+	// Ramp delays the connects of successive pairs.
+	Ramp time.Duration
+
+	// Timeout applies to connects and to waiting for answers.
+	Timeout time.Duration
+
+	// Dial connects the client with index i and returns its user name.
+	Dial func(i int) (string, proto.FrameSendReceiver)
+
+	report *Report
+	sent   sync.Map
+}
+
+// Run executes the benchmark and returns its results.
+func (b *Bench) Run() *Report {
+	b.report = newReport()
+	start := time.Now()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i+1 < b.Clients; i += 2 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b.runPair(i)
+		}(i)
+		time.Sleep(b.Ramp)
+	}
+	wg.Wait()
+
+	b.sent.Range(func(k, v interface{}) bool {
+		b.report.Lost++
+		return true
+	})
+	b.report.Duration = time.Since(start)
+	return b.report
+}
+
+// runPair connects the clients i and i+1 and runs the call setups.
+func (b *Bench) runPair(i int) {
+	caller, callee := b.connect(i), b.connect(i+1)
+	if caller == nil || callee == nil {
+		b.report.fail("pair incomplete")
+		caller.close()
+		callee.close()
+		return
+	}
+	caller.peer, callee.peer = callee.name, caller.name
+
+	for r := 0; r < b.Rounds; r++ {
+		if r > 0 {
+			time.Sleep(b.Interval)
+		}
+		caller.sendSDP(proto.SDP_OFFER)
+		select {
+		case <-caller.answered:
+		case <-time.After(b.Timeout):
+			b.report.fail("answer timeout")
+		}
+	}
+
+	// allow for the last candidates to arrive
+	time.Sleep(b.Interval)
+	caller.close()
+	callee.close()
+}
+
+// connect dials the client with index i and waits for its configuration.
+// Returns nil if the client does not connect within the timeout.
+func (b *Bench) connect(i int) *agent {
+	start := time.Now()
+	name, conn := b.Dial(i)
+	a := &agent{
+		b:        b,
+		name:     name,
+		conn:     conn,
+		ready:    make(chan bool),
+		answered: make(chan bool, 1),
+		done:     make(chan bool),
+		stopped:  make(chan bool),
+	}
+	go a.receive()
+
+	select {
+	case <-a.ready:
+		b.report.connected(time.Since(start))
+		return a
+	case <-time.After(b.Timeout):
+		log.Warn().Str("user", name).Msg("connect timeout")
+		b.report.fail("connect timeout")
+		close(a.done)
+		<-a.stopped
+		return nil
+	}
+}
+
+// sentKey identifies a frame by sender and id.
+func sentKey(src string, id uint64) string {
+	return fmt.Sprintf("%s/%d", src, id)
+}
+
+// agent is a synthetic client.
+type agent struct {
+	b    *Bench
+	name string
+	peer string
+	conn proto.FrameSendReceiver
+	id   uint64
+
+	ready    chan bool
+	answered chan bool
+	done     chan bool
+	stopped  chan bool
+}
+
+// receive handles the frames received by the agent until it is closed.
+// Offers are answered and answers are followed by ICE candidates.
+func (a *agent) receive() {
+	defer close(a.stopped)
+	configured := false
+	for {
+		var f *proto.Frame
+		select {
+		case f = <-a.conn.Receive():
+		case <-a.done:
+			return
+		}
+
+		switch p := f.Payload.(type) {
+		case *proto.Frame_Config:
+			if !configured {
+				configured = true
+				close(a.ready)
+			}
+		case *proto.Frame_Error:
+			a.b.report.fail(p.Error.Code.String())
+		case *proto.Frame_Sdp:
+			a.forwarded(f)
+			switch p.Sdp.Type {
+			case proto.SDP_OFFER:
+				a.sendSDP(proto.SDP_ANSWER)
+				a.sendCandidates()
+			case proto.SDP_ANSWER:
+				a.sendCandidates()
+				select {
+				case a.answered <- true:
+				default:
+				}
+			}
+		case *proto.Frame_Ice:
+			a.forwarded(f)
+		}
+	}
+}
+
+// forwarded records the forward latency of f.
+func (a *agent) forwarded(f *proto.Frame) {
+	v, ok := a.b.sent.LoadAndDelete(sentKey(f.Src, f.Id))
+	if !ok {
+		a.b.report.fail("unexpected frame")
+		return
+	}
+	a.b.report.forwarded(time.Since(v.(time.Time)))
+}
+
+func (a *agent) send(f *proto.Frame) {
+	f.Src = a.name
+	f.Dst = a.peer
+	f.Id = atomic.AddUint64(&a.id, 1)
+	a.b.sent.Store(sentKey(f.Src, f.Id), time.Now())
+	a.b.report.sent()
+	if err := a.conn.Send(f); err != nil {
+		a.b.report.fail("send")
+	}
+}
+
+func (a *agent) sendSDP(t proto.SDP_Type) {
+	a.send(&proto.Frame{
+		Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{
+			Type: t,
+			Desc: fakeSDP(a.name, t),
+		}},
+	})
+}
+
+func (a *agent) sendCandidates() {
+	for i := 0; i < a.b.Candidates; i++ {
+		a.send(&proto.Frame{
+			Payload: &proto.Frame_Ice{Ice: &proto.ICE{
+				Candidate: fmt.Sprintf(
+					"candidate:%d 1 udp 2130706431 10.0.%d.%d %d typ host",
+					i+1, i/250, i%250+1, 50000+i,
+				),
+				SdpMid:           "0",
+				UsernameFragment: "bench",
+			}},
+		})
+	}
+}
+
+// close closes the connection of a. It is safe to call on nil.
+func (a *agent) close() {
+	if a == nil {
+		return
+	}
+	close(a.done)
+	<-a.stopped
+	if err := a.conn.Close(); err != nil {
+		log.Warn().Err(err).Str("user", a.name).Msg("close")
+	}
+}
+
+// fakeSDP returns a session description of typical size for an audio and
+// video session.
+func fakeSDP(name string, t proto.SDP_Type) string {
+	setup := "actpass"
+	if t == proto.SDP_ANSWER {
+		setup = "active"
+	}
+	return fmt.Sprintf(sdpTemplate, time.Now().UnixNano(), name, setup, setup)
+}
+
+const sdpTemplate = `v=0
+o=- %d 2 IN IP4 0.0.0.0
+s=%s
+t=0 0
+a=group:BUNDLE 0 1
+a=msid-semantic: WMS
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+c=IN IP4 0.0.0.0
+a=rtcp:9 IN IP4 0.0.0.0
+a=ice-ufrag:bench
+a=ice-pwd:benchbenchbenchbenchbench
+a=fingerprint:sha-256 3A:8C:59:42:1E:3C:7F:9A:5B:6D:2E:4F:1A:8B:9C:0D:3E:5F:7A:1B:2C:4D:6E:8F:9A:0B:1C:2D:3E:4F:5A:6B
+a=setup:%s
+a=mid:0
+a=sendrecv
+a=rtcp-mux
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 minptime=10;useinbandfec=1
+m=video 9 UDP/TLS/RTP/SAVPF 102
+c=IN IP4 0.0.0.0
+a=rtcp:9 IN IP4 0.0.0.0
+a=ice-ufrag:bench
+a=ice-pwd:benchbenchbenchbenchbench
+a=fingerprint:sha-256 3A:8C:59:42:1E:3C:7F:9A:5B:6D:2E:4F:1A:8B:9C:0D:3E:5F:7A:1B:2C:4D:6E:8F:9A:0B:1C:2D:3E:4F:5A:6B
+a=setup:%s
+a=mid:1
+a=sendrecv
+a=rtcp-mux
+a=rtcp-rsize
+a=rtpmap:102 H264/90000
+a=rtcp-fb:102 goog-remb
+a=rtcp-fb:102 transport-cc
+a=rtcp-fb:102 ccm fir
+a=rtcp-fb:102 nack
+a=rtcp-fb:102 nack pli
+a=fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f
+`
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/client"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	flag "github.com/spf13/pflag"
+	conf "github.com/spf13/viper"
+)
+
+var console = zerolog.ConsoleWriter{
+	Out:        os.Stderr,
+	TimeFormat: time.RFC3339,
+}
+
+func init() {
+	log.Logger = log.Output(console)
+}
+
+func configure() {
+	flag.StringP("url", "u", "ws://127.0.0.1:8443/channel", "signaling url")
+	flag.IntP("clients", "n", 10, "number of clients, used in pairs")
+	flag.String("user", "bench%d", "user name, %d is replaced by the client index")
+	flag.String("pass", "", "password of all users")
+	flag.StringP("invite", "i", "", "invite token, clients join as guests")
+	flag.IntP("rounds", "r", 10, "call setups per pair")
+	flag.Duration("interval", time.Second, "pause between call setups of a pair")
+	flag.Int("candidates", 8, "ICE candidates per peer and call setup")
+	flag.Duration("ramp", 10*time.Millisecond, "delay between connects of pairs")
+	flag.Duration("timeout", 10*time.Second, "timeout for connects and answers")
+	flag.StringP("loglevel", "l", "warn", "log level")
+	flag.Parse()
+	conf.BindPFlags(flag.CommandLine)
+
+	if ll, err := zerolog.ParseLevel(conf.GetString("loglevel")); err != nil {
+		log.Error().Err(err).Msg("failed to set log level")
+	} else {
+		zerolog.SetGlobalLevel(ll)
+	}
+}
+
+// dial connects the client with index i to the signaling server as user
+// or as guest if an invite is given.
+func dial(i int) (string, proto.FrameSendReceiver) {
+	name := fmt.Sprintf(conf.GetString("user"), i)
+
+	var header http.Header
+	if token := conf.GetString("invite"); token != "" {
+		header = auth.InviteHeader(token, name)
+		name = auth.GuestName(name)
+	} else {
+		header = auth.BasicAuthHeader(name, conf.GetString("pass"))
+	}
+	return name, client.Dial(conf.GetString("url"), header)
+}
+
+func run() *Report {
+	if !strings.Contains(conf.GetString("user"), "%d") {
+		log.Fatal().Msg("user must contain %d")
+	}
+
+	b := &Bench{
+		Clients:    conf.GetInt("clients"),
+		Rounds:     conf.GetInt("rounds"),
+		Interval:   conf.GetDuration("interval"),
+		Candidates: conf.GetInt("candidates"),
+		Ramp:       conf.GetDuration("ramp"),
+		Timeout:    conf.GetDuration("timeout"),
+		Dial:       dial,
+	}
+	return b.Run()
+}
+
+func main() {
+	configure()
+	run().Print(os.Stdout)
+}
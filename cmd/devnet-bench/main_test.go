@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/signaling"
+	conf "github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	configure()
+}
+
+func TestBench_Run(t *testing.T) {
+	sc := conf.New()
+	sc.SetConfigFile("../../configs/signald.yaml")
+	require.NoError(t, sc.ReadInConfig())
+	sc.Set("signaling.addr", "127.0.0.1:40400")
+	sc.Set("signaling.invites.secret", "bench")
+
+	s := signaling.NewServer(sc)
+	go s.Serve()
+	defer s.Shutdown()
+
+	token, err := auth.NewInvites("bench").Issue(auth.Invite{
+		Channel: "Lobby",
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	conf.Set("url", "ws://127.0.0.1:40400/channel")
+	conf.Set("invite", token)
+	conf.Set("clients", 4)
+	conf.Set("rounds", 2)
+	conf.Set("interval", 50*time.Millisecond)
+	conf.Set("candidates", 4)
+	conf.Set("timeout", 2*time.Second)
+
+	// allow for some startup time
+	time.Sleep(50 * time.Millisecond)
+	r := run()
+
+	// 2 pairs, 2 rounds, offer and answer with 4 candidates each
+	assert.Len(t, r.Connect, 4)
+	assert.Equal(t, 40, r.Sent)
+	assert.Len(t, r.Forward, 40)
+	assert.Equal(t, 0, r.Lost)
+	assert.Empty(t, r.Errors)
+
+	var out bytes.Buffer
+	r.Print(&out)
+	assert.Contains(t, out.String(), "connected  4")
+}
+
+func TestPercentile(t *testing.T) {
+	var d []time.Duration
+	for i := 100; i > 0; i-- {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(d, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(d, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(d, 100))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Report collects the results of a benchmark.
+type Report struct {
+	mu sync.Mutex
+
+	Duration time.Duration
+	Connect  []time.Duration
+	Forward  []time.Duration
+
+	// Sent counts the SDP and ICE frames sent, Lost those never received.
+	Sent int
+	Lost int
+
+	// Errors counts errors by kind, i.e. the code of error frames or the
+	// failed operation.
+	Errors map[string]int
+}
+
+func newReport() *Report {
+	return &Report{Errors: make(map[string]int)}
+}
+
+func (r *Report) connected(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Connect = append(r.Connect, d)
+}
+
+func (r *Report) forwarded(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Forward = append(r.Forward, d)
+}
+
+func (r *Report) sent() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Sent++
+}
+
+func (r *Report) fail(kind string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors[kind]++
+}
+
+// Print writes the report in human readable form to w.
+func (r *Report) Print(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "duration\t%v\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(tw, "connected\t%d\n", len(r.Connect))
+	fmt.Fprintf(tw, "frames\tsent %d\tlost %d\n", r.Sent, r.Lost)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "latency\tp50\tp90\tp99\tmax")
+	printPercentiles(tw, "connect", r.Connect)
+	printPercentiles(tw, "forward", r.Forward)
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "errors\tcount")
+		kinds := make([]string, 0, len(r.Errors))
+		for k := range r.Errors {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		for _, k := range kinds {
+			fmt.Fprintf(tw, "%s\t%d\n", k, r.Errors[k])
+		}
+	}
+	tw.Flush()
+}
+
+func printPercentiles(w io.Writer, name string, d []time.Duration) {
+	fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\n", name,
+		percentile(d, 50),
+		percentile(d, 90),
+		percentile(d, 99),
+		percentile(d, 100),
+	)
+}
+
+// percentile returns the p-th percentile of d by the nearest rank method.
+// d is sorted in place.
+func percentile(d []time.Duration, p int) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	rank := (p*len(d) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return d[rank-1].Round(time.Microsecond)
+}
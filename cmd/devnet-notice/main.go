@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	flag "github.com/spf13/pflag"
+	conf "github.com/spf13/viper"
+)
+
+var console = zerolog.ConsoleWriter{
+	Out:        os.Stderr,
+	TimeFormat: time.RFC3339,
+}
+
+// passEnv names the environment variable holding the admin password.
+const passEnv = "DEVNET_NOTICE_PASS"
+
+func init() {
+	log.Logger = log.Output(console)
+}
+
+// notice is a notice in the signald admin API.
+type notice struct {
+	Severity string     `json:"severity"`
+	Text     string     `json:"text"`
+	TTL      string     `json:"ttl,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+func configure() {
+	flag.StringP("url", "u", "http://127.0.0.1:8445/notices", "admin api notices url")
+	flag.String("user", "", "admin user")
+	flag.StringP("severity", "s", "info", "notice severity [info|warning|critical]")
+	flag.DurationP("ttl", "t", 0, "time until the notice expires, 0 for none")
+	flag.Bool("clear", false, "discard all notices")
+	flag.StringP("loglevel", "l", "info", "log level")
+	flag.Usage = func() {
+		os.Stderr.WriteString("usage: devnet-notice [flags] [text]\n")
+		os.Stderr.WriteString("lists the active notices if text is omitted\n")
+		os.Stderr.WriteString("the password is read from " + passEnv + " or stdin\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	conf.BindPFlags(flag.CommandLine)
+
+	if ll, err := zerolog.ParseLevel(conf.GetString("loglevel")); err != nil {
+		log.Error().Err(err).Msg("failed to set log level")
+	} else {
+		zerolog.SetGlobalLevel(ll)
+	}
+}
+
+// password returns the admin password from the environment or the first
+// line of r, so that it does not show up in the process list.
+func password(r io.Reader) (string, error) {
+	if pass, ok := os.LookupEnv(passEnv); ok {
+		return pass, nil
+	}
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			os.Stderr.WriteString("password: ")
+		}
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("read password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// request sends n to the admin api at url, clears the notices with method
+// DELETE or queries the active notices if n is nil. Returns the active
+// notices.
+func request(method, url, user, pass string, n *notice) ([]notice, error) {
+	var body io.Reader
+	if n != nil {
+		b, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(user, pass)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var active []notice
+	if err := json.NewDecoder(res.Body).Decode(&active); err != nil {
+		return nil, fmt.Errorf("decode response: %v", err)
+	}
+	return active, nil
+}
+
+// printNotices writes the notices as table to w.
+func printNotices(w io.Writer, notices []notice) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEVERITY\tEXPIRES\tTEXT")
+	for _, n := range notices {
+		expires := "-"
+		if n.Expires != nil {
+			expires = n.Expires.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", n.Severity, expires, n.Text)
+	}
+	tw.Flush()
+}
+
+func main() {
+	configure()
+
+	method := http.MethodGet
+	var n *notice
+	switch {
+	case conf.GetBool("clear"):
+		method = http.MethodDelete
+	case flag.NArg() > 0:
+		method = http.MethodPost
+		n = &notice{
+			Severity: conf.GetString("severity"),
+			Text:     strings.Join(flag.Args(), " "),
+		}
+		if ttl := conf.GetDuration("ttl"); ttl > 0 {
+			n.TTL = ttl.String()
+		}
+	}
+
+	pass, err := password(os.Stdin)
+	if err != nil {
+		log.Fatal().Err(err).Msg("password")
+	}
+	active, err := request(method, conf.GetString("url"), conf.GetString("user"), pass, n)
+	if err != nil {
+		log.Fatal().Err(err).Msg("notices")
+	}
+	printNotices(os.Stdout, active)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotice_Request(t *testing.T) {
+	var posted []notice
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var n notice
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+			posted = append(posted, n)
+		case http.MethodDelete:
+			posted = []notice{}
+		}
+		json.NewEncoder(w).Encode(posted)
+	}))
+	defer server.Close()
+
+	_, err := request("GET", server.URL, "admin", "wrong", nil)
+	assert.EqualError(t, err, "401 Unauthorized: unauthorized")
+
+	active, err := request("POST", server.URL, "admin", "secret", &notice{
+		Severity: "warning",
+		Text:     "restart at 12:00",
+		TTL:      time.Hour.String(),
+	})
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, "warning", active[0].Severity)
+	assert.Equal(t, "1h0m0s", active[0].TTL)
+
+	active, err = request("GET", server.URL, "admin", "secret", nil)
+	require.NoError(t, err)
+	assert.Len(t, active, 1)
+
+	active, err = request("DELETE", server.URL, "admin", "secret", nil)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestNotice_Password(t *testing.T) {
+	os.Unsetenv(passEnv)
+	pass, err := password(strings.NewReader("secret\nignored\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", pass)
+
+	_, err = password(strings.NewReader(""))
+	assert.Error(t, err)
+
+	os.Setenv(passEnv, "from env")
+	defer os.Unsetenv(passEnv)
+	pass, err = password(strings.NewReader("secret\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "from env", pass)
+}
+
+func TestNotice_Print(t *testing.T) {
+	expires := time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	printNotices(&buf, []notice{
+		{Severity: "WARNING", Text: "restart at 12:00", Expires: &expires},
+		{Severity: "INFO", Text: "welcome"},
+	})
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+	assert.Contains(t, string(lines[1]), "restart at 12:00")
+	assert.Contains(t, string(lines[2]), "INFO")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/internal/client"
+	"github.com/lx7/devnet/internal/signaling"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	flag "github.com/spf13/pflag"
+	conf "github.com/spf13/viper"
+)
+
+var console = zerolog.ConsoleWriter{
+	Out:        os.Stderr,
+	TimeFormat: time.RFC3339,
+}
+
+func init() {
+	log.Logger = log.Output(console)
+}
+
+func configure() {
+	flag.StringP("user", "u", "", "replay the frames to user into a client session")
+	flag.Float64P("speed", "s", 1, "replay speed, 0 replays without delays")
+	flag.DurationP("wait", "w", 5*time.Second, "time to wait for responses of the session")
+	flag.StringP("loglevel", "l", "info", "log level")
+	flag.Usage = func() {
+		os.Stderr.WriteString("usage: devnet-replay [flags] capture\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	conf.BindPFlags(flag.CommandLine)
+
+	if ll, err := zerolog.ParseLevel(conf.GetString("loglevel")); err != nil {
+		log.Error().Err(err).Msg("failed to set log level")
+	} else {
+		zerolog.SetGlobalLevel(ll)
+	}
+}
+
+func readCapture(path string) []*capture.Record {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("open capture")
+	}
+	defer f.Close()
+
+	records, err := capture.ReadAll(f)
+	if err != nil {
+		log.Fatal().Err(err).Msg("read capture")
+	}
+	log.Info().Int("frames", len(records)).Msg("capture loaded")
+	return records
+}
+
+// replaySwitch forwards the records through a switch and returns the
+// frames delivered to the users, ordered by user.
+func replaySwitch(records []*capture.Record, speed float64) []*capture.Record {
+	sw := signaling.NewSwitch()
+	go sw.Run()
+	defer sw.Shutdown()
+
+	delivered := signaling.Replay(sw, records, speed)
+	users := make([]string, 0, len(delivered))
+	for u := range delivered {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+
+	var out []*capture.Record
+	for _, u := range users {
+		out = append(out, delivered[u]...)
+	}
+	return out
+}
+
+// replaySession delivers the records to user into a client session and
+// returns the frames sent by the session.
+func replaySession(records []*capture.Record, user string, speed float64, wait time.Duration) []*capture.Record {
+	signal := client.NewReplaySignal(user, records)
+	session, err := client.NewSession(user, signal)
+	if err != nil {
+		log.Fatal().Err(err).Msg("session")
+	}
+	go session.Run()
+	go func() {
+		for e := range session.Events() {
+			log.Info().Interface("event", e).Msg("session event")
+		}
+	}()
+
+	signal.Play(speed)
+	time.Sleep(wait)
+	signal.Close()
+	return signal.Sent()
+}
+
+// write writes records as capture to w.
+func write(w io.Writer, records []*capture.Record) {
+	cw := capture.NewWriter(w)
+	for _, r := range records {
+		if err := cw.Write(r); err != nil {
+			log.Fatal().Err(err).Msg("write")
+		}
+	}
+}
+
+func main() {
+	configure()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	records := readCapture(flag.Arg(0))
+	speed := conf.GetFloat64("speed")
+
+	var out []*capture.Record
+	if user := conf.GetString("user"); user != "" {
+		out = replaySession(records, user, speed, conf.GetDuration("wait"))
+	} else {
+		out = replaySwitch(records, speed)
+	}
+	write(os.Stdout, out)
+}
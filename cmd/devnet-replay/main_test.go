@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay_Switch(t *testing.T) {
+	t0 := time.Now()
+	var buf bytes.Buffer
+	write(&buf, []*capture.Record{
+		{Time: t0, Frame: &proto.Frame{Src: "user2", Dst: "user1", Id: 1}},
+		{Time: t0, Frame: &proto.Frame{Src: "user1", Dst: "user2", Id: 1}},
+		{Time: t0, Frame: &proto.Frame{Src: "user1", Dst: "user2", Id: 2}},
+	})
+
+	dir, err := ioutil.TempDir("", "devnet-replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.jsonl")
+	require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0600))
+
+	out := replaySwitch(readCapture(path), 0)
+	require.Len(t, out, 3)
+	var have []string
+	for _, r := range out {
+		have = append(have, r.Frame.Dst)
+	}
+	assert.Equal(t, []string{"user1", "user2", "user2"}, have)
+	assert.Equal(t, uint64(2), out[2].Frame.Id)
+}
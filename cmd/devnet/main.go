@@ -11,6 +11,7 @@ import (
 	"github.com/lx7/devnet/internal/auth"
 	"github.com/lx7/devnet/internal/client"
 	"github.com/lx7/devnet/internal/gui"
+	"github.com/lx7/devnet/internal/logging"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	flag "github.com/spf13/pflag"
@@ -24,25 +25,31 @@ const (
 
 var _gui *gui.GUI
 
+var console = zerolog.ConsoleWriter{
+	Out:        os.Stderr,
+	TimeFormat: time.RFC3339,
+	FormatFieldValue: func(i interface{}) string {
+		s := fmt.Sprintf("%s", i)
+		s = strings.Replace(s, `\n`, "\n", -1)
+		s = strings.Replace(s, `\t`, "\t", -1)
+		return s
+	},
+}
+
 func init() {
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out:        os.Stderr,
-		TimeFormat: time.RFC3339,
-		FormatFieldValue: func(i interface{}) string {
-			s := fmt.Sprintf("%s", i)
-			s = strings.Replace(s, `\n`, "\n", -1)
-			s = strings.Replace(s, `\t`, "\t", -1)
-			return s
-		},
-	})
+	log.Logger = log.Output(console)
 	runtime.LockOSThread()
 }
 
 func configure(confpath string) {
 	flag.StringP("config", "c", confpath, "config file")
 	flag.StringP("loglevel", "l", "info", "log level")
+	flag.StringP("invite", "i", "", "invite token for guest access")
+	flag.StringP("name", "n", "", "display name for guest access")
 	flag.Parse()
 	conf.RegisterAlias("log.level", "loglevel")
+	conf.RegisterAlias("auth.invite", "invite")
+	conf.RegisterAlias("auth.name", "name")
 	conf.BindPFlags(flag.CommandLine)
 
 	conf.SetConfigFile(conf.GetString("config"))
@@ -50,6 +57,9 @@ func configure(confpath string) {
 		log.Fatal().Err(err).Msg("failed to read config file")
 	}
 
+	if err := logging.Configure(conf.Sub("log"), console); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logging")
+	}
 	if ll, err := zerolog.ParseLevel(conf.GetString("log.level")); err != nil {
 		log.Error().Err(err).Msg("failed to set log level")
 	} else {
@@ -66,6 +76,11 @@ func run() int {
 	url := conf.GetString("signaling.URL")
 
 	header := auth.BasicAuthHeader(u, p)
+	if token := conf.GetString("auth.invite"); token != "" {
+		name := conf.GetString("auth.name")
+		header = auth.InviteHeader(token, name)
+		u = auth.GuestName(name)
+	}
 	signal := client.Dial(url, header)
 
 	sChan := make(chan client.Session, 1)
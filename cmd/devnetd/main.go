@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/lx7/devnet/internal/logging"
+	"github.com/lx7/devnet/internal/privdrop"
+	"github.com/lx7/devnet/internal/signaling"
+	"github.com/lx7/devnet/internal/turn"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	flag "github.com/spf13/pflag"
+	conf "github.com/spf13/viper"
+)
+
+const appName = "devnet"
+
+var console = zerolog.ConsoleWriter{
+	Out:        os.Stderr,
+	TimeFormat: time.RFC3339,
+}
+
+func init() {
+	log.Logger = log.Output(console)
+}
+
+func configure(confpath string) {
+	flag.StringP("loglevel", "l", "info", "Log level")
+	flag.StringP("config", "c", confpath, "Path to config file")
+	flag.Parse()
+	conf.RegisterAlias("log.level", "loglevel")
+	conf.BindPFlags(flag.CommandLine)
+
+	conf.SetConfigFile(conf.GetString("config"))
+	err := conf.ReadInConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to read config file")
+	}
+
+	if err := logging.Configure(conf.Sub("log"), console); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logging")
+	}
+	if ll, err := zerolog.ParseLevel(conf.GetString("loglevel")); err != nil {
+		log.Error().Err(err).Msg("failed to set log level")
+	} else {
+		zerolog.SetGlobalLevel(ll)
+	}
+}
+
+// turnAddr returns the relay address and the listen address of the turn
+// server.
+func turnAddr() (net.IP, string) {
+	ip := net.ParseIP(conf.GetString("turn.ip"))
+	port := conf.GetInt("turn.port")
+	addr := conf.GetString("turn.listen")
+
+	if ip == nil {
+		log.Fatal().Msgf("ip address not configured")
+	} else if port == 0 && addr == "" {
+		log.Fatal().Msgf("port not configured")
+	}
+	if addr == "" {
+		addr = "0.0.0.0:" + strconv.Itoa(port)
+	}
+	return ip, addr
+}
+
+// iceURLs returns the STUN and TURN urls of the turn server advertised to
+// clients. Nothing is advertised without a public host name or address.
+func iceURLs() []string {
+	host := conf.GetString("turn.host")
+	if host == "" {
+		if ip := net.ParseIP(conf.GetString("turn.ip")); ip != nil && !ip.IsUnspecified() {
+			host = ip.String()
+		}
+	}
+	port := conf.GetInt("turn.port")
+	if host == "" || port == 0 {
+		log.Warn().Msg("turn host not configured, ice servers not advertised")
+		return nil
+	}
+
+	info := &turn.Info{Host: host, Port: port}
+	return info.URLs()
+}
+
+// chrootConflict returns the first setting that needs file system or name
+// resolver access after startup, which fails inside a chroot.
+func chrootConflict() string {
+	for _, key := range []string{
+		"log.max_size",
+		"signaling.calllog.max_size",
+		"signaling.capture.max_size",
+	} {
+		if conf.GetInt64(key) > 0 {
+			return key
+		}
+	}
+	if conf.IsSet("signaling.webhooks") {
+		return "signaling.webhooks"
+	}
+	return ""
+}
+
+// dropPrivileges applies the privileges section of the config and reports
+// whether the process was chrooted. The process exits if the privileges
+// cannot be dropped or the config needs files outside the chroot.
+func dropPrivileges() bool {
+	var pc privdrop.Config
+	if err := conf.UnmarshalKey("privileges", &pc); err != nil {
+		log.Fatal().Err(err).Msg("unmarshal privileges")
+	}
+	if pc.Chroot != "" {
+		if key := chrootConflict(); key != "" {
+			log.Fatal().Str("setting", key).Msg("setting not supported with chroot")
+		}
+	}
+	if err := privdrop.Drop(pc); err != nil {
+		log.Fatal().Err(err).Msg("failed to drop privileges")
+	}
+	if pc.User != "" {
+		log.Info().
+			Str("user", pc.User).
+			Str("chroot", pc.Chroot).
+			Msg("privileges dropped")
+	}
+	if pc.Chroot != "" {
+		log.Warn().Msg("configuration reload disabled in chroot")
+	}
+	return pc.Chroot != ""
+}
+
+// handleSignals reloads the configuration on SIGHUP unless chrooted and
+// shuts s down on SIGINT or SIGTERM.
+func handleSignals(s *signaling.Server, chrooted bool) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigs {
+		if sig != syscall.SIGHUP {
+			s.Shutdown()
+			return
+		}
+		if chrooted {
+			log.Warn().Msg("configuration reload not supported in chroot, restart required")
+			continue
+		}
+		reload(s)
+	}
+}
+
+// readConfig reads the config file into a new viper instance, leaving the
+// instance in use by the server untouched.
+func readConfig() (*conf.Viper, error) {
+	c := conf.New()
+	c.RegisterAlias("log.level", "loglevel")
+	if err := c.BindPFlags(flag.CommandLine); err != nil {
+		return nil, err
+	}
+	c.SetConfigFile(conf.GetString("config"))
+	return c, c.ReadInConfig()
+}
+
+// reload re-reads the config file and applies it to s. The users are
+// shared with the turn server. Turn listener settings require a restart.
+func reload(s *signaling.Server) {
+	log.Info().Msg("reloading configuration")
+	c, err := readConfig()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read config file")
+		return
+	}
+	if err := s.Reload(c); err != nil {
+		log.Error().Err(err).Msg("failed to reload configuration")
+	}
+	if c.GetString("turn.ip") != conf.GetString("turn.ip") ||
+		c.GetInt("turn.port") != conf.GetInt("turn.port") ||
+		c.GetString("turn.listen") != conf.GetString("turn.listen") ||
+		c.GetString("turn.realm") != conf.GetString("turn.realm") {
+		log.Warn().Msg("turn listener settings changed, restart required")
+	}
+}
+
+func run() {
+	// the signaling server configures the users for both servers
+	s := signaling.NewServer(conf.GetViper())
+	s.Advertise(iceURLs()...)
+	if err := s.Listen(); err != nil {
+		log.Fatal().Err(err).Msg("listen")
+	}
+
+	ip, addr := turnAddr()
+	ts, err := turn.NewServer(ip, addr, conf.GetString("turn.realm"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to start turn server")
+	}
+	s.AddMetrics("turn", func() interface{} { return ts.Stats() })
+	chrooted := dropPrivileges()
+
+	go handleSignals(s, chrooted)
+	if err := s.Serve(); err != nil {
+		log.Fatal().Err(err).Msg("http server")
+	}
+	if err := ts.Close(); err != nil {
+		log.Fatal().Err(err).Msg("failed to close turn server")
+	}
+}
+
+func main() {
+	configure(fmt.Sprintf("/etc/%s/devnetd.yaml", appName))
+	run()
+}
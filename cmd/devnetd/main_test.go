@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v2"
+	conf "github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	configure("../../configs/devnetd.yaml")
+	conf.Set("signaling.addr", "127.0.0.1:40190")
+	conf.Set("turn.ip", "127.0.0.1")
+	conf.Set("turn.port", "40191")
+}
+
+func TestDevnetd_Config(t *testing.T) {
+	assert.Equal(t, "info", conf.GetString("loglevel"))
+	assert.Equal(t, "/channel", conf.GetString("signaling.wspath"))
+	assert.Equal(t, "devnet.test", conf.GetString("turn.realm"))
+
+	want := []string{
+		"stun:127.0.0.1:40191",
+		"turn:127.0.0.1:40191?transport=udp",
+	}
+	assert.Equal(t, want, iceURLs())
+}
+
+func TestDevnetd_Run(t *testing.T) {
+	go run()
+
+	// allow for some startup time
+	time.Sleep(50 * time.Millisecond)
+
+	t.Run("signaling", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "http://127.0.0.1:40190", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("testuser", "test")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "OK", string(body))
+	})
+
+	t.Run("turn allocation", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		c, err := turn.NewClient(&turn.ClientConfig{
+			STUNServerAddr: "127.0.0.1:40191",
+			TURNServerAddr: "127.0.0.1:40191",
+			Username:       "testuser",
+			Password:       "test",
+			Realm:          "devnet.test",
+			Conn:           conn,
+		})
+		require.NoError(t, err)
+		defer c.Close()
+		require.NoError(t, c.Listen())
+
+		relay, err := c.Allocate()
+		require.NoError(t, err, "signaling users should authenticate for turn")
+		relay.Close()
+	})
+}
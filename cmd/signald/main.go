@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/lx7/devnet/internal/logging"
+	"github.com/lx7/devnet/internal/privdrop"
 	"github.com/lx7/devnet/internal/signaling"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -14,25 +18,20 @@ import (
 
 const appName = "devnet"
 
+var console = zerolog.ConsoleWriter{
+	Out:        os.Stderr,
+	TimeFormat: time.RFC3339,
+}
+
 func init() {
-	/*
-			syslog, err := syslog.New(syslog.LOG_WARNING|syslog.LOG_DAEMON, "")
-			if err != nil {
-				log.Fatal().Err(err).Msg("syslog")
-			}
-			log.Logger = log.Output(zerolog.SyslogLevelWriter(syslog))
-		}
-	*/
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out:        os.Stderr,
-		TimeFormat: time.RFC3339,
-	})
+	log.Logger = log.Output(console)
 }
 
 func configure(confpath string) {
 	flag.StringP("loglevel", "l", "info", "Log level")
 	flag.StringP("config", "c", confpath, "Path to config file")
 	flag.Parse()
+	conf.RegisterAlias("log.level", "loglevel")
 	conf.BindPFlags(flag.CommandLine)
 
 	conf.SetConfigFile(conf.GetString("config"))
@@ -41,6 +40,9 @@ func configure(confpath string) {
 		log.Fatal().Err(err).Msg("failed to read config file")
 	}
 
+	if err := logging.Configure(conf.Sub("log"), console); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logging")
+	}
 	if ll, err := zerolog.ParseLevel(conf.GetString("loglevel")); err != nil {
 		log.Error().Err(err).Msg("failed to set log level")
 	} else {
@@ -48,14 +50,98 @@ func configure(confpath string) {
 	}
 }
 
+// readConfig reads the config file into a new viper instance, leaving the
+// instance in use by the server untouched.
+func readConfig() (*conf.Viper, error) {
+	c := conf.New()
+	c.RegisterAlias("log.level", "loglevel")
+	if err := c.BindPFlags(flag.CommandLine); err != nil {
+		return nil, err
+	}
+	c.SetConfigFile(conf.GetString("config"))
+	return c, c.ReadInConfig()
+}
+
+// reload re-reads the config file on SIGHUP and applies it to s. The
+// config file and the files it refers to are out of reach in a chroot.
+func reload(s *signaling.Server, chrooted bool) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	for range sigs {
+		if chrooted {
+			log.Warn().Msg("configuration reload not supported in chroot, restart required")
+			continue
+		}
+		log.Info().Msg("reloading configuration")
+		c, err := readConfig()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to read config file")
+			continue
+		}
+		if err := s.Reload(c); err != nil {
+			log.Error().Err(err).Msg("failed to reload configuration")
+		}
+	}
+}
+
 func run() {
 	s := signaling.NewServer(conf.GetViper())
+	if err := s.Listen(); err != nil {
+		log.Fatal().Err(err).Msg("listen")
+	}
+	go reload(s, dropPrivileges())
 	err := s.Serve()
 	if err != nil {
 		log.Fatal().Err(err).Msg("http server")
 	}
 }
 
+// chrootConflict returns the first setting that needs file system or name
+// resolver access after startup, which fails inside a chroot.
+func chrootConflict() string {
+	for _, key := range []string{
+		"log.max_size",
+		"signaling.calllog.max_size",
+		"signaling.capture.max_size",
+	} {
+		if conf.GetInt64(key) > 0 {
+			return key
+		}
+	}
+	if conf.IsSet("signaling.webhooks") {
+		return "signaling.webhooks"
+	}
+	return ""
+}
+
+// dropPrivileges applies the privileges section of the config and reports
+// whether the process was chrooted. The process exits if the privileges
+// cannot be dropped or the config needs files outside the chroot.
+func dropPrivileges() bool {
+	var pc privdrop.Config
+	if err := conf.UnmarshalKey("privileges", &pc); err != nil {
+		log.Fatal().Err(err).Msg("unmarshal privileges")
+	}
+	if pc.Chroot != "" {
+		if key := chrootConflict(); key != "" {
+			log.Fatal().Str("setting", key).Msg("setting not supported with chroot")
+		}
+	}
+	if err := privdrop.Drop(pc); err != nil {
+		log.Fatal().Err(err).Msg("failed to drop privileges")
+	}
+	if pc.User != "" {
+		log.Info().
+			Str("user", pc.User).
+			Str("chroot", pc.Chroot).
+			Msg("privileges dropped")
+	}
+	if pc.Chroot != "" {
+		log.Warn().Msg("configuration reload disabled in chroot")
+	}
+	return pc.Chroot != ""
+}
+
 func main() {
 	configure(fmt.Sprintf("/etc/%s/signald.yaml", appName))
 	run()
@@ -2,12 +2,17 @@ package main
 
 import (
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/listen"
+	"github.com/lx7/devnet/internal/logging"
+	"github.com/lx7/devnet/internal/privdrop"
 	"github.com/lx7/devnet/internal/turn"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -17,25 +22,20 @@ import (
 
 const appName = "devnet"
 
+var console = zerolog.ConsoleWriter{
+	Out:        os.Stderr,
+	TimeFormat: time.RFC3339,
+}
+
 func init() {
-	/*
-			syslog, err := syslog.New(syslog.LOG_WARNING|syslog.LOG_DAEMON, "")
-			if err != nil {
-				log.Fatal().Err(err).Msg("syslog")
-			}
-			log.Logger = log.Output(zerolog.SyslogLevelWriter(syslog))
-		}
-	*/
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out:        os.Stderr,
-		TimeFormat: time.RFC3339,
-	})
+	log.Logger = log.Output(console)
 }
 
 func configure(confpath string) {
 	flag.StringP("loglevel", "l", "info", "Log level")
 	flag.StringP("config", "c", confpath, "Path to config file")
 	flag.Parse()
+	conf.RegisterAlias("log.level", "loglevel")
 	conf.BindPFlags(flag.CommandLine)
 
 	conf.SetConfigFile(conf.GetString("config"))
@@ -44,6 +44,9 @@ func configure(confpath string) {
 		log.Fatal().Err(err).Msg("failed to read config file")
 	}
 
+	if err := logging.Configure(conf.Sub("log"), console); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logging")
+	}
 	if ll, err := zerolog.ParseLevel(conf.GetString("loglevel")); err != nil {
 		log.Error().Err(err).Msg("failed to set log level")
 	} else {
@@ -59,28 +62,147 @@ func configure(confpath string) {
 func run() {
 	ip := net.ParseIP(conf.GetString("turn.ip"))
 	port := conf.GetInt("turn.port")
+	addr := conf.GetString("turn.listen")
 	realm := conf.GetString("turn.realm")
 
 	if ip == nil {
 		log.Fatal().Msgf("ip address not configured")
-	} else if port == 0 {
+	} else if port == 0 && addr == "" {
 		log.Fatal().Msgf("port not configured")
 	}
+	if addr == "" {
+		addr = "0.0.0.0:" + strconv.Itoa(port)
+	}
 
-	s, err := turn.NewServer(ip, port, realm)
+	s, err := turn.NewServer(ip, addr, realm)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to start turn server")
 	}
+	if conf.IsSet("turn.health") {
+		serveHealth(conf.GetString("turn.health"), ip, port, realm)
+	}
+	chrooted := dropPrivileges()
 
-	sigs := make(chan os.Signal)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	<-sigs
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigs {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if chrooted {
+			log.Warn().Msg("configuration reload not supported in chroot, restart required")
+			continue
+		}
+		reload()
+	}
 
 	if err = s.Close(); err != nil {
 		log.Fatal().Err(err).Msg("failed to close turn server")
 	}
 }
 
+// serveHealth serves the info advertised to signaling servers on addr.
+// The host defaults to ip unless ip is unspecified.
+func serveHealth(addr string, ip net.IP, port int, realm string) {
+	info := &turn.Info{
+		Host:  conf.GetString("turn.host"),
+		Port:  port,
+		Realm: realm,
+	}
+	if info.Host == "" && !ip.IsUnspecified() {
+		info.Host = ip.String()
+	}
+
+	ln, err := listen.Listen(addr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("health listener")
+	}
+	mux := http.NewServeMux()
+	mux.Handle(turn.HealthPath, turn.HealthHandler(info))
+	log.Info().Str("addr", addr).Msg("starting health endpoint")
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Error().Err(err).Msg("health endpoint")
+		}
+	}()
+}
+
+// readConfig reads the config file into a new viper instance, leaving the
+// running configuration untouched.
+func readConfig() (*conf.Viper, error) {
+	c := conf.New()
+	c.RegisterAlias("log.level", "loglevel")
+	if err := c.BindPFlags(flag.CommandLine); err != nil {
+		return nil, err
+	}
+	c.SetConfigFile(conf.GetString("config"))
+	return c, c.ReadInConfig()
+}
+
+// reload reads the config file and replaces the users. Listener settings
+// require a restart. The running configuration is not changed if the file
+// cannot be read or the users are invalid.
+func reload() {
+	log.Info().Msg("reloading configuration")
+	c, err := readConfig()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read config file")
+		return
+	}
+	ac := c.Sub("auth")
+	if ac == nil {
+		log.Error().Msg("failed to reload users: auth section missing")
+		return
+	}
+	if err := auth.Reload(ac); err != nil {
+		log.Error().Err(err).Msg("failed to reload users")
+		return
+	}
+	if c.GetString("turn.ip") != conf.GetString("turn.ip") ||
+		c.GetInt("turn.port") != conf.GetInt("turn.port") ||
+		c.GetString("turn.listen") != conf.GetString("turn.listen") ||
+		c.GetString("turn.realm") != conf.GetString("turn.realm") {
+		log.Warn().Msg("turn listener settings changed, restart required")
+	}
+}
+
+// chrootConflict returns the first setting that needs file system or name
+// resolver access after startup, which fails inside a chroot.
+func chrootConflict() string {
+	if conf.GetInt64("log.max_size") > 0 {
+		return "log.max_size"
+	}
+	return ""
+}
+
+// dropPrivileges applies the privileges section of the config and reports
+// whether the process was chrooted. The process exits if the privileges
+// cannot be dropped or the config needs files outside the chroot.
+func dropPrivileges() bool {
+	var pc privdrop.Config
+	if err := conf.UnmarshalKey("privileges", &pc); err != nil {
+		log.Fatal().Err(err).Msg("unmarshal privileges")
+	}
+	if pc.Chroot != "" {
+		if key := chrootConflict(); key != "" {
+			log.Fatal().Str("setting", key).Msg("setting not supported with chroot")
+		}
+	}
+	if err := privdrop.Drop(pc); err != nil {
+		log.Fatal().Err(err).Msg("failed to drop privileges")
+	}
+	if pc.User != "" {
+		log.Info().
+			Str("user", pc.User).
+			Str("chroot", pc.Chroot).
+			Msg("privileges dropped")
+	}
+	if pc.Chroot != "" {
+		log.Warn().Msg("configuration reload disabled in chroot")
+	}
+	return pc.Chroot != ""
+}
+
 func main() {
 	configure("/etc/devnet/turnd.yaml")
 	run()
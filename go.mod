@@ -10,6 +10,7 @@ require (
 	github.com/gotk3/gotk3 v0.5.1
 	github.com/jessevdk/go-flags v1.4.0
 	github.com/justinas/alice v1.2.0
+	github.com/pion/interceptor v0.0.9
 	github.com/pion/logging v0.2.2
 	github.com/pion/rtcp v1.2.6
 	github.com/pion/turn/v2 v2.0.5
@@ -21,5 +22,6 @@ require (
 	github.com/spf13/viper v1.7.1
 	github.com/stianeikeland/go-rpio/v4 v4.4.0
 	github.com/stretchr/testify v1.6.1
+	go.etcd.io/bbolt v1.3.5
 	google.golang.org/protobuf v1.25.0
 )
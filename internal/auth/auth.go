@@ -6,39 +6,142 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
 
 	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
 type User struct {
-	Name string
-	Hash string
-	Key  string
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	Key  string `json:"key"`
 }
 
-// TODO: use external auth provider
-var userMap map[string]User
+// Provider looks up user accounts.
+type Provider interface {
+	User(name string) (User, bool)
+}
+
+// UserMap implements a static Provider.
+type UserMap map[string]User
+
+// User returns the user with the given name.
+func (m UserMap) User(name string) (User, bool) {
+	u, ok := m[name]
+	return u, ok
+}
+
+// Diff returns the names of users that were added, removed or changed in n
+// compared to m.
+func (m UserMap) Diff(n UserMap) (added, removed, changed []string) {
+	for name, u := range n {
+		if old, ok := m[name]; !ok {
+			added = append(added, name)
+		} else if old != u {
+			changed = append(changed, name)
+		}
+	}
+	for name := range m {
+		if _, ok := n[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+var (
+	mu        sync.RWMutex
+	provider  Provider = UserMap{}
+	onFailure func(user string, r *http.Request)
+)
 
-// Configure sets up the auth module based on conf.
+// Configure sets up the auth module with the users defined in conf.
 func Configure(conf *viper.Viper) error {
-	userMap = make(map[string]User)
+	m, err := loadUsers(conf)
+	if err != nil {
+		return err
+	}
+	SetProvider(m)
+	return nil
+}
+
+// Reload replaces the users with those defined in conf and logs the
+// changes. Lookups in progress are not affected. The users are not
+// changed if conf is invalid.
+func Reload(conf *viper.Viper) error {
+	m, err := loadUsers(conf)
+	if err != nil {
+		return err
+	}
+	Replace(m)
+	return nil
+}
+
+// Load returns the users defined in conf without applying them.
+func Load(conf *viper.Viper) (UserMap, error) {
+	return loadUsers(conf)
+}
+
+// Replace replaces the users with m and logs the changes.
+func Replace(m UserMap) {
+	mu.Lock()
+	old, _ := provider.(UserMap)
+	provider = m
+	mu.Unlock()
+
+	added, removed, changed := old.Diff(m)
+	log.Info().
+		Strs("added", added).
+		Strs("removed", removed).
+		Strs("changed", changed).
+		Msg("users reloaded")
+}
 
+func loadUsers(conf *viper.Viper) (UserMap, error) {
 	var userList []User
 	if err := conf.UnmarshalKey("users", &userList); err != nil {
-		return fmt.Errorf("unmarshal user list: %v", err)
+		return nil, fmt.Errorf("unmarshal user list: %v", err)
 	}
+
+	m := make(UserMap)
 	for _, u := range userList {
-		userMap[u.Name] = u
+		m[u.Name] = u
 	}
-	return nil
+	return m, nil
+}
+
+// SetProvider replaces the provider used for all lookups.
+func SetProvider(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = p
+}
+
+// OnFailure sets a function that is called by BasicAuth and the invite
+// handler for every failed authentication attempt.
+func OnFailure(f func(user string, r *http.Request)) {
+	mu.Lock()
+	defer mu.Unlock()
+	onFailure = f
+}
+
+func lookup(name string) (User, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return provider.User(name)
 }
 
 // UserPass implements basic username / password verification.
 func UserPass(user string, pass string) bool {
 	sum := sha256.Sum256([]byte(fmt.Sprintf("%s+%s", user, pass)))
 	str := fmt.Sprintf("%x", sum)
-	u, ok := userMap[user]
+	u, ok := lookup(user)
 	if !ok {
 		return false
 	}
@@ -48,19 +151,32 @@ func UserPass(user string, pass string) bool {
 	return true
 }
 
+// Exists reports whether user is a known user.
+func Exists(user string) bool {
+	_, ok := lookup(user)
+	return ok
+}
+
 // BasicAuth provides an authentication wrapper for http.HandlerFunc.
+// Requests already authenticated by another wrapper are passed on.
 func BasicAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := IdentityFrom(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		user, pass, ok := r.BasicAuth()
 		if ok && UserPass(user, pass) {
 			hlog.FromRequest(r).Info().
 				Str("user", user).
 				Msg("user authorized")
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, WithIdentity(r, &Identity{Name: user}))
 		} else {
 			hlog.FromRequest(r).Warn().
 				Str("user", user).
 				Msg("authorization failed")
+			failed(user, r)
 			code := http.StatusUnauthorized
 			http.Error(w, http.StatusText(code), code)
 			return
@@ -68,6 +184,16 @@ func BasicAuth(next http.Handler) http.Handler {
 	})
 }
 
+// failed calls the function set by OnFailure.
+func failed(user string, r *http.Request) {
+	mu.RLock()
+	f := onFailure
+	mu.RUnlock()
+	if f != nil {
+		f(user, r)
+	}
+}
+
 // BasicAuthHeader returns an Authorization http.Header for BasicAuth.
 func BasicAuthHeader(user, pass string) http.Header {
 	cred := user + ":" + pass
@@ -80,7 +206,7 @@ func BasicAuthHeader(user, pass string) http.Header {
 // UserAuthKey returns auth keys in the format used by pion/turn
 // TODO: implement handling for multiple realms
 func UserAuthKey(user string, realm string) ([]byte, error) {
-	u, ok := userMap[user]
+	u, ok := lookup(user)
 	if !ok {
 		return nil, fmt.Errorf("user not found")
 	}
@@ -134,3 +134,64 @@ func TestAuth_UserAuthKey(t *testing.T) {
 	want, _ := hex.DecodeString("dcadec4f59a9793b5ebd7e278dd4f28a")
 	assert.Equal(t, want, key, "key should match")
 }
+
+func TestAuth_Exists(t *testing.T) {
+	assert.True(t, Exists("testuser"), "known user should exist")
+	assert.False(t, Exists("unknown user"), "unknown user should not exist")
+}
+
+func TestAuth_SetProvider(t *testing.T) {
+	prev := provider
+	defer SetProvider(prev)
+
+	SetProvider(UserMap{"other": {Name: "other"}})
+	assert.True(t, Exists("other"), "user from new provider should exist")
+	assert.False(t, Exists("testuser"), "user from old provider should not exist")
+}
+
+func TestAuth_Diff(t *testing.T) {
+	old := UserMap{
+		"kept":    {Name: "kept", Hash: "a"},
+		"changed": {Name: "changed", Hash: "a"},
+		"removed": {Name: "removed"},
+	}
+	n := UserMap{
+		"kept":    {Name: "kept", Hash: "a"},
+		"changed": {Name: "changed", Hash: "b"},
+		"added":   {Name: "added"},
+	}
+
+	added, removed, changed := old.Diff(n)
+	assert.Equal(t, []string{"added"}, added)
+	assert.Equal(t, []string{"removed"}, removed)
+	assert.Equal(t, []string{"changed"}, changed)
+}
+
+func TestAuth_Reload(t *testing.T) {
+	prev := provider
+	defer SetProvider(prev)
+
+	conf := viper.New()
+	conf.Set("users", []map[string]string{{"name": "reloaded"}})
+	require.NoError(t, Reload(conf))
+
+	assert.True(t, Exists("reloaded"), "reloaded user should exist")
+	assert.False(t, Exists("testuser"), "removed user should not exist")
+}
+
+func TestAuth_OnFailure(t *testing.T) {
+	var failed []string
+	OnFailure(func(user string, r *http.Request) {
+		failed = append(failed, user)
+	})
+	defer OnFailure(nil)
+
+	handler := BasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, pass := range []string{"test", "wrong"} {
+		req, err := http.NewRequest("GET", "/", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("testuser", pass)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, []string{"testuser"}, failed)
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// Certificate fields that hold the user name.
+const (
+	CertCommonName = "cn"
+	CertEmail      = "email"
+	CertDNSName    = "dns"
+)
+
+// CertAuth authenticates users by TLS client certificates. Certificates
+// must be verified by the TLS configuration of the server.
+type CertAuth struct {
+	field string
+}
+
+// NewCertAuth returns a CertAuth that takes the user name from the given
+// certificate field. The subject common name is used if field is empty.
+func NewCertAuth(field string) (*CertAuth, error) {
+	switch field {
+	case "":
+		field = CertCommonName
+	case CertCommonName, CertEmail, CertDNSName:
+	default:
+		return nil, fmt.Errorf("unknown certificate field: %q", field)
+	}
+	return &CertAuth{field: field}, nil
+}
+
+// User returns the user name in crt or an empty string. Of several
+// subject alternative names of the configured type, the first is used.
+func (a *CertAuth) User(crt *x509.Certificate) string {
+	switch a.field {
+	case CertEmail:
+		if len(crt.EmailAddresses) > 0 {
+			return crt.EmailAddresses[0]
+		}
+	case CertDNSName:
+		if len(crt.DNSNames) > 0 {
+			return crt.DNSNames[0]
+		}
+	default:
+		return crt.Subject.CommonName
+	}
+	return ""
+}
+
+// Handler provides an authentication wrapper for requests with a verified
+// client certificate. Requests without certificate or already authenticated
+// by another wrapper are passed on unchanged. Certificates of unknown users
+// are rejected. A nil CertAuth passes on all requests.
+func (a *CertAuth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := IdentityFrom(r); ok || a == nil || r.TLS == nil ||
+			len(r.TLS.VerifiedChains) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := a.User(r.TLS.VerifiedChains[0][0])
+		if !Exists(user) {
+			hlog.FromRequest(r).Warn().
+				Str("user", user).
+				Msg("certificate authorization failed")
+			failed(user, r)
+			code := http.StatusUnauthorized
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("user", user).
+			Msg("user authorized by certificate")
+		next.ServeHTTP(w, WithIdentity(r, &Identity{Name: user}))
+	})
+}
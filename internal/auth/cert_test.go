@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertAuth_User(t *testing.T) {
+	crt := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "testuser"},
+		EmailAddresses: []string{"user1@example.com", "user2@example.com"},
+		DNSNames:       []string{"user1.example.com"},
+	}
+
+	tests := []struct {
+		desc    string
+		give    string
+		want    string
+		wantErr bool
+	}{
+		{desc: "default", give: "", want: "testuser"},
+		{desc: "common name", give: CertCommonName, want: "testuser"},
+		{desc: "email", give: CertEmail, want: "user1@example.com"},
+		{desc: "dns", give: CertDNSName, want: "user1.example.com"},
+		{desc: "unknown field", give: "serial", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			a, err := NewCertAuth(tt.give)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, a.User(crt))
+		})
+	}
+
+	a, _ := NewCertAuth(CertDNSName)
+	assert.Empty(t, a.User(&x509.Certificate{}))
+}
+
+func TestCertAuth_Handler(t *testing.T) {
+	a, err := NewCertAuth(CertCommonName)
+	require.NoError(t, err)
+
+	responder := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFrom(r)
+		if !ok {
+			fmt.Fprint(w, "anonymous")
+			return
+		}
+		fmt.Fprint(w, id.Name)
+	})
+	verified := func(name string) *tls.ConnectionState {
+		crt := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{crt}}}
+	}
+
+	tests := []struct {
+		desc     string
+		giveAuth *CertAuth
+		giveTLS  *tls.ConnectionState
+		wantCode int
+		wantBody string
+	}{
+		{
+			desc:     "known user",
+			giveAuth: a,
+			giveTLS:  verified("testuser"),
+			wantCode: http.StatusOK,
+			wantBody: "testuser",
+		},
+		{
+			desc:     "unknown user",
+			giveAuth: a,
+			giveTLS:  verified("unknown"),
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Unauthorized",
+		},
+		{
+			desc:     "unverified",
+			giveAuth: a,
+			giveTLS:  &tls.ConnectionState{},
+			wantCode: http.StatusOK,
+			wantBody: "anonymous",
+		},
+		{
+			desc:     "plain http",
+			giveAuth: a,
+			wantCode: http.StatusOK,
+			wantBody: "anonymous",
+		},
+		{
+			desc:     "disabled",
+			giveTLS:  verified("testuser"),
+			wantCode: http.StatusOK,
+			wantBody: "anonymous",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.TLS = tt.giveTLS
+
+			rr := httptest.NewRecorder()
+			tt.giveAuth.Handler(responder).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(rr.Body.String()))
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// GuestNameHeader carries the display name of a guest.
+const GuestNameHeader = "X-Devnet-Guest-Name"
+
+// guestPrefix separates guest names from user names.
+const guestPrefix = "guest:"
+
+// Invite errors.
+var (
+	ErrInvalidInvite = errors.New("invalid invite")
+	ErrInviteExpired = errors.New("invite expired")
+	ErrInviteUsed    = errors.New("invite exhausted")
+)
+
+// Invite defines the guest access granted by an invite token.
+type Invite struct {
+	ID       string    `json:"id"`
+	Channel  string    `json:"channel"`
+	Expires  time.Time `json:"expires"`
+	MaxUses  int       `json:"max_uses,omitempty"`
+	ViewOnly bool      `json:"view_only,omitempty"`
+}
+
+// Identity describes an authenticated user or guest.
+type Identity struct {
+	Name  string
+	Guest bool
+
+	// Channel and ViewOnly restrict guests.
+	Channel  string
+	ViewOnly bool
+}
+
+type identityKey struct{}
+
+// IdentityFrom returns the identity set by the authentication wrappers.
+func IdentityFrom(r *http.Request) (*Identity, bool) {
+	id, ok := r.Context().Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// WithIdentity returns a copy of r carrying id as set by the
+// authentication wrappers.
+func WithIdentity(r *http.Request, id *Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+// GuestName returns the identity name of a guest with the given display
+// name.
+func GuestName(display string) string {
+	return guestPrefix + display
+}
+
+// Invites issues and redeems signed invite tokens. Tokens are valid until
+// they expire. Each distinct guest name counts as one use. Use counts are
+// kept in memory.
+type Invites struct {
+	secret []byte
+
+	mu   sync.Mutex
+	uses map[string]map[string]bool
+}
+
+// NewInvites returns a new Invites instance signing tokens with secret.
+func NewInvites(secret string) *Invites {
+	return &Invites{
+		secret: []byte(secret),
+		uses:   make(map[string]map[string]bool),
+	}
+}
+
+// Issue returns a signed token for inv. A random ID is assigned.
+func (i *Invites) Issue(inv Invite) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	inv.ID = hex.EncodeToString(b)
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + i.sign(payload), nil
+}
+
+// Redeem verifies token and records its use by the guest with the given
+// display name. A guest may redeem a token repeatedly, e.g. on reconnect.
+func (i *Invites) Redeem(token, name string) (*Invite, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(i.sign(parts[0]))) {
+		return nil, ErrInvalidInvite
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidInvite
+	}
+	var inv Invite
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, ErrInvalidInvite
+	}
+	if time.Now().After(inv.Expires) {
+		return nil, ErrInviteExpired
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	guests, ok := i.uses[inv.ID]
+	if !ok {
+		guests = make(map[string]bool)
+		i.uses[inv.ID] = guests
+	}
+	if !guests[name] {
+		if inv.MaxUses > 0 && len(guests) >= inv.MaxUses {
+			return nil, ErrInviteUsed
+		}
+		guests[name] = true
+	}
+	return &inv, nil
+}
+
+// Handler provides an authentication wrapper for guests presenting an
+// invite as bearer token and their display name in the GuestNameHeader.
+// Other requests are passed on unchanged. A nil Invites rejects all
+// bearer tokens.
+func (i *Invites) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := r.Header.Get("Authorization")
+		if !strings.HasPrefix(h, "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name := strings.TrimSpace(r.Header.Get(GuestNameHeader))
+		var inv *Invite
+		err := ErrInvalidInvite
+		if i != nil && name != "" {
+			inv, err = i.Redeem(strings.TrimPrefix(h, "Bearer "), name)
+		}
+		if err != nil {
+			hlog.FromRequest(r).Warn().
+				Str("guest", name).
+				Err(err).
+				Msg("guest authorization failed")
+			failed(GuestName(name), r)
+			code := http.StatusUnauthorized
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("guest", name).
+			Str("channel", inv.Channel).
+			Msg("guest authorized")
+		next.ServeHTTP(w, WithIdentity(r, &Identity{
+			Name:     GuestName(name),
+			Guest:    true,
+			Channel:  inv.Channel,
+			ViewOnly: inv.ViewOnly,
+		}))
+	})
+}
+
+// InviteHeader returns an Authorization http.Header for guests.
+func InviteHeader(token, name string) http.Header {
+	header := make(http.Header)
+	header.Add("Authorization", "Bearer "+token)
+	header.Add(GuestNameHeader, name)
+	return header
+}
+
+func (i *Invites) sign(payload string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
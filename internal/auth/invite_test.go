@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvites_Redeem(t *testing.T) {
+	inv := NewInvites("secret")
+	valid, err := inv.Issue(Invite{
+		Channel: "Lobby",
+		Expires: time.Now().Add(time.Hour),
+		MaxUses: 1,
+	})
+	require.NoError(t, err)
+	expired, err := inv.Issue(Invite{
+		Channel: "Lobby",
+		Expires: time.Now().Add(-time.Second),
+	})
+	require.NoError(t, err)
+	foreign, err := NewInvites("other").Issue(Invite{
+		Channel: "Lobby",
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc      string
+		giveToken string
+		giveName  string
+		wantErr   error
+	}{
+		{
+			desc:      "first use",
+			giveToken: valid,
+			giveName:  "alice",
+		},
+		{
+			desc:      "reconnect with same name",
+			giveToken: valid,
+			giveName:  "alice",
+		},
+		{
+			desc:      "max uses exceeded",
+			giveToken: valid,
+			giveName:  "bob",
+			wantErr:   ErrInviteUsed,
+		},
+		{
+			desc:      "expired",
+			giveToken: expired,
+			giveName:  "alice",
+			wantErr:   ErrInviteExpired,
+		},
+		{
+			desc:      "foreign secret",
+			giveToken: foreign,
+			giveName:  "alice",
+			wantErr:   ErrInvalidInvite,
+		},
+		{
+			desc:      "tampered payload",
+			giveToken: "x" + valid,
+			giveName:  "alice",
+			wantErr:   ErrInvalidInvite,
+		},
+		{
+			desc:      "malformed",
+			giveToken: "invalid",
+			giveName:  "alice",
+			wantErr:   ErrInvalidInvite,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			have, err := inv.Redeem(tt.giveToken, tt.giveName)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "Lobby", have.Channel)
+			assert.NotEmpty(t, have.ID)
+		})
+	}
+}
+
+func TestInvites_Handler(t *testing.T) {
+	inv := NewInvites("secret")
+	token, err := inv.Issue(Invite{
+		Channel:  "Lobby",
+		Expires:  time.Now().Add(time.Hour),
+		ViewOnly: true,
+	})
+	require.NoError(t, err)
+
+	responder := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFrom(r)
+		if !ok {
+			fmt.Fprint(w, "anonymous")
+			return
+		}
+		fmt.Fprintf(w, "%s %v %s %v", id.Name, id.Guest, id.Channel, id.ViewOnly)
+	})
+
+	tests := []struct {
+		desc       string
+		giveInv    *Invites
+		giveHeader http.Header
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			desc:       "guest",
+			giveInv:    inv,
+			giveHeader: InviteHeader(token, "alice"),
+			wantCode:   http.StatusOK,
+			wantBody:   "guest:alice true Lobby true",
+		},
+		{
+			desc:       "missing name",
+			giveInv:    inv,
+			giveHeader: InviteHeader(token, ""),
+			wantCode:   http.StatusUnauthorized,
+			wantBody:   "Unauthorized",
+		},
+		{
+			desc:       "invalid token",
+			giveInv:    inv,
+			giveHeader: InviteHeader("invalid", "alice"),
+			wantCode:   http.StatusUnauthorized,
+			wantBody:   "Unauthorized",
+		},
+		{
+			desc:       "invites disabled",
+			giveInv:    nil,
+			giveHeader: InviteHeader(token, "alice"),
+			wantCode:   http.StatusUnauthorized,
+			wantBody:   "Unauthorized",
+		},
+		{
+			desc:       "basic auth passed on",
+			giveInv:    inv,
+			giveHeader: BasicAuthHeader("testuser", "test"),
+			wantCode:   http.StatusOK,
+			wantBody:   "anonymous",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header = tt.giveHeader
+
+			rr := httptest.NewRecorder()
+			tt.giveInv.Handler(responder).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(rr.Body.String()))
+		})
+	}
+}
+
+func TestInvites_BasicAuthIdentity(t *testing.T) {
+	inv := NewInvites("secret")
+	token, err := inv.Issue(Invite{
+		Channel: "Lobby",
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	var have *Identity
+	h := inv.Handler(BasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		have, _ = IdentityFrom(r)
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("testuser", "test")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, &Identity{Name: "testuser"}, have)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header = InviteHeader(token, "alice")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, &Identity{Name: "guest:alice", Guest: true, Channel: "Lobby"}, have)
+}
@@ -0,0 +1,137 @@
+// Package capture reads and writes captures of signaling frames. A capture
+// is a JSON lines file with one record per frame.
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// maxLineSize is the maximum size of a record in a capture.
+const maxLineSize = 1 << 20
+
+// Record is a captured frame.
+type Record struct {
+	Time  time.Time
+	Frame *proto.Frame
+}
+
+// record is the JSON representation of a Record. Frames are encoded with
+// protojson like on the JSON subprotocol.
+type record struct {
+	Time  time.Time       `json:"time"`
+	Frame json.RawMessage `json:"frame"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r *Record) MarshalJSON() ([]byte, error) {
+	f, err := protojson.Marshal(r.Frame)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(record{Time: r.Time, Frame: f})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	f := &proto.Frame{}
+	opts := protojson.UnmarshalOptions{DiscardUnknown: true}
+	if err := opts.Unmarshal(rec.Frame, f); err != nil {
+		return err
+	}
+	r.Time, r.Frame = rec.Time, f
+	return nil
+}
+
+// Writer writes records as JSON lines. It is safe for concurrent use.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter returns a new Writer instance writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes r as a single line.
+func (w *Writer) Write(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.w.Write(append(data, '\n'))
+	return err
+}
+
+// Reader reads records from JSON lines.
+type Reader struct {
+	s *bufio.Scanner
+}
+
+// NewReader returns a new Reader instance reading from r.
+func NewReader(r io.Reader) *Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLineSize)
+	return &Reader{s: s}
+}
+
+// Read returns the next record. Empty lines are skipped. Returns io.EOF at
+// the end of the input.
+func (r *Reader) Read() (*Record, error) {
+	for r.s.Scan() {
+		if len(r.s.Bytes()) == 0 {
+			continue
+		}
+		rec := &Record{}
+		if err := json.Unmarshal(r.s.Bytes(), rec); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ReadAll returns all records read from r.
+func ReadAll(r io.Reader) ([]*Record, error) {
+	cr := NewReader(r)
+	var records []*Record
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// Play calls fn for every record in order. The calls are spaced by the
+// time between the records divided by speed. A speed of 0 plays the
+// records without delay.
+func Play(records []*Record, speed float64, fn func(*Record)) {
+	for i, r := range records {
+		if i > 0 && speed > 0 {
+			d := r.Time.Sub(records[i-1].Time)
+			time.Sleep(time.Duration(float64(d) / speed))
+		}
+		fn(r)
+	}
+}
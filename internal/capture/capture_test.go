@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestCapture_WriteRead(t *testing.T) {
+	t0 := time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC)
+	records := []*Record{
+		{
+			Time: t0,
+			Frame: &proto.Frame{
+				Src: "user1",
+				Dst: "user2",
+				Id:  1,
+				Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{
+					Type: proto.SDP_OFFER,
+					Desc: "v=0\r\n",
+				}},
+			},
+		},
+		{
+			Time: t0.Add(20 * time.Millisecond),
+			Frame: &proto.Frame{
+				Src: "user2",
+				Dst: "user1",
+				Payload: &proto.Frame_Ice{Ice: &proto.ICE{
+					Candidate: "candidate:1 1 udp 2130706431 10.0.0.1 50000 typ host",
+				}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, r := range records {
+		require.NoError(t, w.Write(r))
+	}
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+
+	have, err := ReadAll(&buf)
+	require.NoError(t, err)
+	require.Len(t, have, 2)
+	for i := range records {
+		assert.True(t, records[i].Time.Equal(have[i].Time))
+		assert.True(t, pb.Equal(records[i].Frame, have[i].Frame))
+	}
+}
+
+func TestCapture_ReadInvalid(t *testing.T) {
+	in := `{"time":"2021-02-01T12:00:00Z","frame":{"src":"user1"}}
+
+not json
+`
+	have, err := ReadAll(strings.NewReader(in))
+	assert.Error(t, err)
+	require.Len(t, have, 1)
+	assert.Equal(t, "user1", have[0].Frame.Src)
+}
+
+func TestCapture_Play(t *testing.T) {
+	t0 := time.Now()
+	records := []*Record{
+		{Time: t0, Frame: &proto.Frame{Id: 1}},
+		{Time: t0.Add(100 * time.Millisecond), Frame: &proto.Frame{Id: 2}},
+	}
+
+	var ids []uint64
+	start := time.Now()
+	Play(records, 2, func(r *Record) {
+		ids = append(ids, r.Frame.Id)
+	})
+	assert.Equal(t, []uint64{1, 2}, ids)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+	start = time.Now()
+	Play(records, 0, func(*Record) {})
+	assert.Less(t, int64(time.Since(start)), int64(50*time.Millisecond))
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/lx7/devnet/proto"
 )
@@ -33,6 +34,12 @@ type EventPeerClosed struct {
 	Peer Peer
 }
 
+// EventHangup occurs when a peer ended the call. The peer connection has
+// been closed.
+type EventHangup struct {
+	Peer string
+}
+
 type EventStreamStart struct {
 	Peer   Peer
 	Stream Stream
@@ -43,6 +50,60 @@ type EventStreamEnd struct {
 	Stream Stream
 }
 
+// EventSignalingError occurs when the signaling service rejected a frame or
+// could not deliver it to the peer.
+type EventSignalingError struct {
+	Peer string
+	Err  *proto.Error
+}
+
+// EventDelivered occurs when the signaling service confirmed the delivery of
+// a frame to the peer.
+type EventDelivered struct {
+	Peer string
+	Ref  uint64
+}
+
+// EventMissedCall occurs when the signaling service delivers a call offer
+// that was stored while the user was offline.
+type EventMissedCall struct {
+	Peer string
+	Time time.Time
+}
+
+// EventChat occurs when a peer sent a chat message. Queued is set if the
+// message was stored by the signaling service while offline.
+type EventChat struct {
+	Peer   string
+	Text   string
+	Queued time.Time
+}
+
+// EventFileOffer occurs when a peer offers a file for transfer. Queued is
+// set if the offer was stored by the signaling service while offline.
+type EventFileOffer struct {
+	Peer   string
+	Offer  *proto.FileOffer
+	Queued time.Time
+}
+
+// EventModeration occurs when a moderator acted on the user or announced a
+// channel lock. The session has already applied the action.
+type EventModeration struct {
+	Moderator string
+	Channel   string
+	Action    proto.Control_Moderation_Action
+}
+
+// EventNotice occurs when the signaling service announces a notice to all
+// users, e.g. a planned restart. Expires is zero if the notice does not
+// expire.
+type EventNotice struct {
+	Severity proto.Notice_Severity
+	Text     string
+	Expires  time.Time
+}
+
 type EventRCon struct {
 	Peer Peer
 	Data *proto.Control
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lx7/devnet/proto"
+)
+
+// signalConn is the connection of a Signal. It is implemented by websocket
+// connections and by event streams for networks that do not pass websocket
+// connections.
+type signalConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(string) error)
+	Subprotocol() string
+	Close() error
+}
+
+// eventConn implements signalConn on the event stream transport of the
+// signaling service. Frames are received as server-sent events and sent as
+// separate requests.
+type eventConn struct {
+	url    string
+	header http.Header
+	id     string
+	client *http.Client
+	body   io.ReadCloser
+	events *bufio.Reader
+
+	mu     sync.Mutex
+	timer  *time.Timer
+	pong   func(string) error
+	closed bool
+}
+
+// eventURL returns the event stream url for the websocket url u.
+func eventURL(u string) string {
+	switch {
+	case strings.HasPrefix(u, "wss://"):
+		u = "https://" + strings.TrimPrefix(u, "wss://")
+	case strings.HasPrefix(u, "ws://"):
+		u = "http://" + strings.TrimPrefix(u, "ws://")
+	}
+	return u + proto.StreamPath
+}
+
+// dialEvents opens an event stream at url with the request header h.
+func dialEvents(client *http.Client, url string, h http.Header) (*eventConn, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = h.Clone()
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("event stream: %s", res.Status)
+	}
+
+	return &eventConn{
+		url:    url,
+		header: h,
+		id:     res.Header.Get(proto.StreamHeader),
+		client: client,
+		body:   res.Body,
+		events: bufio.NewReader(res.Body),
+	}, nil
+}
+
+// ReadMessage returns the data of the next event. Keepalive comments are
+// passed to the pong handler.
+func (c *eventConn) ReadMessage() (int, []byte, error) {
+	var event string
+	var data [][]byte
+	for {
+		line, err := c.events.ReadBytes('\n')
+		if err != nil {
+			return 0, nil, c.readError(err)
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		switch {
+		case len(line) == 0 && data != nil:
+			msg := bytes.Join(data, []byte("\n"))
+			if event == proto.StreamCloseEvent {
+				return 0, nil, closeError(msg)
+			}
+			return websocket.TextMessage, msg, nil
+		case bytes.HasPrefix(line, []byte(":")):
+			c.mu.Lock()
+			pong := c.pong
+			c.mu.Unlock()
+			if pong != nil {
+				pong("")
+			}
+		case bytes.HasPrefix(line, []byte("event: ")):
+			event = string(bytes.TrimPrefix(line, []byte("event: ")))
+		case bytes.HasPrefix(line, []byte("data: ")):
+			data = append(data, bytes.TrimPrefix(line, []byte("data: ")))
+		}
+	}
+}
+
+// readError returns a normal closure error if the stream was closed by
+// Close.
+func (c *eventConn) readError(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}
+	return err
+}
+
+// closeError parses the data of a close event.
+func closeError(data []byte) error {
+	s := strings.SplitN(string(data), " ", 2)
+	code, _ := strconv.Atoi(s[0])
+	ce := &websocket.CloseError{Code: code}
+	if len(s) > 1 {
+		ce.Text = s[1]
+	}
+	return ce
+}
+
+// WriteMessage posts data to the stream. A close message deletes the
+// stream. Pings are not supported and discarded.
+func (c *eventConn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case websocket.PingMessage:
+		return nil
+	case websocket.CloseMessage:
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		err := c.request(http.MethodDelete, nil)
+		c.body.Close()
+		return err
+	}
+	return c.request(http.MethodPost, data)
+}
+
+func (c *eventConn) request(method string, data []byte) error {
+	req, err := http.NewRequest(method, c.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header = c.header.Clone()
+	req.Header.Set(proto.StreamHeader, c.id)
+	ctx, cancel := context.WithTimeout(req.Context(), writeTimeout)
+	defer cancel()
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("event stream: %s", res.Status)
+	}
+	return nil
+}
+
+// SetReadDeadline closes the stream if no data is received until t.
+func (c *eventConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(time.Until(t), func() { c.body.Close() })
+	return nil
+}
+
+// SetWriteDeadline does nothing. Requests time out after writeTimeout.
+func (c *eventConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// SetPongHandler sets the handler for keepalive comments.
+func (c *eventConn) SetPongHandler(h func(string) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pong = h
+}
+
+// Subprotocol returns the subprotocol of the event format.
+func (c *eventConn) Subprotocol() string {
+	return proto.SubprotocolJSON
+}
+
+// Close closes the stream without deleting it. The session may be resumed
+// on a new connection.
+func (c *eventConn) Close() error {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	return c.body.Close()
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventURL(t *testing.T) {
+	assert.Equal(t, "https://host/channel/events", eventURL("wss://host/channel"))
+	assert.Equal(t, "http://host/channel/events", eventURL("ws://host/channel"))
+}
+
+func TestSignal_Fallback(t *testing.T) {
+	codec := proto.CodecFor(proto.SubprotocolJSON)
+	frames := make(chan *proto.Frame, 4)
+	events := make(chan string, 1)
+
+	// the fake server refuses websocket upgrades like a stripping proxy
+	mux := http.NewServeMux()
+	mux.HandleFunc("/channel", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upgrade stripped", http.StatusBadRequest)
+	})
+	mux.HandleFunc("/channel"+proto.StreamPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			assert.Equal(t, "stream", r.Header.Get(proto.StreamHeader))
+			data, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			f := &proto.Frame{}
+			require.NoError(t, codec.Unmarshal(data, f))
+			frames <- f
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set(proto.StreamHeader, "stream")
+		w.WriteHeader(http.StatusOK)
+		data, _ := codec.Marshal(&proto.Frame{Payload: &proto.Frame_Resume{
+			Resume: &proto.Resume{Token: "token"},
+		}})
+		fmt.Fprintf(w, ": keepalive\n\ndata: %s\n\n", data)
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case e := <-events:
+				fmt.Fprint(w, e)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/channel"
+
+	signal := Dial(url, nil)
+
+	select {
+	case f := <-frames:
+		require.NotNil(t, f.GetHello(), "hello expected")
+	case <-time.After(time.Second):
+		t.Fatal("hello timeout")
+	}
+
+	signal.Send(&proto.Frame{Src: "user 1", Dst: "user 2", Id: 1})
+	select {
+	case f := <-frames:
+		assert.Equal(t, uint64(1), f.Id)
+	case <-time.After(time.Second):
+		t.Fatal("send timeout")
+	}
+
+	data, _ := codec.Marshal(&proto.Frame{Src: "user 2", Dst: "user 1", Seq: 1})
+	events <- fmt.Sprintf("data: %s\n\n", data)
+	select {
+	case f := <-signal.Receive():
+		assert.Equal(t, "user 2", f.Src)
+	case <-time.After(time.Second):
+		t.Fatal("receive timeout")
+	}
+
+	// close events end the session like websocket close messages
+	events <- fmt.Sprintf("event: close\ndata: %d replaced\n\n", proto.CloseReplaced)
+	select {
+	case <-signal.done:
+	case <-time.After(time.Second):
+		t.Fatal("close timeout")
+	}
+}
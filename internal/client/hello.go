@@ -0,0 +1,89 @@
+package client
+
+import (
+	"os"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+	conf "github.com/spf13/viper"
+)
+
+// Version is the software version announced to the signaling service and
+// to peers. It is set at build time.
+var Version = "dev"
+
+// Features lists the optional features supported by this client.
+var Features = []string{
+	proto.FeatureAck,
+	proto.FeatureResume,
+	proto.FeatureModeration,
+	proto.FeatureNotice,
+	proto.FeatureCodecOpus,
+	proto.FeatureCodecH264,
+	proto.FeatureRCon,
+}
+
+// newHello returns the hello frame announcing this client.
+func newHello() *proto.Frame {
+	return &proto.Frame{Payload: proto.PayloadWithHello(Version, deviceID(), Features)}
+}
+
+// deviceID returns the configured device id or the host name.
+func deviceID() string {
+	if id := conf.GetString("device.id"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		log.Warn().Err(err).Msg("device id")
+	}
+	return host
+}
+
+// handleHello answers the hello of a peer with the features supported by
+// both sides. It is called from the Run loop, which also drains forward,
+// so the answer is queued from a separate goroutine.
+func (s *DefaultSession) handleHello(src string, h *proto.Hello) {
+	if src == "" {
+		return
+	}
+	w := h.Welcome(Version, Features)
+	s.negotiated(src, h.Version, w.Welcome)
+	go func() {
+		select {
+		case s.forward <- &proto.Frame{Dst: src, Payload: w}:
+		case <-s.done:
+		}
+	}()
+}
+
+// handleWelcome stores the features negotiated with a peer. Welcome frames
+// without source answer the hello of this client to the signaling service.
+func (s *DefaultSession) handleWelcome(src string, w *proto.Welcome) {
+	if src == "" {
+		log.Info().
+			Uint32("protocol", w.Protocol).
+			Str("version", w.Version).
+			Strs("features", w.Features).
+			Msg("signaling: welcome")
+		return
+	}
+	s.negotiated(src, w.Version, w)
+}
+
+func (s *DefaultSession) negotiated(peer, version string, w *proto.Welcome) {
+	log.Info().
+		Str("peer", peer).
+		Str("version", version).
+		Strs("features", w.Features).
+		Msg("features negotiated")
+	s.features[peer] = w
+}
+
+// supports reports whether feature may be used with peer. Legacy peers
+// that did not negotiate features are assumed to support all features of
+// protocol version 0.
+func (s *DefaultSession) supports(peer, feature string) bool {
+	w, ok := s.features[peer]
+	return !ok || w.Supports(feature)
+}
@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/lx7/devnet/gst"
+	"github.com/lx7/devnet/internal/turn"
 	"github.com/lx7/devnet/proto"
+	"github.com/pion/interceptor"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 	"github.com/rs/zerolog/log"
@@ -47,7 +49,11 @@ type PeerOptions struct {
 }
 
 func NewPeer(o PeerOptions) (*DefaultPeer, error) {
-	conn, err := webrtc.NewPeerConnection(o.Config)
+	api, err := newAPI()
+	if err != nil {
+		return nil, fmt.Errorf("new api: %v", err)
+	}
+	conn, err := api.NewPeerConnection(o.Config)
 	if err != nil {
 		return nil, fmt.Errorf("new peer connection: %v", err)
 
@@ -78,6 +84,25 @@ func NewPeer(o PeerOptions) (*DefaultPeer, error) {
 	return &p, nil
 }
 
+// newAPI returns a webrtc API with the default codecs and interceptors
+// that logs through zerolog.
+func newAPI() (*webrtc.API, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	i := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		return nil, err
+	}
+	se := webrtc.SettingEngine{LoggerFactory: turn.LoggerFactory{}}
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(m),
+		webrtc.WithInterceptorRegistry(i),
+		webrtc.WithSettingEngine(se),
+	), nil
+}
+
 func (p *DefaultPeer) initStreams() error {
 	for _, st := range []struct {
 		source   string
@@ -151,6 +176,7 @@ func (p *DefaultPeer) Connect() error {
 
 	frame := &proto.Frame{
 		Dst:     p.name,
+		WantAck: true,
 		Payload: proto.PayloadWithSD(offer),
 	}
 
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/proto"
+)
+
+// ReplaySignal implements a SignalSendReceiver that delivers the captured
+// frames addressed to one user, e.g. to reproduce a negotiation in a
+// Session. The frames sent in return are recorded.
+type ReplaySignal struct {
+	user    string
+	records []*capture.Record
+	recv    chan *proto.Frame
+	done    chan bool
+	once    sync.Once
+
+	mu   sync.Mutex
+	sent []*capture.Record
+}
+
+// NewReplaySignal returns a new ReplaySignal instance for the frames to
+// user in records.
+func NewReplaySignal(user string, records []*capture.Record) *ReplaySignal {
+	s := &ReplaySignal{
+		user: user,
+		recv: make(chan *proto.Frame),
+		done: make(chan bool),
+	}
+	for _, r := range records {
+		if r.Frame.Dst == user {
+			s.records = append(s.records, r)
+		}
+	}
+	return s
+}
+
+// Play delivers the frames spaced as in the capture divided by speed.
+// Returns when all frames were received or the signal was closed.
+func (s *ReplaySignal) Play(speed float64) {
+	capture.Play(s.records, speed, func(r *capture.Record) {
+		select {
+		case s.recv <- r.Frame:
+		case <-s.done:
+		}
+	})
+}
+
+// Sent returns the records of the frames sent so far.
+func (s *ReplaySignal) Sent() []*capture.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*capture.Record(nil), s.sent...)
+}
+
+// Send implements the FrameSender interface.
+func (s *ReplaySignal) Send(f *proto.Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, &capture.Record{Time: time.Now(), Frame: f})
+	return nil
+}
+
+// Receive implements the FrameReceiver interface.
+func (s *ReplaySignal) Receive() <-chan *proto.Frame {
+	return s.recv
+}
+
+// HandleStateChange implements the SignalSendReceiver interface. The
+// signal is always connected.
+func (s *ReplaySignal) HandleStateChange(h SignalStateHandler) {
+	h(SignalStateConnected)
+}
+
+// Close stops the delivery of frames.
+func (s *ReplaySignal) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaySignal(t *testing.T) {
+	t0 := time.Now()
+	records := []*capture.Record{
+		{Time: t0, Frame: &proto.Frame{Src: "user2", Dst: "user1", Id: 1}},
+		{Time: t0, Frame: &proto.Frame{Src: "user1", Dst: "user2", Id: 1}},
+		{Time: t0, Frame: &proto.Frame{Src: "user2", Dst: "user1", Id: 2}},
+	}
+	s := NewReplaySignal("user1", records)
+
+	var state SignalState
+	s.HandleStateChange(func(st SignalState) { state = st })
+	assert.Equal(t, SignalStateConnected, state)
+
+	go s.Play(0)
+	for _, id := range []uint64{1, 2} {
+		select {
+		case f := <-s.Receive():
+			assert.Equal(t, id, f.Id)
+			require.NoError(t, s.Send(&proto.Frame{Src: "user1", Dst: "user2", Id: id}))
+		case <-time.After(time.Second):
+			t.Fatal("frame not delivered")
+		}
+	}
+
+	sent := s.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, uint64(2), sent[1].Frame.Id)
+
+	// close stops the delivery
+	s = NewReplaySignal("user1", records)
+	done := make(chan bool)
+	go func() {
+		s.Play(0)
+		close(done)
+	}()
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("play not stopped")
+	}
+}
@@ -1,8 +1,10 @@
 package client
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/lx7/devnet/proto"
 	"github.com/pion/webrtc/v3"
@@ -22,6 +24,8 @@ const (
 
 type Session interface {
 	Connect(peer string) error
+	Hangup(peer string) error
+	Share(peer string, active bool) error
 	Events() <-chan Event
 }
 
@@ -32,6 +36,16 @@ type DefaultSession struct {
 	peers   map[string]Peer
 	config  webrtc.Configuration
 	forward chan *proto.Frame
+	lastID  uint64
+
+	// rconRevoked is set when a moderator revoked remote control
+	rconRevoked bool
+
+	// features holds the features negotiated per peer
+	features map[string]*proto.Welcome
+
+	// shares holds the peers the screen is shared with
+	shares map[string]bool
 
 	h       map[reflect.Type]handler
 	sevents chan Event
@@ -43,9 +57,11 @@ func NewSession(self string, signal SignalSendReceiver) (*DefaultSession, error)
 	s := DefaultSession{
 		Self: self,
 
-		signal:  signal,
-		peers:   make(map[string]Peer),
-		forward: make(chan *proto.Frame, 10),
+		signal:   signal,
+		peers:    make(map[string]Peer),
+		forward:  make(chan *proto.Frame, 10),
+		features: make(map[string]*proto.Welcome),
+		shares:   make(map[string]bool),
 
 		h:       make(map[reflect.Type]handler),
 		pevents: make(chan Event, 10),
@@ -69,6 +85,11 @@ func (s *DefaultSession) Run() {
 				Stringer("type", reflect.TypeOf(frame.Payload)).
 				Msg("sinaling frame received")
 
+			if frame.Queued != 0 {
+				s.handleQueued(frame)
+				continue
+			}
+
 			switch pl := frame.Payload.(type) {
 			case *proto.Frame_Config:
 				log.Info().Stringer("config", pl.Config).Msg("config update")
@@ -79,10 +100,11 @@ func (s *DefaultSession) Run() {
 					continue
 				}
 
-				// TODO: Implement. This is for the prototype only.
+				// TURN servers authenticate with the user credentials.
 				servers := pl.Config.Webrtc.ICEServers()
 				for i := range servers {
-					if !strings.Contains(servers[i].URLs[0], "devnet") {
+					url := servers[i].URLs[0]
+					if !strings.HasPrefix(url, "turn:") && !strings.HasPrefix(url, "turns:") {
 						continue
 					}
 					servers[i].Username = conf.GetString("auth.user")
@@ -98,6 +120,10 @@ func (s *DefaultSession) Run() {
 					log.Warn().Msg("received sdp message for self")
 					continue
 				}
+				if frame.GetSdp().GetType() == proto.SDP_ROLLBACK {
+					s.handleHangup(frame.Src)
+					continue
+				}
 				p, ok := s.peers[frame.Src]
 				if !ok {
 					var err error
@@ -118,9 +144,48 @@ func (s *DefaultSession) Run() {
 					continue
 				}
 				s.peers[frame.Src] = p
+
+			case *proto.Frame_Error:
+				log.Warn().
+					Str("peer", frame.Src).
+					Err(pl.Error).
+					Uint64("ref", pl.Error.Ref).
+					Msg("signaling error")
+				if pl.Error.Code == proto.Error_PEER_OFFLINE {
+					if p, ok := s.peers[frame.Src]; ok {
+						p.Close()
+						delete(s.peers, frame.Src)
+					}
+				}
+				s.sevents <- EventSignalingError{Peer: frame.Src, Err: pl.Error}
+
+			case *proto.Frame_Ack:
+				s.sevents <- EventDelivered{Peer: frame.Src, Ref: pl.Ack.Ref}
+
+			case *proto.Frame_Control:
+				if m := pl.Control.GetModeration(); m != nil {
+					s.handleModeration(frame.Src, m)
+				}
+
+			case *proto.Frame_Hello:
+				s.handleHello(frame.Src, pl.Hello)
+
+			case *proto.Frame_Welcome:
+				s.handleWelcome(frame.Src, pl.Welcome)
+
+			case *proto.Frame_Notice:
+				s.handleNotice(pl.Notice)
+
+			case *proto.Frame_Chat:
+				s.sevents <- EventChat{Peer: frame.Src, Text: pl.Chat.Text}
+
+			case *proto.Frame_FileOffer:
+				s.sevents <- EventFileOffer{Peer: frame.Src, Offer: pl.FileOffer}
 			}
 		case frame := <-s.forward:
+			s.lastID++
 			frame.Src = s.Self
+			frame.Id = s.lastID
 			if err := s.signal.Send(frame); err != nil {
 				log.Error().Err(err).Str("dst", frame.Dst).Msg("send frame")
 				continue
@@ -134,6 +199,14 @@ func (s *DefaultSession) Run() {
 			case EventPeerClosed:
 				delete(s.peers, e.Peer.Name())
 				s.sevents <- e
+			case EventRCon:
+				if s.rconRevoked {
+					log.Debug().Str("peer", e.Peer.Name()).Msg("remote control revoked, discarding event")
+				} else if !s.supports(e.Peer.Name(), proto.FeatureRCon) {
+					log.Debug().Str("peer", e.Peer.Name()).Msg("remote control not negotiated, discarding event")
+				} else {
+					s.sevents <- e
+				}
 			}
 		case <-s.done:
 			break
@@ -157,12 +230,84 @@ func (s *DefaultSession) Connect(name string) error {
 		return err
 	}
 
+	hello := newHello()
+	hello.Dst = name
+	s.forward <- hello
+
 	p.Connect()
 	s.peers[name] = p
 
 	return nil
 }
 
+// Hangup closes the connection to peer and tells the peer and the
+// signaling service with an SDP rollback that the call has ended.
+func (s *DefaultSession) Hangup(name string) error {
+	p, ok := s.peers[name]
+	if !ok {
+		return fmt.Errorf("not connected to %s", name)
+	}
+	if p != nil {
+		p.Close()
+	}
+	delete(s.peers, name)
+	delete(s.shares, name)
+
+	return s.signal.Send(&proto.Frame{
+		Src:     s.Self,
+		Dst:     name,
+		Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_ROLLBACK}},
+	})
+}
+
+// Share starts or stops sharing the screen with peer and announces it to
+// the peer and the signaling service, which records it in the call log.
+func (s *DefaultSession) Share(name string, active bool) error {
+	p, ok := s.peers[name]
+	if !ok {
+		return fmt.Errorf("not connected to %s", name)
+	}
+	if p != nil && p.ScreenLocal() != nil {
+		if active {
+			p.ScreenLocal().Send()
+		} else {
+			p.ScreenLocal().Stop()
+		}
+	}
+	if s.shares[name] == active {
+		return nil
+	}
+	if active {
+		s.shares[name] = true
+	} else {
+		delete(s.shares, name)
+	}
+
+	return s.signal.Send(&proto.Frame{
+		Src:     s.Self,
+		Dst:     name,
+		Payload: proto.PayloadWithShare(active),
+	})
+}
+
+// handleHangup ends the call with a peer that sent an SDP rollback. A
+// rollback from a peer without a call is ignored.
+func (s *DefaultSession) handleHangup(name string) {
+	p, ok := s.peers[name]
+	if !ok {
+		log.Debug().Str("peer", name).Msg("hang up without call, ignoring")
+		return
+	}
+	if p != nil {
+		p.Close()
+	}
+	delete(s.peers, name)
+	delete(s.shares, name)
+
+	log.Info().Str("peer", name).Msg("call ended by peer")
+	s.sevents <- EventHangup{Peer: name}
+}
+
 func (s *DefaultSession) Close() {
 	for _, peer := range s.peers {
 		if peer == nil {
@@ -182,6 +327,89 @@ func (s *DefaultSession) Events() <-chan Event {
 	return s.sevents
 }
 
+// handleQueued processes frames that were stored by the signaling service
+// while offline. Stored call offers are reported as missed calls, chat
+// messages and file offers with the time they were stored.
+func (s *DefaultSession) handleQueued(frame *proto.Frame) {
+	t := time.Unix(frame.Queued, 0)
+	switch pl := frame.Payload.(type) {
+	case *proto.Frame_Sdp:
+		if pl.Sdp.Type != proto.SDP_OFFER {
+			break
+		}
+		log.Info().Str("peer", frame.Src).Time("time", t).Msg("missed call")
+		s.sevents <- EventMissedCall{Peer: frame.Src, Time: t}
+		return
+	case *proto.Frame_Chat:
+		s.sevents <- EventChat{Peer: frame.Src, Text: pl.Chat.Text, Queued: t}
+		return
+	case *proto.Frame_FileOffer:
+		s.sevents <- EventFileOffer{Peer: frame.Src, Offer: pl.FileOffer, Queued: t}
+		return
+	}
+	log.Debug().
+		Str("peer", frame.Src).
+		Stringer("type", reflect.TypeOf(frame.Payload)).
+		Msg("discarding stored frame")
+}
+
+// handleModeration applies a moderator action. Actions are authorized by
+// the signaling service. Kicked users hang up the calls with the users of
+// the channel, STOP_SHARE stops the screen share and REVOKE_CONTROL
+// discards further remote control until RESTORE_CONTROL.
+func (s *DefaultSession) handleModeration(src string, m *proto.Control_Moderation) {
+	log.Info().
+		Str("moderator", src).
+		Str("channel", m.Channel).
+		Stringer("action", m.Action).
+		Msg("moderator action")
+
+	switch m.Action {
+	case proto.Control_Moderation_KICK:
+		for _, name := range m.Users {
+			if _, ok := s.peers[name]; !ok {
+				continue
+			}
+			if err := s.Hangup(name); err != nil {
+				log.Error().Err(err).Str("peer", name).Msg("hang up")
+			}
+		}
+	case proto.Control_Moderation_STOP_SHARE:
+		for name := range s.peers {
+			if err := s.Share(name, false); err != nil {
+				log.Error().Err(err).Str("peer", name).Msg("stop share")
+			}
+		}
+	case proto.Control_Moderation_REVOKE_CONTROL:
+		s.rconRevoked = true
+	case proto.Control_Moderation_RESTORE_CONTROL:
+		s.rconRevoked = false
+	}
+	s.sevents <- EventModeration{
+		Moderator: src,
+		Channel:   m.Channel,
+		Action:    m.Action,
+	}
+}
+
+// handleNotice announces a notice of the signaling service unless it has
+// expired, e.g. while it was queued.
+func (s *DefaultSession) handleNotice(n *proto.Notice) {
+	if n.Expired(time.Now()) {
+		log.Debug().Str("text", n.Text).Msg("discarding expired notice")
+		return
+	}
+	log.Info().
+		Stringer("severity", n.Severity).
+		Str("text", n.Text).
+		Msg("signaling notice")
+	s.sevents <- EventNotice{
+		Severity: n.Severity,
+		Text:     n.Text,
+		Expires:  n.ExpiresAt(),
+	}
+}
+
 func (s *DefaultSession) handleSignalStateChange(st SignalState) {
 	log.Info().Stringer("state", st).Msg("signaling: connection state changed")
 	switch st {
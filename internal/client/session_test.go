@@ -118,6 +118,272 @@ func TestSession(t *testing.T) {
 	}
 }
 
+func TestSession_SignalingReply(t *testing.T) {
+	signal := &fakeSignal{
+		recv: make(chan *proto.Frame, 1),
+	}
+	s, err := NewSession("user1", signal)
+	require.NoError(t, err)
+	go s.Run()
+
+	tests := []struct {
+		desc string
+		give *proto.Frame
+		want Event
+	}{
+		{
+			desc: "peer offline",
+			give: &proto.Frame{
+				Src:     "user2",
+				Dst:     "user1",
+				Payload: proto.PayloadWithError(proto.Error_PEER_OFFLINE, "peer offline", 1),
+			},
+			want: EventSignalingError{
+				Peer: "user2",
+				Err: &proto.Error{
+					Code:    proto.Error_PEER_OFFLINE,
+					Message: "peer offline",
+					Ref:     1,
+				},
+			},
+		},
+		{
+			desc: "delivered",
+			give: &proto.Frame{
+				Src:     "user2",
+				Dst:     "user1",
+				Payload: proto.PayloadWithAck(2),
+			},
+			want: EventDelivered{Peer: "user2", Ref: 2},
+		},
+		{
+			desc: "missed call",
+			give: &proto.Frame{
+				Src:    "user2",
+				Dst:    "user1",
+				Queued: 1600000000,
+				Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{
+					Type: proto.SDP_OFFER,
+				}},
+			},
+			want: EventMissedCall{Peer: "user2", Time: time.Unix(1600000000, 0)},
+		},
+		{
+			desc: "chat",
+			give: &proto.Frame{
+				Src:     "user2",
+				Dst:     "user1",
+				Payload: proto.PayloadWithChat("hello"),
+			},
+			want: EventChat{Peer: "user2", Text: "hello"},
+		},
+		{
+			desc: "stored chat",
+			give: &proto.Frame{
+				Src:     "user2",
+				Dst:     "user1",
+				Queued:  1600000000,
+				Payload: proto.PayloadWithChat("hello"),
+			},
+			want: EventChat{Peer: "user2", Text: "hello", Queued: time.Unix(1600000000, 0)},
+		},
+		{
+			desc: "moderator action",
+			give: &proto.Frame{
+				Src:     "user2",
+				Dst:     "user1",
+				Payload: proto.PayloadWithModeration(proto.Control_Moderation_STOP_SHARE, "Lobby"),
+			},
+			want: EventModeration{
+				Moderator: "user2",
+				Channel:   "Lobby",
+				Action:    proto.Control_Moderation_STOP_SHARE,
+			},
+		},
+		{
+			desc: "notice",
+			give: &proto.Frame{
+				Dst:     "user1",
+				Payload: proto.PayloadWithNotice(proto.Notice_WARNING, "restart", time.Unix(4000000000, 0)),
+			},
+			want: EventNotice{
+				Severity: proto.Notice_WARNING,
+				Text:     "restart",
+				Expires:  time.Unix(4000000000, 0),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			signal.recv <- tt.give
+			select {
+			case have := <-s.Events():
+				assert.Equal(t, tt.want, have)
+			case <-time.After(1 * time.Second):
+				t.Error("receive timeout")
+			}
+		})
+	}
+}
+
+func TestSession_Hello(t *testing.T) {
+	signal := &fakeSignal{
+		recv:  make(chan *proto.Frame, 1),
+		other: &fakeSignal{recv: make(chan *proto.Frame, 1)},
+	}
+	s, err := NewSession("user1", signal)
+	require.NoError(t, err)
+	go s.Run()
+
+	signal.recv <- &proto.Frame{
+		Src:     "user2",
+		Dst:     "user1",
+		Payload: proto.PayloadWithHello("1.0", "device", []string{proto.FeatureCodecVP8, proto.FeatureRCon}),
+	}
+	select {
+	case have := <-signal.other.recv:
+		assert.Equal(t, "user1", have.Src)
+		assert.Equal(t, "user2", have.Dst)
+		require.NotNil(t, have.GetWelcome())
+		assert.Equal(t, Version, have.GetWelcome().Version)
+		assert.Equal(t, []string{proto.FeatureRCon}, have.GetWelcome().Features)
+	case <-time.After(1 * time.Second):
+		t.Error("receive timeout")
+	}
+}
+
+func TestSession_Hangup(t *testing.T) {
+	signal := &fakeSignal{
+		recv:  make(chan *proto.Frame, 1),
+		other: &fakeSignal{recv: make(chan *proto.Frame, 1)},
+	}
+	s, err := NewSession("user1", signal)
+	require.NoError(t, err)
+	s.peers["user2"] = nil
+
+	require.NoError(t, s.Hangup("user2"))
+	have := <-signal.other.recv
+	assert.Equal(t, "user2", have.Dst)
+	assert.Equal(t, proto.SDP_ROLLBACK, have.GetSdp().GetType())
+	assert.NotContains(t, s.peers, "user2")
+
+	assert.Error(t, s.Hangup("user2"), "unknown peer should fail")
+}
+
+func TestSession_Share(t *testing.T) {
+	signal := &fakeSignal{
+		recv:  make(chan *proto.Frame, 1),
+		other: &fakeSignal{recv: make(chan *proto.Frame, 1)},
+	}
+	s, err := NewSession("user1", signal)
+	require.NoError(t, err)
+	s.peers["user2"] = &fakePeer{name: "user2"}
+
+	require.NoError(t, s.Share("user2", true))
+	have := <-signal.other.recv
+	assert.Equal(t, "user2", have.Dst)
+	assert.True(t, have.GetShare().GetActive())
+
+	require.NoError(t, s.Share("user2", true))
+	assert.Empty(t, signal.other.recv, "repeated share should not be announced")
+
+	require.NoError(t, s.Share("user2", false))
+	have = <-signal.other.recv
+	require.NotNil(t, have.GetShare())
+	assert.False(t, have.GetShare().GetActive())
+
+	assert.Error(t, s.Share("user3", true), "unknown peer should fail")
+}
+
+func TestSession_RemoteHangup(t *testing.T) {
+	signal1 := &fakeSignal{recv: make(chan *proto.Frame, 1)}
+	signal2 := &fakeSignal{recv: make(chan *proto.Frame, 1)}
+	signal1.other = signal2
+	signal2.other = signal1
+
+	s1, err := NewSession("user1", signal1)
+	require.NoError(t, err)
+	s2, err := NewSession("user2", signal2)
+	require.NoError(t, err)
+	callee := &fakePeer{name: "user1"}
+	s1.peers["user2"] = &fakePeer{name: "user2"}
+	s2.peers["user1"] = callee
+	go s2.Run()
+
+	// the caller hangs up, the callee's call ends
+	require.NoError(t, s1.Hangup("user2"))
+	select {
+	case have := <-s2.Events():
+		assert.Equal(t, EventHangup{Peer: "user1"}, have)
+	case <-time.After(1 * time.Second):
+		t.Fatal("receive timeout")
+	}
+	assert.True(t, callee.closed)
+
+	// a late hang up does not create a peer
+	s1.peers["user2"] = nil
+	require.NoError(t, s1.Hangup("user2"))
+	signal2.recv <- &proto.Frame{
+		Src:     "user1",
+		Dst:     "user2",
+		Payload: proto.PayloadWithChat("bye"),
+	}
+	select {
+	case have := <-s2.Events():
+		assert.Equal(t, EventChat{Peer: "user1", Text: "bye"}, have)
+	case <-time.After(1 * time.Second):
+		t.Fatal("receive timeout")
+	}
+	assert.Empty(t, s2.peers)
+}
+
+func TestSession_Kick(t *testing.T) {
+	signal := &fakeSignal{
+		recv:  make(chan *proto.Frame, 1),
+		other: &fakeSignal{recv: make(chan *proto.Frame, 2)},
+	}
+	s, err := NewSession("user1", signal)
+	require.NoError(t, err)
+	s.peers["user2"] = &fakePeer{name: "user2"}
+	s.peers["user3"] = &fakePeer{name: "user3"}
+
+	kick := &proto.Control_Moderation{
+		Action:  proto.Control_Moderation_KICK,
+		Channel: "Lobby",
+		Users:   []string{"user2", "user4"},
+	}
+	s.handleModeration("mod", kick)
+	assert.Equal(t, EventModeration{
+		Moderator: "mod",
+		Channel:   "Lobby",
+		Action:    proto.Control_Moderation_KICK,
+	}, <-s.Events())
+
+	// only the call with the user of the channel ends
+	have := <-signal.other.recv
+	assert.Equal(t, "user2", have.Dst)
+	assert.Equal(t, proto.SDP_ROLLBACK, have.GetSdp().GetType())
+	assert.Empty(t, signal.other.recv)
+	assert.NotContains(t, s.peers, "user2")
+	assert.Contains(t, s.peers, "user3")
+}
+
+type fakePeer struct {
+	name   string
+	closed bool
+}
+
+func (p *fakePeer) VideoLocal() StreamSender           { return nil }
+func (p *fakePeer) VideoRemote() StreamReceiver        { return nil }
+func (p *fakePeer) AudioLocal() StreamSender           { return nil }
+func (p *fakePeer) AudioRemote() StreamReceiver        { return nil }
+func (p *fakePeer) ScreenLocal() StreamSender          { return nil }
+func (p *fakePeer) ScreenRemote() StreamReceiver       { return nil }
+func (p *fakePeer) Name() string                       { return p.name }
+func (p *fakePeer) HandleSignaling(*proto.Frame) error { return nil }
+func (p *fakePeer) Close()                             { p.closed = true }
+
 type fakeSignal struct {
 	other        *fakeSignal
 	recv         chan *proto.Frame
@@ -3,6 +3,7 @@ package client
 import (
 	"crypto/tls"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
+	conf "github.com/spf13/viper"
 )
 
 type SignalState int
@@ -38,19 +40,35 @@ type SignalSendReceiver interface {
 	HandleStateChange(SignalStateHandler)
 }
 
-// Signal provides signaling via websocket.
+// Signal provides signaling via websocket. It falls back to an event
+// stream if the websocket handshake is refused, e.g. by a proxy.
 type Signal struct {
 	sync.RWMutex
 	url    string
 	header http.Header
 
-	conn   *websocket.Conn
-	dialer *websocket.Dialer
-	send   chan *proto.Frame
-	recv   chan *proto.Frame
-	done   chan bool
-	state  SignalState
-	h      SignalStateHandler
+	conn     signalConn
+	codec    proto.Codec
+	dialer   *websocket.Dialer
+	client   *http.Client
+	fallback bool
+	send     chan *proto.Frame
+	recv     chan *proto.Frame
+	done     chan bool
+	state    SignalState
+	h        SignalStateHandler
+
+	// session resumption state, guarded by wmu which also serializes writes
+	wmu    sync.Mutex
+	token  string
+	inSeq  uint64
+	outSeq uint64
+	sent   []*proto.Frame
+
+	// frames are held until the handshake on the current connection is
+	// done, guarded by wmu
+	ready bool
+	held  []*proto.Frame
 }
 
 const (
@@ -62,6 +80,7 @@ const (
 	writeTimeout      = 20 * time.Second
 	reconnectInterval = 10 * time.Second
 	maxMessageSize    = 512
+	replaySize        = 64
 	verifyTLS         = true
 )
 
@@ -70,16 +89,21 @@ func Dial(url string, h http.Header) *Signal {
 	dialer := &websocket.Dialer{
 		Proxy:            http.ProxyFromEnvironment,
 		HandshakeTimeout: handshakeTimeout,
-		TLSClientConfig:  &tls.Config{InsecureSkipVerify: !verifyTLS},
+		TLSClientConfig:  tlsConfig(),
+		Subprotocols:     []string{proto.SubprotocolProto},
 	}
 
 	s := &Signal{
 		url:    url,
 		header: h,
 		dialer: dialer,
-		send:   make(chan *proto.Frame, 1),
-		recv:   make(chan *proto.Frame),
-		done:   make(chan bool),
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:           dialer.Proxy,
+			TLSClientConfig: dialer.TLSClientConfig,
+		}},
+		send: make(chan *proto.Frame, 1),
+		recv: make(chan *proto.Frame),
+		done: make(chan bool),
 	}
 
 	go s.connect()
@@ -90,21 +114,42 @@ func Dial(url string, h http.Header) *Signal {
 	return s
 }
 
+// tlsConfig returns the TLS configuration of the signaling connection. The
+// configured client certificate is presented to the server.
+func tlsConfig() *tls.Config {
+	tc := &tls.Config{InsecureSkipVerify: !verifyTLS}
+	crt := conf.GetString("auth.tls_crt")
+	if crt == "" {
+		return tc
+	}
+	c, err := tls.LoadX509KeyPair(crt, conf.GetString("auth.tls_key"))
+	if err != nil {
+		log.Error().Err(err).Str("file", crt).Msg("signaling: load client certificate")
+		return tc
+	}
+	tc.Certificates = []tls.Certificate{c}
+	return tc
+}
+
 func (s *Signal) connect() {
 	s.setState(SignalStateDisconnected)
 	s.Lock()
 	defer s.Unlock()
+	s.wmu.Lock()
+	s.ready = false
+	s.wmu.Unlock()
 	timer := time.NewTimer(0)
 	for {
 		select {
 		case <-timer.C:
-			c, _, err := s.dialer.Dial(s.url, s.header)
+			c, err := s.dial()
 			if err != nil {
 				log.Warn().Err(err).Msg("signaling: dial failed")
 				timer.Reset(reconnectInterval)
 				continue
 			}
 			s.conn = c
+			s.codec = proto.CodecFor(c.Subprotocol())
 			s.setState(SignalStateConnected)
 			log.Info().Str("url", s.url).Msg("signaling: connected")
 			return
@@ -114,6 +159,122 @@ func (s *Signal) connect() {
 	}
 }
 
+// dial connects to the signaling service. It falls back to the event
+// stream transport for good once a websocket handshake was refused for
+// other reasons than authentication.
+func (s *Signal) dial() (signalConn, error) {
+	h := s.resumeHeader()
+	if !s.fallback {
+		c, res, err := s.dialer.Dial(s.url, h)
+		if err == nil {
+			return c, nil
+		}
+		if err != websocket.ErrBadHandshake || res == nil ||
+			res.StatusCode == http.StatusUnauthorized ||
+			res.StatusCode == http.StatusForbidden {
+			return nil, err
+		}
+		log.Warn().
+			Int("status", res.StatusCode).
+			Msg("signaling: websocket handshake refused, falling back to event stream")
+		s.fallback = true
+	}
+	return dialEvents(s.client, eventURL(s.url), h)
+}
+
+// resumeHeader returns the connection header including the resume token
+// of the current session.
+func (s *Signal) resumeHeader() http.Header {
+	h := make(http.Header)
+	for k, v := range s.header {
+		h[k] = v
+	}
+
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if s.token != "" {
+		h.Set(proto.ResumeTokenHeader, s.token)
+		h.Set(proto.ResumeSeqHeader, strconv.FormatUint(s.inSeq, 10))
+	}
+	return h
+}
+
+// handshake announces the client and synchronizes the session state with
+// the server after connecting. Frames the server has not received yet are
+// sent again, followed by the frames held while connecting. The hello is
+// always the first frame on a connection and is not part of the session.
+func (s *Signal) handshake(r *proto.Resume) {
+	s.RLock()
+	defer s.RUnlock()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if err := s.write(newHello()); err != nil {
+		log.Warn().Err(err).Msg("signaling: write hello")
+		return
+	}
+
+	if r.Token != s.token {
+		if s.token != "" {
+			log.Info().Msg("signaling: session expired, starting new session")
+		}
+		s.token = r.Token
+		s.inSeq = 0
+		s.outSeq = 0
+		s.sent = nil
+	} else {
+		log.Info().Uint64("seq", r.Seq).Msg("signaling: session resumed")
+		for _, f := range s.sent {
+			if f.Seq <= r.Seq {
+				continue
+			}
+			if err := s.write(f); err != nil {
+				log.Warn().Err(err).Msg("signaling: write message")
+				return
+			}
+		}
+	}
+
+	held := s.held
+	s.held = nil
+	s.ready = true
+	for _, f := range held {
+		if err := s.writeSession(f); err != nil {
+			log.Warn().Err(err).Msg("signaling: write message")
+			return
+		}
+	}
+}
+
+// writeSession assigns the next sequence number to f, keeps it for replay
+// and sends it on the current connection. The caller must hold the read
+// lock and wmu.
+func (s *Signal) writeSession(f *proto.Frame) error {
+	s.outSeq++
+	f.Seq = s.outSeq
+	s.sent = append(s.sent, f)
+	if len(s.sent) > replaySize {
+		s.sent = append(s.sent[:0], s.sent[1:]...)
+	}
+	return s.write(f)
+}
+
+// write sends f on the current connection. The caller must hold the read
+// lock and wmu.
+func (s *Signal) write(f *proto.Frame) error {
+	data, err := s.codec.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	mt := websocket.BinaryMessage
+	if s.codec.Text() {
+		mt = websocket.TextMessage
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return s.conn.WriteMessage(mt, data)
+}
+
 func (s *Signal) setState(st SignalState) {
 	if st != s.state {
 		s.state = st
@@ -139,7 +300,11 @@ func (s *Signal) Receive() <-chan *proto.Frame {
 
 func (s *Signal) Close() error {
 	data := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	s.RLock()
+	s.wmu.Lock()
 	err := s.conn.WriteMessage(websocket.CloseMessage, data)
+	s.wmu.Unlock()
+	s.RUnlock()
 	if err != nil {
 		return err
 	}
@@ -160,15 +325,17 @@ func (s *Signal) writePump() {
 	for {
 		select {
 		case frame := <-s.send:
-			data, err := frame.Marshal()
-			if err != nil {
-				log.Warn().Err(err).Msg("signaling: marshal")
-				continue
-			}
-
 			s.RLock()
-			s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
-			err = s.conn.WriteMessage(websocket.TextMessage, data)
+			s.wmu.Lock()
+			var err error
+			if s.ready {
+				err = s.writeSession(frame)
+			} else if len(s.held) < replaySize {
+				s.held = append(s.held, frame)
+			} else {
+				log.Warn().Str("dst", frame.Dst).Msg("signaling: not connected, discarding message")
+			}
+			s.wmu.Unlock()
 			s.RUnlock()
 			if err != nil {
 				log.Warn().Err(err).Msg("signaling: write message")
@@ -177,9 +344,12 @@ func (s *Signal) writePump() {
 
 		case <-ticker.C:
 			s.RLock()
+			s.wmu.Lock()
 			s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err := s.conn.WriteMessage(websocket.PingMessage, nil)
+			s.wmu.Unlock()
 			s.RUnlock()
-			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err != nil {
 				return
 			}
 		}
@@ -188,6 +358,9 @@ func (s *Signal) writePump() {
 
 func (s *Signal) readPump() {
 	defer func() {
+		s.RLock()
+		s.conn.Close()
+		s.RUnlock()
 		close(s.done)
 		s.setState(SignalStateDisconnected)
 	}()
@@ -203,6 +376,14 @@ func (s *Signal) readPump() {
 		_, data, err := s.conn.ReadMessage()
 		s.RUnlock()
 		if err != nil {
+			if websocket.IsCloseError(err, proto.CloseReplaced) {
+				log.Warn().Msg("signaling: connection replaced by another client")
+				break
+			}
+			if websocket.IsCloseError(err, proto.CloseIncompatible) {
+				log.Error().Err(err).Msg("signaling: client version not supported")
+				break
+			}
 			if websocket.IsUnexpectedCloseError(err,
 				websocket.CloseNormalClosure,
 				websocket.CloseGoingAway,
@@ -221,10 +402,31 @@ func (s *Signal) readPump() {
 		}
 
 		f := &proto.Frame{}
-		if err := f.Unmarshal(data); err != nil {
+		s.RLock()
+		err = s.codec.Unmarshal(data, f)
+		s.RUnlock()
+		if err != nil {
 			log.Error().Err(err).Msg("signaling: unmarshal")
 			continue
 		}
+
+		if pl, ok := f.Payload.(*proto.Frame_Resume); ok {
+			s.handshake(pl.Resume)
+			continue
+		}
+
+		if f.Seq != 0 {
+			s.wmu.Lock()
+			dup := f.Seq <= s.inSeq
+			if !dup {
+				s.inSeq = f.Seq
+			}
+			s.wmu.Unlock()
+			if dup {
+				log.Debug().Uint64("seq", f.Seq).Msg("signaling: duplicate frame")
+				continue
+			}
+		}
 		s.recv <- f
 	}
 	log.Info().Msg("signaling: done")
@@ -7,14 +7,15 @@ import (
 	"testing"
 	"time"
 
-	"github.com/lx7/devnet/internal/testutil"
+	"github.com/gorilla/websocket"
 	"github.com/lx7/devnet/proto"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSignal_Echo(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(testutil.Echo))
+	server := httptest.NewServer(http.HandlerFunc(echoSession))
 	url := "ws" + strings.TrimPrefix(server.URL, "http")
 
 	time.Sleep(100 * time.Millisecond)
@@ -44,3 +45,146 @@ func TestSignal_Echo(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 	server.Close()
 }
+
+// echoSession starts a session like the signaling service and echoes all
+// frames except hellos.
+func echoSession(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	out, _ := (&proto.Frame{Payload: &proto.Frame_Resume{
+		Resume: &proto.Resume{Token: "token"},
+	}}).Marshal()
+	if err := conn.WriteMessage(websocket.BinaryMessage, out); err != nil {
+		return
+	}
+	for {
+		mt, in, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		f := &proto.Frame{}
+		if f.Unmarshal(in) == nil && f.GetHello() != nil {
+			continue
+		}
+		if err := conn.WriteMessage(mt, in); err != nil {
+			return
+		}
+	}
+}
+
+func TestSignal_Resume(t *testing.T) {
+	headers := make(chan http.Header, 2)
+	frames := make(chan *proto.Frame, 2)
+	hellos := make(chan *proto.Hello, 2)
+	upgrader := websocket.Upgrader{}
+
+	// the fake server drops the first connection after receiving a frame
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		out, _ := (&proto.Frame{Payload: &proto.Frame_Resume{
+			Resume: &proto.Resume{Token: "token"},
+		}}).Marshal()
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, out))
+
+		for {
+			mt, in, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			assert.Equal(t, websocket.BinaryMessage, mt)
+			f := &proto.Frame{}
+			require.NoError(t, f.Unmarshal(in))
+			if h := f.GetHello(); h != nil {
+				hellos <- h
+				continue
+			}
+			frames <- f
+			return
+		}
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	signal := Dial(url, nil)
+	assert.Empty(t, (<-headers).Get(proto.ResumeTokenHeader))
+
+	// the hello is sent after the session was established
+	h := <-hellos
+	assert.Equal(t, uint32(proto.ProtocolVersion), h.Protocol)
+	assert.Equal(t, Features, h.Features)
+
+	signal.Send(&proto.Frame{Src: "user 1", Dst: "user 2", Id: 1})
+	have := <-frames
+	assert.Equal(t, uint64(1), have.Seq)
+
+	// the frame is sent again after the session was resumed
+	select {
+	case h := <-headers:
+		assert.Equal(t, "token", h.Get(proto.ResumeTokenHeader))
+		assert.Equal(t, "0", h.Get(proto.ResumeSeqHeader))
+	case <-time.After(reconnectInterval + time.Second):
+		t.Fatal("reconnect timeout")
+	}
+	have = <-frames
+	assert.Equal(t, uint64(1), have.Id)
+	assert.Equal(t, uint64(1), have.Seq)
+}
+
+func TestSignal_Handshake(t *testing.T) {
+	frames := make(chan *proto.Frame, 4)
+	upgrader := websocket.Upgrader{}
+
+	// the fake server sends the resume frame after a delay
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		go func() {
+			for {
+				_, in, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				f := &proto.Frame{}
+				require.NoError(t, f.Unmarshal(in))
+				frames <- f
+			}
+		}()
+
+		time.Sleep(200 * time.Millisecond)
+		assert.Empty(t, frames, "frames should be held until the handshake")
+		out, _ := (&proto.Frame{Payload: &proto.Frame_Resume{
+			Resume: &proto.Resume{Token: "token"},
+		}}).Marshal()
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, out))
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	signal := Dial(url, nil)
+	signal.Send(&proto.Frame{Src: "user 1", Dst: "user 2", Id: 1})
+
+	for _, want := range []string{"hello", "frame"} {
+		select {
+		case have := <-frames:
+			if want == "hello" {
+				assert.NotNil(t, have.GetHello(), "hello should be sent first")
+				continue
+			}
+			assert.Equal(t, uint64(1), have.Id)
+			assert.Equal(t, uint64(1), have.Seq)
+		case <-time.After(1 * time.Second):
+			t.Fatalf("receive timeout for %s", want)
+		}
+	}
+}
@@ -96,3 +96,19 @@ func (b *Builder) GetCheckButton(id string) *gtk.CheckButton {
 	}
 	return r
 }
+
+func (b *Builder) GetInfoBar(id string) *gtk.InfoBar {
+	r, ok := b.GetObject(id).(*gtk.InfoBar)
+	if !ok {
+		log.Fatal().Str("object_id", id).Msg("gtk obj type mismatch")
+	}
+	return r
+}
+
+func (b *Builder) GetLabel(id string) *gtk.Label {
+	r, ok := b.GetObject(id).(*gtk.Label)
+	if !ok {
+		log.Fatal().Str("object_id", id).Msg("gtk obj type mismatch")
+	}
+	return r
+}
@@ -66,6 +66,20 @@ func TestBuilder_GetObj(t *testing.T) {
 				return b.GetToggleButton(id)
 			},
 		},
+		{
+			give: "notice_bar",
+			want: &gtk.InfoBar{},
+			f: func(b *Builder, id string) interface{} {
+				return b.GetInfoBar(id)
+			},
+		},
+		{
+			give: "notice_label",
+			want: &gtk.Label{},
+			f: func(b *Builder, id string) interface{} {
+				return b.GetLabel(id)
+			},
+		},
 	}
 
 	ui, err := FSString(false, layoutPath)
@@ -10,6 +10,7 @@ import (
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/lx7/devnet/internal/client"
+	"github.com/lx7/devnet/proto"
 	"github.com/rs/zerolog/log"
 )
 
@@ -122,6 +123,21 @@ func (g *GUI) onSessionEvent(e client.Event) {
 		case "screen":
 			execOnMain(func() { g.videoWindow.Hide() })
 		}
+	case client.EventModeration:
+		switch e.Action {
+		case proto.Control_Moderation_STOP_SHARE:
+			execOnMain(func() { g.mainWindow.shareButton.SetActive(false) })
+		case proto.Control_Moderation_KICK:
+			execOnMain(func() { g.mainWindow.detailsBox.Hide() })
+			g.peer = nil
+		}
+	case client.EventNotice:
+		execOnMain(func() { g.mainWindow.showNotice(e) })
+		if !e.Expires.IsZero() {
+			time.AfterFunc(time.Until(e.Expires), func() {
+				execOnMain(func() { g.mainWindow.hideNotice(e) })
+			})
+		}
 	}
 }
 
@@ -159,6 +175,7 @@ func (g *GUI) onStartup() {
 		"main_window_destroy":  g.onDestroy,
 		"share_button_toggle":  g.onShareButtonToggle,
 		"camera_button_toggle": g.onCameraButtonToggle,
+		"notice_bar_response":  g.onNoticeBarResponse,
 		"test_call_user1":      g.onCallUser1,
 		"test_call_user2":      g.onCallUser2,
 	}
@@ -197,10 +214,8 @@ func (g *GUI) onCallUser2() {
 }
 
 func (g *GUI) onShareButtonToggle(b *gtk.ToggleButton) {
-	if b.GetActive() {
-		g.peer.ScreenLocal().Send()
-	} else {
-		g.peer.ScreenLocal().Stop()
+	if err := g.session.Share(g.peer.Name(), b.GetActive()); err != nil {
+		log.Error().Err(err).Msg("share screen")
 	}
 }
 
@@ -215,6 +230,10 @@ func (g *GUI) onCameraButtonToggle(b *gtk.ToggleButton) {
 	}
 }
 
+func (g *GUI) onNoticeBarResponse(b *gtk.InfoBar) {
+	b.Hide()
+}
+
 func execOnMain(f interface{}, args ...interface{}) {
 	_, err := glib.IdleAdd(f, args)
 	if err != nil {
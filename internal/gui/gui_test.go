@@ -85,6 +85,25 @@ func TestGUI_Events(t *testing.T) {
 				assert.Equal(t, false, gui.videoWindow.IsVisible())
 			},
 		},
+		{
+			desc: "notice",
+			give: client.EventNotice{
+				Severity: proto.Notice_WARNING,
+				Text:     "restart",
+				Expires:  time.Now().Add(500 * time.Millisecond),
+			},
+			check: func(t *testing.T) {
+				assert.Equal(t, true, gui.mainWindow.noticeBar.IsVisible())
+				assert.Equal(t, gtk.MESSAGE_WARNING, gui.mainWindow.noticeBar.GetMessageType())
+			},
+		},
+		{
+			desc: "notice expired",
+			give: client.EventConnected{},
+			check: func(t *testing.T) {
+				assert.Equal(t, false, gui.mainWindow.noticeBar.IsVisible())
+			},
+		},
 		{
 			desc: "peer diconnected",
 			give: client.EventPeerDisconnected{Peer: peer},
@@ -270,3 +289,13 @@ func (s *fakeSession) Connect(peer string) error {
 	s.Called(peer)
 	return nil
 }
+
+func (s *fakeSession) Hangup(peer string) error {
+	s.Called(peer)
+	return nil
+}
+
+func (s *fakeSession) Share(peer string, active bool) error {
+	s.Called(peer, active)
+	return nil
+}
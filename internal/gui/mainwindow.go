@@ -2,6 +2,8 @@ package gui
 
 import (
 	"github.com/gotk3/gotk3/gtk"
+	"github.com/lx7/devnet/internal/client"
+	"github.com/lx7/devnet/proto"
 )
 
 type mainWindow struct {
@@ -13,6 +15,11 @@ type mainWindow struct {
 	detailsBox   *gtk.Box
 	remoteCam    *gtk.DrawingArea
 	localCam     *gtk.DrawingArea
+	noticeBar    *gtk.InfoBar
+	noticeLabel  *gtk.Label
+
+	// notice is the notice shown in noticeBar
+	notice client.EventNotice
 }
 
 func (w *mainWindow) Populate(b *Builder) error {
@@ -26,6 +33,30 @@ func (w *mainWindow) Populate(b *Builder) error {
 	w.cameraButton = b.GetToggleButton("camera_button")
 	w.remoteCam = b.GetDrawingArea("remote_camera_overlay")
 	w.localCam = b.GetDrawingArea("local_camera_overlay")
+	w.noticeBar = b.GetInfoBar("notice_bar")
+	w.noticeLabel = b.GetLabel("notice_label")
 
 	return nil
 }
+
+// showNotice shows n in the notice bar, replacing the previous notice.
+func (w *mainWindow) showNotice(n client.EventNotice) {
+	w.notice = n
+	switch n.Severity {
+	case proto.Notice_WARNING:
+		w.noticeBar.SetMessageType(gtk.MESSAGE_WARNING)
+	case proto.Notice_CRITICAL:
+		w.noticeBar.SetMessageType(gtk.MESSAGE_ERROR)
+	default:
+		w.noticeBar.SetMessageType(gtk.MESSAGE_INFO)
+	}
+	w.noticeLabel.SetText(n.Text)
+	w.noticeBar.Show()
+}
+
+// hideNotice hides the notice bar if it still shows n.
+func (w *mainWindow) hideNotice(n client.EventNotice) {
+	if w.notice == n {
+		w.noticeBar.Hide()
+	}
+}
@@ -0,0 +1,140 @@
+package listen
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Address prefixes for listeners other than host:port.
+const (
+	// UnixPrefix selects a unix socket, e.g. "unix:/run/devnet/signald.sock".
+	UnixPrefix = "unix:"
+
+	// SystemdPrefix selects a socket passed by systemd socket activation,
+	// e.g. "systemd:signald.socket". The name is matched against the
+	// FileDescriptorName of the socket unit, which defaults to the unit name.
+	SystemdPrefix = "systemd:"
+)
+
+// listenFdsStart is the first file descriptor passed by socket activation.
+var listenFdsStart = 3
+
+var (
+	once      sync.Once
+	mu        sync.Mutex
+	inherited map[string][]*os.File
+)
+
+// Listen returns a stream listener for addr. Stale unix sockets are removed
+// before listening.
+func Listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, SystemdPrefix):
+		f, err := file(strings.TrimPrefix(addr, SystemdPrefix))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return net.FileListener(f)
+	case strings.HasPrefix(addr, UnixPrefix):
+		path := strings.TrimPrefix(addr, UnixPrefix)
+		if err := removeSocket(path); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+// ListenPacket returns a packet listener on network for addr. Only
+// host:port and systemd addresses are supported.
+func ListenPacket(network, addr string) (net.PacketConn, error) {
+	switch {
+	case strings.HasPrefix(addr, SystemdPrefix):
+		f, err := file(strings.TrimPrefix(addr, SystemdPrefix))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return net.FilePacketConn(f)
+	case strings.HasPrefix(addr, UnixPrefix):
+		return nil, fmt.Errorf("unix socket not supported: %v", addr)
+	default:
+		return net.ListenPacket(network, addr)
+	}
+}
+
+// IsUnix reports whether addr is the remote address of a unix socket peer.
+func IsUnix(addr string) bool {
+	return addr == "" || addr == "@"
+}
+
+// file returns the next unused socket passed for name.
+func file(name string) (*os.File, error) {
+	once.Do(func() {
+		inherited = inherit()
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	files := inherited[name]
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no socket passed for %v", name)
+	}
+	inherited[name] = files[1:]
+	return files[0], nil
+}
+
+// inherit returns the sockets passed by socket activation by name. The
+// environment variables are cleared so that child processes do not
+// inherit them.
+func inherit() map[string][]*os.File {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	files := make(map[string][]*os.File)
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return files
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return files
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files[name] = append(files[name], os.NewFile(uintptr(fd), name))
+	}
+	return files
+}
+
+// removeSocket removes the unix socket at path if it exists. Other files
+// are left in place and cause an error.
+func removeSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("not a socket: %v", path)
+	}
+	return os.Remove(path)
+}
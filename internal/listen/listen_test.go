@@ -0,0 +1,93 @@
+package listen
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen_Unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.sock")
+
+	// a stale socket is replaced
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := Listen(UnixPrefix + path)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	srcs := make(chan string, 1)
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srcs <- r.RemoteAddr
+	}))
+	c := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	res, err := c.Get("http://unix/")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.True(t, IsUnix(<-srcs))
+
+	t.Run("not a socket", func(t *testing.T) {
+		file := filepath.Join(dir, "file")
+		require.NoError(t, ioutil.WriteFile(file, nil, 0600))
+		_, err := Listen(UnixPrefix + file)
+		assert.Error(t, err)
+	})
+}
+
+func TestListen_Systemd(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+	udp, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer udp.Close()
+
+	// pass duplicates of both sockets at consecutive descriptors
+	tf, err := tcp.(*net.TCPListener).File()
+	require.NoError(t, err)
+	uf, err := udp.(*net.UDPConn).File()
+	require.NoError(t, err)
+	if int(uf.Fd()) != int(tf.Fd())+1 {
+		t.Skip("descriptors not consecutive")
+	}
+	listenFdsStart = int(tf.Fd())
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "2")
+	os.Setenv("LISTEN_FDNAMES", "signald.socket:turnd.socket")
+	once.Do(func() {})
+	inherited = inherit()
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+
+	ln, err := Listen(SystemdPrefix + "signald.socket")
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.Equal(t, tcp.Addr().String(), ln.Addr().String())
+
+	pc, err := ListenPacket("udp4", SystemdPrefix+"turnd.socket")
+	require.NoError(t, err)
+	defer pc.Close()
+	assert.Equal(t, udp.LocalAddr().String(), pc.LocalAddr().String())
+
+	_, err = Listen(SystemdPrefix + "signald.socket")
+	assert.Error(t, err, "sockets are passed once")
+	_, err = Listen(SystemdPrefix + "unknown")
+	assert.Error(t, err)
+}
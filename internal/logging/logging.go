@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+
+	"github.com/lx7/devnet/internal/rotate"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Formats of the log.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Outputs of the log.
+const (
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+// Config defines the format and output of the log.
+type Config struct {
+	// Format is "console" or "json". Defaults to console.
+	Format string
+
+	// Output is "stderr", "file" or "syslog". Defaults to stderr.
+	Output string
+
+	// File is the path of the log file. MaxSize is the file size in bytes
+	// that triggers a rotation. At most MaxFiles rotated files are kept.
+	File     string
+	MaxSize  int64 `mapstructure:"max_size"`
+	MaxFiles int   `mapstructure:"max_files"`
+
+	// Tag is the syslog tag. Defaults to the program name.
+	Tag string
+}
+
+var closer io.Closer
+
+// Configure replaces the global logger with one for the format and output
+// defined in conf and closes the output of the previous one. conf may be
+// nil for the defaults.
+func Configure(conf *viper.Viper, console zerolog.ConsoleWriter) error {
+	var c Config
+	if conf != nil {
+		if err := conf.Unmarshal(&c); err != nil {
+			return err
+		}
+	}
+	l, cl, err := New(c, console)
+	if err != nil {
+		return err
+	}
+	log.Logger = l
+	if closer != nil {
+		closer.Close()
+	}
+	closer = cl
+	return nil
+}
+
+// New returns a logger for the format and output in c and the closer of
+// the output. console defines the console format; its Out is replaced.
+func New(c Config, console zerolog.ConsoleWriter) (zerolog.Logger, io.Closer, error) {
+	var out io.Writer
+	var sys zerolog.LevelWriter
+	var closer io.Closer = nopCloser{}
+
+	switch c.Output {
+	case "", OutputStderr:
+		out = os.Stderr
+	case OutputFile:
+		if c.File == "" {
+			return zerolog.Logger{}, nil, fmt.Errorf("log file not configured")
+		}
+		w, err := rotate.Open(c.File, c.MaxSize, c.MaxFiles)
+		if err != nil {
+			return zerolog.Logger{}, nil, err
+		}
+		out, closer = w, w
+		console.NoColor = true
+	case OutputSyslog:
+		w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, c.Tag)
+		if err != nil {
+			return zerolog.Logger{}, nil, err
+		}
+		sys = zerolog.SyslogLevelWriter(w)
+		out, closer = sys, w
+	default:
+		return zerolog.Logger{}, nil, fmt.Errorf("unknown log output: %v", c.Output)
+	}
+
+	switch c.Format {
+	case "", FormatConsole:
+		if sys != nil {
+			out = syslogConsole{w: sys, console: console}
+		} else {
+			console.Out = out
+			out = console
+		}
+	case FormatJSON:
+	default:
+		closer.Close()
+		return zerolog.Logger{}, nil, fmt.Errorf("unknown log format: %v", c.Format)
+	}
+	return zerolog.New(out).With().Timestamp().Logger(), closer, nil
+}
+
+// syslogConsole writes events in console format at their level to syslog.
+// The timestamp is left to syslog.
+type syslogConsole struct {
+	w       zerolog.LevelWriter
+	console zerolog.ConsoleWriter
+}
+
+func (s syslogConsole) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s syslogConsole) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	var buf bytes.Buffer
+	cw := s.console
+	cw.Out = &buf
+	cw.NoColor = true
+	cw.PartsOrder = []string{
+		zerolog.LevelFieldName,
+		zerolog.CallerFieldName,
+		zerolog.MessageFieldName,
+	}
+	if _, err := cw.Write(p); err != nil {
+		return 0, err
+	}
+	if _, err := s.w.WriteLevel(l, bytes.TrimSpace(buf.Bytes())); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("json file", func(t *testing.T) {
+		path := filepath.Join(dir, "json.log")
+		l, c, err := New(Config{Format: FormatJSON, Output: OutputFile, File: path}, zerolog.ConsoleWriter{})
+		require.NoError(t, err)
+		l.Info().Str("user", "user1").Msg("test message")
+		require.NoError(t, c.Close())
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		var have map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &have))
+		assert.Equal(t, "info", have["level"])
+		assert.Equal(t, "user1", have["user"])
+		assert.Equal(t, "test message", have["message"])
+		assert.Contains(t, have, "time")
+	})
+
+	t.Run("console file", func(t *testing.T) {
+		path := filepath.Join(dir, "console.log")
+		l, c, err := New(Config{Output: OutputFile, File: path}, zerolog.ConsoleWriter{})
+		require.NoError(t, err)
+		l.Warn().Msg("test message")
+		require.NoError(t, c.Close())
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), "WRN test message")
+		assert.NotContains(t, string(b), "\x1b[", "file output without colors")
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		path := filepath.Join(dir, "rotate.log")
+		c := Config{Format: FormatJSON, Output: OutputFile, File: path, MaxSize: 100, MaxFiles: 1}
+		l, cl, err := New(c, zerolog.ConsoleWriter{})
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			l.Info().Msg(strings.Repeat("x", 50))
+		}
+		require.NoError(t, cl.Close())
+		_, err = os.Stat(path + ".1")
+		assert.NoError(t, err)
+		_, err = os.Stat(path + ".2")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("syslog", func(t *testing.T) {
+		_, c, err := New(Config{Output: OutputSyslog, Tag: "devnet-test"}, zerolog.ConsoleWriter{})
+		if err != nil {
+			t.Skipf("syslog unavailable: %v", err)
+		}
+		c.Close()
+	})
+
+	errs := []Config{
+		{Output: "remote"},
+		{Format: "xml"},
+		{Output: OutputFile},
+	}
+	for _, c := range errs {
+		_, _, err := New(c, zerolog.ConsoleWriter{})
+		assert.Error(t, err, "config: %+v", c)
+	}
+}
+
+func TestSyslogConsole(t *testing.T) {
+	w := &levelRecorder{}
+	l := zerolog.New(syslogConsole{w: w}).With().Timestamp().Logger()
+	l.Error().Str("user", "user1").Msg("test message")
+
+	assert.Equal(t, zerolog.ErrorLevel, w.level)
+	assert.Equal(t, "ERR test message user=user1", w.msg)
+}
+
+type levelRecorder struct {
+	level zerolog.Level
+	msg   string
+}
+
+func (r *levelRecorder) Write(p []byte) (int, error) {
+	return r.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (r *levelRecorder) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	r.level, r.msg = l, string(p)
+	return len(p), nil
+}
+
+func TestConfigure(t *testing.T) {
+	defer func(l zerolog.Logger) { log.Logger = l }(log.Logger)
+
+	dir, err := ioutil.TempDir("", "logging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "devnet.log")
+
+	conf := viper.New()
+	conf.Set("log.format", "json")
+	conf.Set("log.output", "file")
+	conf.Set("log.file", path)
+	require.NoError(t, Configure(conf.Sub("log"), zerolog.ConsoleWriter{}))
+	log.Info().Msg("configured")
+	require.NoError(t, Configure(nil, zerolog.ConsoleWriter{}))
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"message":"configured"`)
+
+	conf.Set("log.output", "remote")
+	assert.Error(t, Configure(conf.Sub("log"), zerolog.ConsoleWriter{}))
+}
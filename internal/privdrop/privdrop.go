@@ -0,0 +1,100 @@
+package privdrop
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// Config defines the user and group a daemon runs as after binding its
+// listeners and an optional directory to chroot to.
+type Config struct {
+	User string
+
+	// Group defaults to the primary group of User.
+	Group string
+
+	// Chroot requires User to be set.
+	Chroot string
+}
+
+// Drop changes the root directory and drops to the user and group in c.
+// The result is verified and any error leaves the process in an undefined
+// state, so callers must exit. Drop does nothing if c is empty.
+func Drop(c Config) error {
+	if c.User == "" {
+		if c.Group != "" || c.Chroot != "" {
+			return errors.New("user not configured")
+		}
+		return nil
+	}
+
+	uid, gid, err := lookup(c.User, c.Group)
+	if err != nil {
+		return err
+	}
+
+	if c.Chroot != "" {
+		if err := syscall.Chroot(c.Chroot); err != nil {
+			return fmt.Errorf("chroot %v: %v", c.Chroot, err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			return fmt.Errorf("chdir: %v", err)
+		}
+	}
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %v", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %v", err)
+	}
+	return verify(uid, gid)
+}
+
+// lookup returns the ids of name and group. group defaults to the primary
+// group of name.
+func lookup(name, group string) (int, int, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	gidStr := u.Gid
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return 0, 0, err
+		}
+		gidStr = g.Gid
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid %v: %v", u.Uid, err)
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gid %v: %v", gidStr, err)
+	}
+	return uid, gid, nil
+}
+
+// verify checks that the process runs as uid and gid and cannot regain
+// root privileges.
+func verify(uid, gid int) error {
+	if os.Getuid() != uid || os.Geteuid() != uid {
+		return fmt.Errorf("uid not changed to %v", uid)
+	}
+	if os.Getgid() != gid || os.Getegid() != gid {
+		return fmt.Errorf("gid not changed to %v", gid)
+	}
+	if uid != 0 && syscall.Setuid(0) == nil {
+		return errors.New("root privileges regained")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package privdrop
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrop_Config(t *testing.T) {
+	tests := []struct {
+		desc    string
+		give    Config
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+		},
+		{
+			desc:    "chroot without user",
+			give:    Config{Chroot: "/var/empty"},
+			wantErr: true,
+		},
+		{
+			desc:    "group without user",
+			give:    Config{Group: "nogroup"},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown user",
+			give:    Config{User: "devnet-unknown-user"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := Drop(tt.give)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestDrop runs the drop in a child process as it cannot be undone.
+func TestDrop(t *testing.T) {
+	if os.Getenv("PRIVDROP_CHILD") != "" {
+		dropChild()
+		return
+	}
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("user nobody not found")
+	}
+
+	dir, err := ioutil.TempDir("", "privdrop")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Chmod(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "marker"), nil, 0644))
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDrop$")
+	cmd.Env = append(os.Environ(), "PRIVDROP_CHILD="+dir)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "%s", out)
+	assert.Contains(t, string(out), "uid="+nobody.Uid+" ")
+	assert.Contains(t, string(out), "chroot=ok")
+}
+
+func dropChild() {
+	err := Drop(Config{User: "nobody", Chroot: os.Getenv("PRIVDROP_CHILD")})
+	if err != nil {
+		os.Stdout.WriteString("drop: " + err.Error() + "\n")
+		os.Exit(1)
+	}
+	chroot := "failed"
+	if _, err := os.Stat("/marker"); err == nil {
+		chroot = "ok"
+	}
+	os.Stdout.WriteString("uid=" + strconv.Itoa(os.Getuid()) + " chroot=" + chroot + "\n")
+}
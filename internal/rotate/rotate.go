@@ -0,0 +1,117 @@
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Writer implements an io.Writer on a file that is rotated when it exceeds
+// a maximum size. Rotated files are renamed to path.1, path.2 etc. with the
+// highest number being the oldest. Writer is safe for concurrent use.
+type Writer struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens or creates the file at path for appending. A maxSize <= 0
+// disables rotation. At most maxFiles rotated files are kept.
+func Open(path string, maxSize int64, maxFiles int) (*Writer, error) {
+	w := &Writer{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes p to the file. The file is rotated before the write if p
+// does not fit. A single write is never split between files.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the file, e.g. after it was moved by an
+// external log rotation tool.
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		w.file.Close()
+	}
+	return w.open()
+}
+
+// Close closes the file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = st.Size()
+	return nil
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	if w.maxFiles > 0 {
+		os.Remove(w.name(w.maxFiles))
+		for i := w.maxFiles - 1; i > 0; i-- {
+			os.Rename(w.name(i), w.name(i+1))
+		}
+		if err := os.Rename(w.path, w.name(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *Writer) name(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
@@ -0,0 +1,76 @@
+package rotate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	w, err := Open(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		_, err := w.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: path, want: "dddddd\n"},
+		{file: path + ".1", want: "cccccc\n"},
+		{file: path + ".2", want: "bbbbbb\n"},
+	}
+	for _, tt := range tests {
+		data, err := ioutil.ReadFile(tt.file)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, string(data), tt.file)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "oldest file should be removed")
+}
+
+func TestWriter_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("12345"), 0600))
+
+	w, err := Open(path, 8, 1)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("6789"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	data, err := ioutil.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "12345", string(data), "existing size should count")
+
+	_, err = w.Write([]byte("x"))
+	assert.Equal(t, os.ErrClosed, err)
+}
+
+func TestWriter_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+	w, err := Open(path, 0, 0)
+	require.NoError(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("old\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "moved.log")))
+	require.NoError(t, w.Reopen())
+	_, err = w.Write([]byte("new\n"))
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", string(data))
+}
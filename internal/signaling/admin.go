@@ -0,0 +1,137 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/justinas/alice"
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// AdminConfig defines the listener of the admin API.
+type AdminConfig struct {
+	Addr string
+
+	// Users lists the users allowed to access the admin API.
+	Users []string
+}
+
+func (s *Server) configureAdmin(conf *viper.Viper) {
+	var ac AdminConfig
+	if err := conf.UnmarshalKey("signaling.admin", &ac); err != nil {
+		log.Error().Err(err).Msg("unmarshal admin config")
+	}
+
+	s.admins = make(map[string]bool)
+	for _, u := range ac.Users {
+		s.admins[u] = true
+	}
+	s.admin = &http.Server{
+		Addr:    ac.Addr,
+		Handler: s.adminHandler(),
+	}
+}
+
+// adminHandler returns the http.Handler of the admin API.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/calls", s.serveCalls)
+	mux.HandleFunc("/invites", s.serveInvites)
+	mux.HandleFunc("/capture", s.serveCapture)
+	mux.HandleFunc("/notices", s.serveNotices)
+	mux.HandleFunc("/users", s.serveUsers)
+	mux.HandleFunc("/channels", s.serveChannels)
+	mux.HandleFunc("/members", s.serveMembers)
+	mux.HandleFunc("/history", s.serveHistory)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+
+	c := alice.New()
+	c = c.Append(hlog.NewHandler(log.Logger))
+	c = c.Append(hlog.AccessHandler(logRequest))
+	c = c.Append(s.proxies.Handler)
+	c = c.Append(hlog.RemoteAddrHandler("src"))
+	c = c.Append(s.certs.Handler)
+	c = c.Append(auth.BasicAuth)
+	c = c.Append(s.adminOnly)
+	return c.Then(mux)
+}
+
+// serveAdmin runs the admin API listener until shutdown.
+func (s *Server) serveAdmin() {
+	log.Info().
+		Str("addr", s.admin.Addr).
+		Msg("starting admin server")
+
+	var err error
+	if s.Server.TLSConfig != nil {
+		s.admin.TLSConfig = s.Server.TLSConfig
+		err = s.admin.ServeTLS(s.adminLn, "", "")
+	} else {
+		err = s.admin.Serve(s.adminLn)
+	}
+	if err != http.ErrServerClosed {
+		log.Error().Err(err).Msg("admin server")
+	}
+}
+
+// adminOnly restricts access to the configured admin users.
+func (s *Server) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user string
+		if id, ok := auth.IdentityFrom(r); ok && !id.Guest {
+			user = id.Name
+		}
+		if !s.admins[user] {
+			hlog.FromRequest(r).Warn().
+				Str("user", user).
+				Msg("admin access denied")
+			code := http.StatusForbidden
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveCalls returns the active and ended calls as JSON. The query
+// parameters user and since (RFC 3339) filter the results.
+func (s *Server) serveCalls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	if s.calls == nil {
+		http.Error(w, "call log disabled", http.StatusNotFound)
+		return
+	}
+
+	user := r.URL.Query().Get("user")
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	writeJSON(w, r, struct {
+		Active []CallRecord `json:"active"`
+		Ended  []CallRecord `json:"ended"`
+	}{
+		Active: s.calls.Active(user),
+		Ended:  s.calls.Ended(user, since),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("write response")
+	}
+}
@@ -0,0 +1,138 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/proto"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAdminTestServer(t *testing.T) *Server {
+	require.NoError(t, auth.Configure(conf.Sub("auth")))
+
+	c := viper.New()
+	for k, v := range conf.AllSettings() {
+		c.Set(k, v)
+	}
+	c.Set("signaling.calllog", map[string]interface{}{"recent": 10})
+	c.Set("signaling.invites", map[string]interface{}{"secret": "secret"})
+	c.Set("signaling.admin", map[string]interface{}{
+		"addr":  "127.0.0.1:0",
+		"users": []string{"testuser"},
+	})
+	return NewServer(c)
+}
+
+func TestAdmin_Access(t *testing.T) {
+	s := newAdminTestServer(t)
+	h := s.adminHandler()
+
+	tests := []struct {
+		desc     string
+		giveUser string
+		givePass string
+		want     int
+	}{
+		{
+			desc:     "admin",
+			giveUser: "testuser",
+			givePass: "test",
+			want:     http.StatusOK,
+		},
+		{
+			desc:     "no admin",
+			giveUser: "user1",
+			givePass: "test",
+			want:     http.StatusForbidden,
+		},
+		{
+			desc:     "wrong password",
+			giveUser: "testuser",
+			givePass: "wrong",
+			want:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/calls", nil)
+			req.SetBasicAuth(tt.giveUser, tt.givePass)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func TestAdmin_Calls(t *testing.T) {
+	s := newAdminTestServer(t)
+	h := s.adminHandler()
+
+	t0 := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	s.calls.Notify(callEvent(t0, "user1", "user2", proto.SDP_OFFER))
+	s.calls.Notify(&Event{Type: EventOffline, Time: t0.Add(time.Second), User: "user2"})
+	s.calls.Notify(callEvent(t0.Add(2*time.Second), "user1", "testuser", proto.SDP_OFFER))
+
+	tests := []struct {
+		desc       string
+		giveQuery  string
+		wantCode   int
+		wantActive int
+		wantEnded  int
+	}{
+		{
+			desc:       "all calls",
+			giveQuery:  "",
+			wantCode:   http.StatusOK,
+			wantActive: 1,
+			wantEnded:  1,
+		},
+		{
+			desc:       "user filter",
+			giveQuery:  "?user=user2",
+			wantCode:   http.StatusOK,
+			wantActive: 0,
+			wantEnded:  1,
+		},
+		{
+			desc:       "since filter",
+			giveQuery:  "?since=2020-12-01T10:00:05Z",
+			wantCode:   http.StatusOK,
+			wantActive: 1,
+			wantEnded:  0,
+		},
+		{
+			desc:      "invalid since",
+			giveQuery: "?since=yesterday",
+			wantCode:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/calls"+tt.giveQuery, nil)
+			req.SetBasicAuth("testuser", "test")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var have struct {
+				Active []CallRecord
+				Ended  []CallRecord
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&have))
+			assert.Len(t, have.Active, tt.wantActive)
+			assert.Len(t, have.Ended, tt.wantEnded)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package signaling
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+)
+
+// ringTimeout is the time after which an unanswered call is ended.
+const ringTimeout = time.Minute
+
+// Call end reasons.
+const (
+	EndHangup     = "hangup"
+	EndRejected   = "rejected"
+	EndOffline    = "offline"
+	EndReplaced   = "replaced"
+	EndUnanswered = "unanswered"
+)
+
+// Call describes a call between two users as observed in the signaling
+// frames received by the switch.
+type Call struct {
+	Caller string
+	Callee string
+	Start  time.Time
+	Answer time.Time
+	End    time.Time
+	Reason string
+
+	// Media lists the media types accepted in the answer, e.g. "audio",
+	// "video" or "application". Screen shares are sent as video and are
+	// listed in Shares as announced by the clients.
+	Media  []string
+	Shares []ScreenShare
+
+	offer string
+}
+
+// ScreenShare describes a screen share of User with the other party of a
+// call. End is zero while the share is active.
+type ScreenShare struct {
+	User  string
+	Start time.Time
+	End   time.Time
+}
+
+// Answered reports whether the callee has accepted the call.
+func (c *Call) Answered() bool {
+	return !c.Answer.IsZero()
+}
+
+// share starts or stops the screen share of user at t.
+func (c *Call) share(user string, active bool, t time.Time) {
+	for i := range c.Shares {
+		if c.Shares[i].User == user && c.Shares[i].End.IsZero() {
+			if !active {
+				c.Shares[i].End = t
+			}
+			return
+		}
+	}
+	if active {
+		c.Shares = append(c.Shares, ScreenShare{User: user, Start: t})
+	}
+}
+
+// callTracker derives calls from switch events. A call starts with an SDP
+// offer, is answered with an SDP answer and ends when one of the users
+// sends an SDP rollback to hang up, goes offline, a new offer is sent
+// between the users or the ring timeout expires. Screen shares are
+// announced by the clients with share frames during the call.
+//
+// In a cluster, a call is tracked by the node of the caller, which
+// receives the offer from a local client and the answer from the node of
+// the callee. It is not safe for concurrent use.
+type callTracker struct {
+	calls map[[2]string]*Call
+
+	// answered is called when a call is answered, ended when it ends
+	answered func(*Call)
+	ended    func(*Call)
+}
+
+func newCallTracker(answered, ended func(*Call)) *callTracker {
+	return &callTracker{
+		calls:    make(map[[2]string]*Call),
+		answered: answered,
+		ended:    ended,
+	}
+}
+
+// update applies e to the tracked calls.
+func (t *callTracker) update(e *Event) {
+	t.expire(e.Time)
+
+	switch e.Type {
+	case EventOffline, EventRemoteOffline:
+		for k, c := range t.calls {
+			if c.Caller == e.User || c.Callee == e.User {
+				t.end(k, e.Time, EndOffline)
+			}
+		}
+	case EventReceive:
+		// stored offers are reported to the callee as missed calls
+		if e.Frame.Queued != 0 {
+			return
+		}
+		k := callKey(e.Frame.Src, e.Frame.Dst)
+		switch pl := e.Frame.Payload.(type) {
+		case *proto.Frame_Sdp:
+			t.signal(k, e, pl.Sdp)
+		case *proto.Frame_Share:
+			if c, ok := t.calls[k]; ok && c.Answered() {
+				c.share(e.Frame.Src, pl.Share.Active, e.Time)
+			}
+		}
+	}
+}
+
+// signal applies the session description in e to the call k.
+func (t *callTracker) signal(k [2]string, e *Event, sdp *proto.SDP) {
+	switch sdp.Type {
+	case proto.SDP_OFFER:
+		if _, ok := t.calls[k]; ok {
+			t.end(k, e.Time, EndReplaced)
+		}
+		// the node of the caller tracks the call
+		if e.Remote {
+			return
+		}
+		t.calls[k] = &Call{
+			Caller: e.Frame.Src,
+			Callee: e.Frame.Dst,
+			Start:  e.Time,
+			offer:  sdp.Desc,
+		}
+	case proto.SDP_ANSWER:
+		c, ok := t.calls[k]
+		if !ok || c.Answered() || c.Callee != e.Frame.Src {
+			return
+		}
+		c.Answer = e.Time
+		c.Media = negotiatedMedia(c.offer, sdp.Desc)
+		if t.answered != nil {
+			t.answered(c)
+		}
+	case proto.SDP_ROLLBACK:
+		c, ok := t.calls[k]
+		if !ok {
+			return
+		}
+		if c.Answered() {
+			t.end(k, e.Time, EndHangup)
+		} else {
+			t.end(k, e.Time, EndRejected)
+		}
+	}
+}
+
+// expire ends unanswered calls after the ring timeout.
+func (t *callTracker) expire(now time.Time) {
+	for k, c := range t.calls {
+		if !c.Answered() && now.Sub(c.Start) > ringTimeout {
+			t.end(k, c.Start.Add(ringTimeout), EndUnanswered)
+		}
+	}
+}
+
+func (t *callTracker) end(k [2]string, now time.Time, reason string) {
+	c := t.calls[k]
+	delete(t.calls, k)
+	c.End = now
+	c.Reason = reason
+	for i := range c.Shares {
+		if c.Shares[i].End.IsZero() {
+			c.Shares[i].End = now
+		}
+	}
+	if t.ended != nil {
+		t.ended(c)
+	}
+}
+
+// callKey identifies the call between two users independent of direction.
+func callKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// active returns copies of all calls in progress.
+func (t *callTracker) active() []Call {
+	calls := make([]Call, 0, len(t.calls))
+	for _, c := range t.calls {
+		calls = append(calls, *c)
+	}
+	return calls
+}
+
+type mediaSection struct {
+	label  string
+	active bool
+}
+
+// negotiatedMedia returns the types of all media sections that are
+// accepted in the answer.
+func negotiatedMedia(offer, answer string) []string {
+	om, am := parseMedia(offer), parseMedia(answer)
+	var media []string
+	seen := make(map[string]bool)
+	for i, a := range am {
+		if i >= len(om) || !a.active || !om[i].active || seen[om[i].label] {
+			continue
+		}
+		seen[om[i].label] = true
+		media = append(media, om[i].label)
+	}
+	return media
+}
+
+// parseMedia returns the media sections of an SDP description labelled
+// with their media type.
+func parseMedia(desc string) []mediaSection {
+	var ms []mediaSection
+	for _, line := range strings.Split(desc, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "m="):
+			f := strings.Fields(line[2:])
+			m := mediaSection{}
+			if len(f) > 0 {
+				m.label = f[0]
+			}
+			m.active = len(f) > 1 && f[1] != "0"
+			ms = append(ms, m)
+		case len(ms) == 0:
+			continue
+		case line == "a=inactive":
+			ms[len(ms)-1].active = false
+		}
+	}
+	return ms
+}
@@ -0,0 +1,239 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func sdpEvent(t time.Time, src, dst string, typ proto.SDP_Type) *Event {
+	return &Event{
+		Type: EventForward,
+		Time: t,
+		User: dst,
+		Frame: &proto.Frame{
+			Src:     src,
+			Dst:     dst,
+			Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: typ}},
+		},
+	}
+}
+
+// callEvent returns the event of an SDP frame received by the switch.
+func callEvent(t time.Time, src, dst string, typ proto.SDP_Type) *Event {
+	e := sdpEvent(t, src, dst, typ)
+	e.Type = EventReceive
+	e.User = src
+	return e
+}
+
+// remoteEvent returns e as received from another node.
+func remoteEvent(e *Event) *Event {
+	e.Remote = true
+	return e
+}
+
+func shareEvent(t time.Time, src, dst string, active bool) *Event {
+	return &Event{
+		Type: EventReceive,
+		Time: t,
+		User: src,
+		Frame: &proto.Frame{
+			Src:     src,
+			Dst:     dst,
+			Payload: proto.PayloadWithShare(active),
+		},
+	}
+}
+
+func TestCallTracker(t *testing.T) {
+	t0 := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+
+	tests := []struct {
+		desc     string
+		give     []*Event
+		wantCall []Call
+	}{
+		{
+			desc: "answered call ends offline",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				callEvent(at(5), "user2", "user1", proto.SDP_ANSWER),
+				{Type: EventOffline, Time: at(60), User: "user2"},
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				Answer: at(5),
+				End:    at(60),
+				Reason: EndOffline,
+			}},
+		},
+		{
+			desc: "hangup",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				callEvent(at(5), "user2", "user1", proto.SDP_ANSWER),
+				callEvent(at(30), "user2", "user1", proto.SDP_ROLLBACK),
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				Answer: at(5),
+				End:    at(30),
+				Reason: EndHangup,
+			}},
+		},
+		{
+			desc: "rejected",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				callEvent(at(3), "user2", "user1", proto.SDP_ROLLBACK),
+				callEvent(at(4), "user1", "user2", proto.SDP_ROLLBACK),
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				End:    at(3),
+				Reason: EndRejected,
+			}},
+		},
+		{
+			desc: "replaced by new offer",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				callEvent(at(10), "user2", "user1", proto.SDP_OFFER),
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				End:    at(10),
+				Reason: EndReplaced,
+			}},
+		},
+		{
+			desc: "unanswered",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				{Type: EventOnline, Time: at(120), User: "user3"},
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				End:    at(0).Add(ringTimeout),
+				Reason: EndUnanswered,
+			}},
+		},
+		{
+			desc: "answer from caller ignored",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				callEvent(at(1), "user1", "user2", proto.SDP_ANSWER),
+				{Type: EventOffline, Time: at(2), User: "user1"},
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				End:    at(2),
+				Reason: EndOffline,
+			}},
+		},
+		{
+			desc: "screen shares",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				shareEvent(at(1), "user1", "user2", true),
+				callEvent(at(5), "user2", "user1", proto.SDP_ANSWER),
+				shareEvent(at(10), "user1", "user2", true),
+				shareEvent(at(20), "user1", "user2", false),
+				shareEvent(at(30), "user2", "user1", true),
+				callEvent(at(40), "user1", "user2", proto.SDP_ROLLBACK),
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				Answer: at(5),
+				End:    at(40),
+				Reason: EndHangup,
+				Shares: []ScreenShare{
+					{User: "user1", Start: at(10), End: at(20)},
+					{User: "user2", Start: at(30), End: at(40)},
+				},
+			}},
+		},
+		{
+			desc: "caller node",
+			give: []*Event{
+				callEvent(at(0), "user1", "user2", proto.SDP_OFFER),
+				remoteEvent(callEvent(at(5), "user2", "user1", proto.SDP_ANSWER)),
+				{Type: EventRemoteOffline, Time: at(60), User: "user2"},
+			},
+			wantCall: []Call{{
+				Caller: "user1",
+				Callee: "user2",
+				Start:  at(0),
+				Answer: at(5),
+				End:    at(60),
+				Reason: EndOffline,
+			}},
+		},
+		{
+			desc: "callee node",
+			give: []*Event{
+				remoteEvent(callEvent(at(0), "user1", "user2", proto.SDP_OFFER)),
+				callEvent(at(5), "user2", "user1", proto.SDP_ANSWER),
+				{Type: EventOffline, Time: at(60), User: "user2"},
+			},
+		},
+		{
+			desc: "stored offer",
+			give: []*Event{
+				{
+					Type: EventReceive,
+					Time: at(0),
+					User: "user1",
+					Frame: &proto.Frame{
+						Src:     "user1",
+						Dst:     "user2",
+						Queued:  at(0).Unix(),
+						Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_OFFER}},
+					},
+				},
+				{Type: EventOffline, Time: at(2), User: "user1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var answered int
+			var ended []Call
+			tr := newCallTracker(
+				func(c *Call) { answered++ },
+				func(c *Call) { ended = append(ended, *c) },
+			)
+			for _, e := range tt.give {
+				tr.update(e)
+			}
+
+			assert.Equal(t, tt.wantCall, ended)
+			want := 0
+			for _, c := range tt.wantCall {
+				if c.Answered() {
+					want++
+				}
+			}
+			assert.Equal(t, want, answered)
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package signaling
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CallLogConfig defines the call detail record file.
+type CallLogConfig struct {
+	// File is the path of the JSON lines file. Records are only kept in
+	// memory if it is empty.
+	File string
+
+	// MaxSize is the file size in bytes that triggers a rotation. At most
+	// MaxFiles rotated files are kept.
+	MaxSize  int64 `mapstructure:"max_size"`
+	MaxFiles int   `mapstructure:"max_files"`
+
+	// Recent is the number of records kept in memory for queries.
+	Recent int
+}
+
+// CallRecord is a call detail record.
+type CallRecord struct {
+	Caller string     `json:"caller"`
+	Callee string     `json:"callee"`
+	Start  time.Time  `json:"start"`
+	Answer *time.Time `json:"answer,omitempty"`
+	End    *time.Time `json:"end,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+	Media  []string   `json:"media,omitempty"`
+
+	Shares []ShareRecord `json:"shares,omitempty"`
+}
+
+// ShareRecord is a screen share of user with the other party of a call.
+type ShareRecord struct {
+	User  string     `json:"user"`
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+func newCallRecord(c *Call) CallRecord {
+	r := CallRecord{
+		Caller: c.Caller,
+		Callee: c.Callee,
+		Start:  c.Start,
+		Reason: c.Reason,
+		Media:  c.Media,
+	}
+	if c.Answered() {
+		t := c.Answer
+		r.Answer = &t
+	}
+	if !c.End.IsZero() {
+		t := c.End
+		r.End = &t
+	}
+	for _, sh := range c.Shares {
+		sr := ShareRecord{User: sh.User, Start: sh.Start}
+		if !sh.End.IsZero() {
+			t := sh.End
+			sr.End = &t
+		}
+		r.Shares = append(r.Shares, sr)
+	}
+	return r
+}
+
+// involves reports whether user is the caller or callee.
+func (r *CallRecord) involves(user string) bool {
+	return r.Caller == user || r.Callee == user
+}
+
+// CallLog implements an Observer that writes a call detail record as a JSON
+// line for every ended call and keeps the most recent records for queries.
+type CallLog struct {
+	mu     sync.Mutex
+	queue  *writeQueue
+	calls  *callTracker
+	recent []CallRecord
+	size   int
+}
+
+// NewCallLog returns a new CallLog instance writing to w and keeping size
+// records in memory. w may be nil. Records are written from a separate
+// goroutine and discarded if they cannot be written fast enough.
+func NewCallLog(w io.Writer, size int) *CallLog {
+	l := &CallLog{size: size}
+	if w != nil {
+		l.queue = newWriteQueue(w, "call log")
+	}
+	l.calls = newCallTracker(nil, l.ended)
+	return l
+}
+
+// Close writes all queued records and stops writing. Notify must not be
+// called after Close.
+func (l *CallLog) Close() {
+	if l.queue != nil {
+		l.queue.Close()
+	}
+}
+
+// Notify implements the Observer interface.
+func (l *CallLog) Notify(e *Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls.update(e)
+}
+
+// Active returns the records of all calls in progress involving user. All
+// calls are returned if user is empty.
+func (l *CallLog) Active(user string) []CallRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := []CallRecord{}
+	for _, c := range l.calls.active() {
+		r := newCallRecord(&c)
+		if user == "" || r.involves(user) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// Ended returns the records of ended calls since the given time involving
+// user, oldest first. All calls are returned if user is empty.
+func (l *CallLog) Ended(user string, since time.Time) []CallRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := []CallRecord{}
+	for _, r := range l.recent {
+		if r.End.Before(since) {
+			continue
+		}
+		if user == "" || r.involves(user) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// ended is called by the tracker with the lock held.
+func (l *CallLog) ended(c *Call) {
+	r := newCallRecord(c)
+	if l.size > 0 {
+		if len(l.recent) >= l.size {
+			l.recent = append(l.recent[:0], l.recent[1:]...)
+		}
+		l.recent = append(l.recent, r)
+	}
+
+	if l.queue == nil {
+		return
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Error().Err(err).Msg("marshal call record")
+		return
+	}
+	l.queue.Write(append(data, '\n'))
+}
@@ -0,0 +1,127 @@
+package signaling
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOffer = `v=0
+o=- 1 2 IN IP4 0.0.0.0
+s=-
+t=0 0
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=msid:devnet audio
+a=sendrecv
+m=video 9 UDP/TLS/RTP/SAVPF 102
+a=msid:devnet video
+a=sendrecv
+m=video 9 UDP/TLS/RTP/SAVPF 102
+a=msid:devnet screen
+a=sendrecv
+`
+
+const testAnswer = `v=0
+o=- 3 4 IN IP4 0.0.0.0
+s=-
+t=0 0
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=msid:devnet audio
+a=sendrecv
+m=video 0 UDP/TLS/RTP/SAVPF 102
+a=inactive
+m=video 9 UDP/TLS/RTP/SAVPF 102
+a=msid:devnet screen
+a=recvonly
+`
+
+func TestCallLog_NegotiatedMedia(t *testing.T) {
+	tests := []struct {
+		desc       string
+		giveOffer  string
+		giveAnswer string
+		wantMedia  []string
+	}{
+		{
+			desc:       "rejected section",
+			giveOffer:  testOffer,
+			giveAnswer: testAnswer,
+			wantMedia:  []string{"audio", "video"},
+		},
+		{
+			desc:       "data channel",
+			giveOffer:  "m=audio 9 RTP/AVP 0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n",
+			giveAnswer: "m=audio 9 RTP/AVP 0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n",
+			wantMedia:  []string{"audio", "application"},
+		},
+		{
+			desc:       "empty answer",
+			giveOffer:  testOffer,
+			giveAnswer: "",
+			wantMedia:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.wantMedia, negotiatedMedia(tt.giveOffer, tt.giveAnswer))
+		})
+	}
+}
+
+func TestCallLog(t *testing.T) {
+	t0 := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	sdp := func(s int, src, dst string, typ proto.SDP_Type, desc string) *Event {
+		e := callEvent(t0.Add(time.Duration(s)*time.Second), src, dst, typ)
+		e.Frame.GetSdp().Desc = desc
+		return e
+	}
+
+	buf := &bytes.Buffer{}
+	l := NewCallLog(buf, 2)
+	l.Notify(sdp(0, "user1", "user2", proto.SDP_OFFER, testOffer))
+	l.Notify(sdp(1, "user2", "user1", proto.SDP_ANSWER, testAnswer))
+	l.Notify(sdp(2, "user3", "user1", proto.SDP_OFFER, testOffer))
+
+	active := l.Active("user2")
+	require.Len(t, active, 1)
+	assert.Equal(t, "user1", active[0].Caller)
+	assert.Nil(t, active[0].End)
+	assert.Len(t, l.Active(""), 2)
+	assert.Empty(t, l.Ended("", time.Time{}))
+
+	l.Notify(&Event{Type: EventOffline, Time: t0.Add(time.Minute), User: "user1"})
+	assert.Empty(t, l.Active(""))
+
+	ended := l.Ended("user2", time.Time{})
+	require.Len(t, ended, 1)
+	assert.Equal(t, EndOffline, ended[0].Reason)
+	assert.Equal(t, []string{"audio", "video"}, ended[0].Media)
+	assert.Len(t, l.Ended("", time.Time{}), 2)
+	assert.Empty(t, l.Ended("", t0.Add(2*time.Minute)))
+
+	// one JSON line per ended call, written on close at the latest
+	l.Close()
+	dec := json.NewDecoder(buf)
+	var records []CallRecord
+	for dec.More() {
+		var r CallRecord
+		require.NoError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+	require.Len(t, records, 2)
+	for _, r := range records {
+		switch r.Caller {
+		case "user1":
+			require.NotNil(t, r.Answer)
+			assert.True(t, t0.Add(time.Second).Equal(*r.Answer))
+		case "user3":
+			assert.Nil(t, r.Answer, "unanswered call")
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package signaling
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/internal/rotate"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// CaptureConfig defines the capture of forwarded frames.
+type CaptureConfig struct {
+	// File is the path of the capture file.
+	File string
+
+	// MaxSize is the file size in bytes that triggers a rotation. At most
+	// MaxFiles rotated files are kept.
+	MaxSize  int64 `mapstructure:"max_size"`
+	MaxFiles int   `mapstructure:"max_files"`
+
+	// Users restricts the capture to frames from or to the listed users.
+	// All frames are captured if it is empty.
+	Users []string
+}
+
+// Capture implements an Observer that writes all forwarded frames with
+// their time to a capture. Records are written from a separate goroutine
+// and discarded if they cannot be written fast enough.
+type Capture struct {
+	mu    sync.RWMutex
+	w     *capture.Writer
+	queue *writeQueue
+	users map[string]bool
+}
+
+// NewCapture returns a new Capture instance writing to w. Only frames from
+// or to users are captured unless users is empty.
+func NewCapture(w io.Writer, users []string) *Capture {
+	q := newWriteQueue(w, "capture")
+	c := &Capture{w: capture.NewWriter(q), queue: q}
+	c.SetUsers(users)
+	return c
+}
+
+// Close writes all queued records and stops capturing. Notify must not be
+// called after Close.
+func (c *Capture) Close() {
+	c.queue.Close()
+}
+
+// SetUsers replaces the users whose frames are captured. All frames are
+// captured if users is empty.
+func (c *Capture) SetUsers(users []string) {
+	m := make(map[string]bool)
+	for _, u := range users {
+		m[u] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users = m
+}
+
+// Users returns the users whose frames are captured, ordered by name.
+func (c *Capture) Users() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	users := make([]string, 0, len(c.users))
+	for u := range c.users {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Notify implements the Observer interface.
+func (c *Capture) Notify(e *Event) {
+	if e.Type != EventForward || !c.captures(e.Frame) {
+		return
+	}
+	err := c.w.Write(&capture.Record{Time: e.Time, Frame: e.Frame})
+	if err != nil {
+		log.Error().Err(err).Msg("write capture")
+	}
+}
+
+func (c *Capture) captures(f *proto.Frame) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.users) == 0 || c.users[f.Src] || c.users[f.Dst]
+}
+
+// openCapture captures forwarded frames as defined in conf.
+func (s *Server) openCapture(conf *viper.Viper) {
+	var cc CaptureConfig
+	if err := conf.UnmarshalKey("signaling.capture", &cc); err != nil {
+		log.Error().Err(err).Msg("unmarshal capture config")
+	}
+	if cc.File == "" {
+		log.Error().Msg("capture file missing, capture disabled")
+		return
+	}
+
+	w, err := rotate.Open(cc.File, cc.MaxSize, cc.MaxFiles)
+	if err != nil {
+		log.Fatal().Err(err).Str("file", cc.File).Msg("open capture")
+	}
+	s.capfile = w
+	s.capture = NewCapture(w, cc.Users)
+	s.local.Observe(s.capture)
+	log.Warn().
+		Str("file", cc.File).
+		Strs("users", cc.Users).
+		Msg("capturing signaling frames")
+}
+
+// serveCapture returns the captured users as JSON. POST requests replace
+// them with the users in the JSON request body.
+func (s *Server) serveCapture(w http.ResponseWriter, r *http.Request) {
+	if s.capture == nil {
+		http.Error(w, "capture disabled", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Users []string `json:"users"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		s.capture.SetUsers(req.Users)
+		log.Info().Strs("users", req.Users).Msg("capture users changed")
+	default:
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	req.Users = s.capture.Users()
+	writeJSON(w, r, req)
+}
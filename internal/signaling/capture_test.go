@@ -0,0 +1,130 @@
+package signaling
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture_Notify(t *testing.T) {
+	t0 := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	events := []*Event{
+		sdpEvent(t0, "user1", "user2", proto.SDP_OFFER),
+		sdpEvent(t0.Add(time.Second), "user2", "user1", proto.SDP_ANSWER),
+		sdpEvent(t0.Add(2*time.Second), "user2", "testuser", proto.SDP_OFFER),
+		{Type: EventOnline, Time: t0, User: "user1"},
+	}
+
+	tests := []struct {
+		desc      string
+		giveUsers []string
+		wantSrc   []string
+	}{
+		{
+			desc:    "all users",
+			wantSrc: []string{"user1", "user2", "user2"},
+		},
+		{
+			desc:      "selected user",
+			giveUsers: []string{"user1"},
+			wantSrc:   []string{"user1", "user2"},
+		},
+		{
+			desc:      "unknown user",
+			giveUsers: []string{"unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := NewCapture(&buf, tt.giveUsers)
+			for _, e := range events {
+				c.Notify(e)
+			}
+			c.Close()
+
+			records, err := capture.ReadAll(&buf)
+			require.NoError(t, err)
+			var src []string
+			for _, r := range records {
+				src = append(src, r.Frame.Src)
+			}
+			assert.Equal(t, tt.wantSrc, src)
+		})
+	}
+}
+
+func TestAdmin_Capture(t *testing.T) {
+	s := newAdminTestServer(t)
+	h := s.adminHandler()
+
+	req := httptest.NewRequest("GET", "/capture", nil)
+	req.SetBasicAuth("testuser", "test")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	s.capture = NewCapture(&bytes.Buffer{}, []string{"user1"})
+
+	tests := []struct {
+		desc     string
+		giveMeth string
+		giveBody string
+		wantCode int
+		wantBody string
+	}{
+		{
+			desc:     "get users",
+			giveMeth: "GET",
+			wantCode: http.StatusOK,
+			wantBody: `{"users":["user1"]}`,
+		},
+		{
+			desc:     "set users",
+			giveMeth: "POST",
+			giveBody: `{"users":["user2","testuser"]}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"users":["testuser","user2"]}`,
+		},
+		{
+			desc:     "capture all",
+			giveMeth: "POST",
+			giveBody: `{"users":[]}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"users":[]}`,
+		},
+		{
+			desc:     "invalid body",
+			giveMeth: "POST",
+			giveBody: `users`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			desc:     "invalid method",
+			giveMeth: "DELETE",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tt.giveMeth, "/capture", strings.NewReader(tt.giveBody))
+			req.SetBasicAuth("testuser", "test")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package signaling
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// ClientCertConfig defines the authentication of users by TLS client
+// certificates. It requires TLS to be enabled.
+type ClientCertConfig struct {
+	// CA is the file with the certificates of the accepted issuers.
+	CA string
+
+	// User selects the certificate field holding the user name: "cn" for
+	// the subject common name, "email" or "dns" for the first subject
+	// alternative name of that type.
+	User string
+
+	// Required rejects connections without a valid client certificate.
+	// Otherwise, users without certificate fall back to basic auth.
+	Required bool
+}
+
+func (s *Server) configureClientCerts(conf *viper.Viper) {
+	var cc ClientCertConfig
+	if err := conf.UnmarshalKey("signaling.client_certs", &cc); err != nil {
+		log.Error().Err(err).Msg("unmarshal client certificate config")
+	}
+	if !conf.GetBool("signaling.tls") {
+		log.Error().Msg("client certificates require tls, disabled")
+		return
+	}
+
+	a, err := auth.NewCertAuth(cc.User)
+	if err != nil {
+		log.Fatal().Err(err).Msg("client certificate auth")
+	}
+	ca, err := ioutil.ReadFile(cc.CA)
+	if err != nil {
+		log.Fatal().Err(err).Str("file", cc.CA).Msg("read client ca")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		log.Fatal().Str("file", cc.CA).Msg("no client ca certificates found")
+	}
+
+	s.certs = a
+	s.clientCAs = pool
+	s.clientAuth = tls.VerifyClientCertIfGiven
+	if cc.Required {
+		s.clientAuth = tls.RequireAndVerifyClientCert
+	}
+}
+
+// tlsConfig returns the TLS configuration of the signaling and admin
+// servers.
+func (s *Server) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: s.cert.get,
+		ClientCAs:      s.clientCAs,
+		ClientAuth:     s.clientAuth,
+	}
+}
@@ -0,0 +1,146 @@
+package signaling
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ClientCerts(t *testing.T) {
+	require.NoError(t, auth.Configure(conf.Sub("auth")))
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	srvCrt, srvKey := ca.issue(t, dir, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+	})
+	clientCert := func(name string) tls.Certificate {
+		crt, key := ca.issue(t, dir, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		c, err := tls.LoadX509KeyPair(crt, key)
+		require.NoError(t, err)
+		return c
+	}
+	user := clientCert("testuser")
+	unknown := clientCert("unknown")
+
+	// newServer serves the identity of authenticated requests
+	newServer := func(t *testing.T, required bool) string {
+		v := viper.New()
+		v.Set("signaling.tls", true)
+		v.Set("signaling.client_certs", map[string]interface{}{
+			"ca":       ca.file,
+			"user":     "cn",
+			"required": required,
+		})
+		s := &Server{}
+		require.NoError(t, s.cert.load(srvCrt, srvKey))
+		s.configureClientCerts(v)
+
+		h := s.certs.Handler(auth.BasicAuth(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				id, _ := auth.IdentityFrom(r)
+				fmt.Fprint(w, id.Name)
+			},
+		)))
+		ts := httptest.NewUnstartedServer(h)
+		ts.Listener = tls.NewListener(ts.Listener, s.tlsConfig())
+		ts.Start()
+		t.Cleanup(ts.Close)
+		return "https" + strings.TrimPrefix(ts.URL, "http")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.crt)
+	get := func(url string, crt *tls.Certificate, basic bool) (*http.Response, error) {
+		tc := &tls.Config{RootCAs: pool}
+		if crt != nil {
+			tc.Certificates = []tls.Certificate{*crt}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		if basic {
+			req.SetBasicAuth("testuser", "test")
+		}
+		return client.Do(req)
+	}
+
+	tests := []struct {
+		desc         string
+		giveRequired bool
+		giveCert     *tls.Certificate
+		giveBasic    bool
+		wantCode     int
+		wantBody     string
+		wantErr      bool
+	}{
+		{
+			desc:     "certificate",
+			giveCert: &user,
+			wantCode: http.StatusOK,
+			wantBody: "testuser",
+		},
+		{
+			desc:     "unknown user",
+			giveCert: &unknown,
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Unauthorized\n",
+		},
+		{
+			desc:      "basic auth fallback",
+			giveBasic: true,
+			wantCode:  http.StatusOK,
+			wantBody:  "testuser",
+		},
+		{
+			desc:     "no credentials",
+			wantCode: http.StatusUnauthorized,
+			wantBody: "Unauthorized\n",
+		},
+		{
+			desc:         "certificate required",
+			giveRequired: true,
+			giveCert:     &user,
+			wantCode:     http.StatusOK,
+			wantBody:     "testuser",
+		},
+		{
+			desc:         "certificate missing",
+			giveRequired: true,
+			giveBasic:    true,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			url := newServer(t, tt.giveRequired)
+			res, err := get(url, tt.giveCert, tt.giveBasic)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
@@ -1,15 +1,40 @@
 package signaling
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/lx7/devnet/internal/auth"
 	"github.com/lx7/devnet/proto"
 	"github.com/spf13/viper"
+	pb "google.golang.org/protobuf/proto"
 
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	closeTimeout  = time.Second
+	writeTimeout  = 10 * time.Second
+	resumeTimeout = 30 * time.Second
+	replaySize    = 64
+)
+
+// Version is the software version announced to clients. It is set at build
+// time.
+var Version = "dev"
+
+// features lists the optional protocol features offered to clients.
+var features = []string{
+	proto.FeatureAck,
+	proto.FeatureResume,
+	proto.FeatureModeration,
+	proto.FeatureNotice,
+}
+
 // Client defines the client connection handler and attaches to a switch.
 type Client interface {
 	Attach(Switch)
@@ -17,32 +42,83 @@ type Client interface {
 	Name() string
 }
 
+// Conn is the connection of a DefaultClient. It is implemented by
+// websocket connections and by event streams for clients that cannot
+// establish a websocket connection.
+type Conn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetWriteDeadline(t time.Time) error
+	Subprotocol() string
+	Close() error
+}
+
 // DefaultClient implements the Client interface on a websocket connection.
+// The client stays attached to the switch for resumeTimeout after the
+// connection was lost and can be resumed on a new connection.
 type DefaultClient struct {
-	name string
-	sw   Switch
-	conn *websocket.Conn
+	sync.Mutex
+	name   string
+	id     *auth.Identity
+	token  string
+	sw     Switch
+	conn   Conn
+	codec  proto.Codec
+	limits *Limits
+
+	// hello is the handshake of the client, nil for legacy clients
+	hello    *proto.Hello
+	minProto uint32
+
+	sent    []*proto.Frame
+	inSeq   uint64
+	outSeq  uint64
+	resumed chan bool
+	done    bool
+	code    int
+	reason  string
 
 	send chan *proto.Frame
+	stop chan bool
 }
 
 // NewClient returns a new Client instance.
-func NewClient(conn *websocket.Conn, name string) *DefaultClient {
+func NewClient(conn Conn, name string) *DefaultClient {
 	c := &DefaultClient{
-		name: name,
-		conn: conn,
+		name:  name,
+		token: newToken(),
+		conn:  conn,
+		codec: proto.CodecFor(conn.Subprotocol()),
 
-		send: make(chan *proto.Frame, 64),
+		resumed: make(chan bool, 1),
+		send:    make(chan *proto.Frame, 64),
+		stop:    make(chan bool),
 	}
 	return c
 }
 
 // Configure sends configuration data for ICE servers etc. to the client.
-func (c *DefaultClient) Configure(conf *viper.Viper) error {
+// The ICE server urls in ice are sent ahead of the configured ones.
+func (c *DefaultClient) Configure(conf *viper.Viper, ice ...string) error {
 	var cc *proto.Config
 	if err := conf.UnmarshalExact(&cc); err != nil {
 		return err
 	}
+	if len(ice) > 0 {
+		if cc == nil {
+			cc = &proto.Config{}
+		}
+		if cc.Webrtc == nil {
+			cc.Webrtc = &proto.Config_WebRTC{}
+		}
+		servers := make([]*proto.Config_WebRTC_ICEServer, 0, len(ice))
+		for _, url := range ice {
+			servers = append(servers, &proto.Config_WebRTC_ICEServer{Url: url})
+		}
+		cc.Webrtc.Iceservers = append(servers, cc.Webrtc.Iceservers...)
+	}
 
 	frame := &proto.Frame{
 		Dst:     c.name,
@@ -53,24 +129,94 @@ func (c *DefaultClient) Configure(conf *viper.Viper) error {
 	return nil
 }
 
+// SetLimits restricts the size and rate of frames received from the client.
+// It must be called before the client is attached to a switch.
+func (c *DefaultClient) SetLimits(l *Limits) {
+	c.limits = l
+}
+
+// SetMinProtocol requires the client to send a hello with protocol version
+// v or newer before any other frame. Legacy clients without hello are
+// accepted if v is 0. It must be called before the client is attached to a
+// switch.
+func (c *DefaultClient) SetMinProtocol(v uint32) {
+	c.minProto = v
+}
+
 // Attach connects to a switch and starts message processing. Returns on
-// connection close.
+// connection close or when the session was not resumed in time.
 func (c *DefaultClient) Attach(sw Switch) {
 	c.sw = sw
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		c.readPump()
-		wg.Done()
-	}()
+	c.Lock()
+	c.handshake()
+	c.Unlock()
 
-	wg.Add(1)
+	done := make(chan bool)
 	go func() {
 		c.writePump()
-		wg.Done()
+		close(done)
 	}()
-	wg.Wait()
+
+	lim := newLimiter(c.limits)
+	for c.readPump(lim) && c.await() {
+		log.Info().Str("user", c.name).Msg("client session resumed")
+	}
+	log.Trace().Str("user", c.name).Msg("client read pump done")
+	c.sw.Unregister(c)
+	<-done
+}
+
+// Resume continues the session on conn. The server side of the session
+// is synchronized by replaying all frames after seq. Returns false if the
+// session has already expired.
+func (c *DefaultClient) Resume(conn Conn, seq uint64) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.done {
+		return false
+	}
+
+	// take over from a connection that has not been detected as lost yet
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = conn
+	c.codec = proto.CodecFor(conn.Subprotocol())
+	c.handshake()
+	for _, f := range c.sent {
+		if f.Seq > seq {
+			c.write(f)
+		}
+	}
+
+	select {
+	case c.resumed <- true:
+	default:
+	}
+	return true
+}
+
+// SetIdentity sets the authenticated identity of the client. Guest
+// restrictions of the identity are enforced by the switch.
+func (c *DefaultClient) SetIdentity(id *auth.Identity) {
+	c.id = id
+}
+
+// Identity returns the identity set by SetIdentity or nil.
+func (c *DefaultClient) Identity() *auth.Identity {
+	return c.id
+}
+
+// Disconnect ends the session. The connection is closed with code and
+// reason once the switch has unregistered the client and all pending frames
+// are sent.
+func (c *DefaultClient) Disconnect(code int, reason string) {
+	c.Lock()
+	defer c.Unlock()
+	c.done = true
+	c.code = code
+	c.reason = reason
 }
 
 // Name returns the client name.
@@ -78,49 +224,318 @@ func (c *DefaultClient) Name() string {
 	return c.name
 }
 
+// Token returns the token required to resume the session.
+func (c *DefaultClient) Token() string {
+	return c.token
+}
+
 // Send sends a message through the network connection.
 func (c *DefaultClient) Send() chan<- *proto.Frame {
 	return c.send
 }
 
-func (c *DefaultClient) readPump() {
+// readPump processes frames received on the current connection. Returns
+// true if the connection was lost and the session may be resumed.
+func (c *DefaultClient) readPump(lim *limiter) bool {
+	c.Lock()
+	conn, codec := c.conn, c.codec
+	c.Unlock()
+
 	defer func() {
-		c.conn.Close()
+		conn.Close()
+		c.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.Unlock()
 	}()
+
+	if c.limits != nil && c.limits.FrameSize > 0 {
+		conn.SetReadLimit(c.limits.FrameSize)
+	}
+	welcomed := false
 	for {
-		_, data, err := c.conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
-			if !websocket.IsCloseError(err,
+			c.Lock()
+			done := c.done
+			c.Unlock()
+			if done {
+				return false
+			}
+			// oversize frames are not resumable, the connection has been
+			// closed with CloseMessageTooBig
+			if err == websocket.ErrReadLimit {
+				log.Warn().Str("user", c.name).Msg("frame size exceeded, disconnecting")
+				return false
+			}
+			if websocket.IsCloseError(err,
 				websocket.CloseNormalClosure,
-				websocket.CloseAbnormalClosure,
+				websocket.CloseGoingAway,
 			) {
+				return false
+			}
+			if !websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
 				log.Warn().Str("user", c.name).Err(err).Msg("read message")
 			}
-			break
+			return true
 		}
 
 		f := &proto.Frame{}
-		if err := f.Unmarshal(data); err != nil {
+		if err := codec.Unmarshal(data, f); err != nil {
 			log.Warn().Str("user", c.name).Err(err).Msg("unmarshal message")
 			continue
 		}
 
-		c.sw.Forward() <- f
+		// resume frames are only sent by the server
+		if _, ok := f.Payload.(*proto.Frame_Resume); ok {
+			continue
+		}
+
+		if !lim.allow(f) {
+			log.Warn().
+				Str("user", c.name).
+				Str("type", payloadType(f)).
+				Msg("rate limit exceeded, discarding message")
+			if lim.abusive() {
+				log.Warn().Str("user", c.name).Msg("client abuse, disconnecting")
+				c.abort(conn, f, proto.Error_RATE_LIMITED, "rate limit exceeded")
+				return false
+			}
+			c.reply(f, proto.Error_RATE_LIMITED, "rate limit exceeded")
+			continue
+		}
+
+		// hello frames without destination are addressed to the server,
+		// once per connection
+		if h := f.GetHello(); h != nil && f.Dst == "" {
+			if welcomed {
+				c.reply(f, proto.Error_FORBIDDEN, "hello already received")
+				continue
+			}
+			welcomed = true
+			if !c.greet(conn, h) {
+				return false
+			}
+			continue
+		}
+		if !c.greeted() {
+			c.incompatible(conn, "hello required")
+			return false
+		}
+
+		if f.Seq != 0 {
+			c.Lock()
+			dup := f.Seq <= c.inSeq
+			if !dup {
+				c.inSeq = f.Seq
+			}
+			c.Unlock()
+			if dup {
+				log.Debug().Str("user", c.name).Msg("duplicate, discarding message")
+				continue
+			}
+		}
+
+		if f.Src != c.name {
+			log.Warn().
+				Str("user", c.name).
+				Str("src", f.Src).
+				Msg("sender mismatch, discarding message")
+			c.reply(f, proto.Error_FORBIDDEN, "sender mismatch")
+			continue
+		}
+
+		switch f.Payload.(type) {
+		case *proto.Frame_Error, *proto.Frame_Ack, *proto.Frame_Notice:
+			c.reply(f, proto.Error_FORBIDDEN, "payload type not allowed")
+			continue
+		}
+
+		if !c.forward(f) {
+			return false
+		}
 	}
-	log.Trace().Str("user", c.name).Msg("client read pump done")
-	c.sw.Unregister(c)
+}
+
+// forward passes f to the switch. Returns false if the client has been
+// unregistered.
+func (c *DefaultClient) forward(f *proto.Frame) bool {
+	select {
+	case c.sw.Forward() <- f:
+		return true
+	case <-c.stop:
+		return false
+	}
+}
+
+// await waits for the session to be resumed. Returns false on timeout.
+func (c *DefaultClient) await() bool {
+	log.Info().Str("user", c.name).Msg("connection lost, awaiting resume")
+	select {
+	case <-c.resumed:
+		return true
+	case <-c.stop:
+	case <-time.After(resumeTimeout):
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	select {
+	case <-c.resumed:
+		return true
+	default:
+	}
+	c.done = true
+	return false
+}
+
+// reply sends an error in response to f back to the client.
+func (c *DefaultClient) reply(f *proto.Frame, code proto.Error_Code, msg string) {
+	r := errorReply(f, code, msg)
+	r.Dst = c.name
+	c.forward(r)
+}
+
+// greet answers the hello of the client with the features supported by
+// both sides. Clients with a newer protocol version are expected to fall
+// back to the version in the answer. Returns false if the protocol version
+// of the client is not supported and the connection was closed.
+func (c *DefaultClient) greet(conn Conn, h *proto.Hello) bool {
+	if h.Protocol < c.minProto {
+		c.incompatible(conn, fmt.Sprintf(
+			"protocol version %d not supported, minimum is %d",
+			h.Protocol, c.minProto,
+		))
+		return false
+	}
+	log.Info().
+		Str("user", c.name).
+		Uint32("protocol", h.Protocol).
+		Str("version", h.Version).
+		Str("device", h.Device).
+		Strs("features", h.Features).
+		Msg("client hello")
+
+	c.Lock()
+	defer c.Unlock()
+	c.hello = h
+	c.write(&proto.Frame{Dst: c.name, Payload: h.Welcome(Version, features)})
+	return true
+}
+
+// greeted reports whether the client may send frames. Hello is required
+// if a minimum protocol version is set.
+func (c *DefaultClient) greeted() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.minProto == 0 || c.hello != nil
+}
+
+// incompatible rejects the client with an error frame and closes conn.
+func (c *DefaultClient) incompatible(conn Conn, msg string) {
+	log.Warn().Str("user", c.name).Str("reason", msg).Msg("incompatible client, disconnecting")
+	c.Lock()
+	c.write(&proto.Frame{
+		Dst:     c.name,
+		Payload: proto.PayloadWithError(proto.Error_INCOMPATIBLE, msg, 0),
+	})
+	c.Unlock()
+	closeWith(conn, proto.CloseIncompatible, msg)
+}
+
+// abort sends an error in response to f directly on conn and closes it
+// as policy violation.
+func (c *DefaultClient) abort(conn Conn, f *proto.Frame, code proto.Error_Code, msg string) {
+	c.Lock()
+	c.write(&proto.Frame{
+		Dst:     c.name,
+		Payload: proto.PayloadWithError(code, msg, f.Id),
+	})
+	c.Unlock()
+	closeWith(conn, websocket.ClosePolicyViolation, msg)
+}
+
+// handshake sends the session token and the sequence number of the last
+// received frame. The caller must hold the lock.
+func (c *DefaultClient) handshake() {
+	c.write(&proto.Frame{
+		Dst: c.name,
+		Payload: &proto.Frame_Resume{Resume: &proto.Resume{
+			Token: c.token,
+			Seq:   c.inSeq,
+		}},
+	})
 }
 
 func (c *DefaultClient) writePump() {
 	for f := range c.send {
-		data, err := f.Marshal()
-		if err != nil {
-			log.Warn().Str("user", c.name).Err(err).Msg("marshal message")
-		}
+		// frames may be shared between clients on broadcast
+		f = pb.Clone(f).(*proto.Frame)
 
-		err = c.conn.WriteMessage(websocket.BinaryMessage, data)
-		if err != nil {
-			log.Warn().Str("user", c.name).Err(err).Msg("write message")
+		c.Lock()
+		c.outSeq++
+		f.Seq = c.outSeq
+		c.sent = append(c.sent, f)
+		if len(c.sent) > replaySize {
+			c.sent = append(c.sent[:0], c.sent[1:]...)
 		}
+		c.write(f)
+		c.Unlock()
+	}
+
+	close(c.stop)
+
+	c.Lock()
+	defer c.Unlock()
+	c.done = true
+	if c.code != 0 && c.conn != nil {
+		closeWith(c.conn, c.code, c.reason)
+		c.conn.Close()
+	}
+}
+
+// write sends f on the current connection. While the client is
+// disconnected, frames are only kept for replay. The caller must hold the
+// lock.
+func (c *DefaultClient) write(f *proto.Frame) {
+	if c.conn == nil {
+		return
+	}
+
+	data, err := c.codec.Marshal(f)
+	if err != nil {
+		log.Warn().Str("user", c.name).Err(err).Msg("marshal message")
+		return
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	err = c.conn.WriteMessage(messageType(c.codec), data)
+	if err != nil {
+		log.Warn().Str("user", c.name).Err(err).Msg("write message")
+	}
+}
+
+// messageType returns the websocket message type used by codec.
+func messageType(codec proto.Codec) int {
+	if codec.Text() {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+func closeWith(conn Conn, code int, text string) {
+	data := websocket.FormatCloseMessage(code, text)
+	deadline := time.Now().Add(closeTimeout)
+	if err := conn.WriteControl(websocket.CloseMessage, data, deadline); err != nil {
+		log.Warn().Err(err).Msg("write close message")
+	}
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal().Err(err).Msg("generate session token")
 	}
+	return hex.EncodeToString(b)
 }
@@ -32,15 +32,21 @@ func TestClient_Echo(t *testing.T) {
 	sw.Register(client)
 
 	give := &proto.Frame{
-		Src: "user 1",
+		Src: "client 1",
 		Dst: "user 2",
 	}
 	client.Send() <- give
 	time.Sleep(100 * time.Millisecond)
 
+	want := &proto.Frame{
+		Src: "client 1",
+		Dst: "user 2",
+		Seq: 1,
+	}
+
 	select {
 	case have := <-sw.forward:
-		assert.True(t, pb.Equal(give, have), "response should match")
+		assert.True(t, pb.Equal(want, have), "response should match")
 	case <-time.After(1 * time.Second):
 		t.Error("receive timeout")
 	}
@@ -48,9 +54,245 @@ func TestClient_Echo(t *testing.T) {
 	server.Close()
 }
 
+func TestClient_Limits(t *testing.T) {
+	sw := &fakeSwitch{
+		forward:    make(chan *proto.Frame, 10),
+		unregister: make(chan Client, 1),
+	}
+	conn := dialClient(t, sw, func(c *DefaultClient) {
+		c.SetLimits(&Limits{
+			Rates: map[string]Rate{"default": {Rate: 0.001, Burst: 2}},
+			Abuse: Rate{Rate: 0.001, Burst: 1},
+		})
+	})
+
+	for i := 0; i < 4; i++ {
+		writeFrame(t, conn, &proto.Frame{Src: "client 1", Dst: "user 2", Id: uint64(i + 1)})
+	}
+
+	for i := 0; i < 2; i++ {
+		f := <-sw.forward
+		assert.Equal(t, "user 2", f.Dst, "frames within limit should pass")
+	}
+	f := <-sw.forward
+	assert.Equal(t, proto.Error_RATE_LIMITED, f.GetError().GetCode())
+
+	have := readFrame(t, conn).GetError()
+	require.NotNil(t, have, "abusive client should receive an error")
+	assert.Equal(t, proto.Error_RATE_LIMITED, have.Code)
+	assert.Equal(t, uint64(4), have.Ref)
+	assert.Equal(t, websocket.ClosePolicyViolation, closeCode(t, conn))
+	select {
+	case <-sw.unregister:
+	case <-time.After(1 * time.Second):
+		t.Error("abusive client should be disconnected")
+	}
+}
+
+func TestClient_FrameSize(t *testing.T) {
+	sw := &fakeSwitch{
+		forward:    make(chan *proto.Frame, 1),
+		unregister: make(chan Client, 1),
+	}
+	conn := dialClient(t, sw, func(c *DefaultClient) {
+		c.SetLimits(&Limits{FrameSize: 64})
+	})
+
+	writeFrame(t, conn, &proto.Frame{
+		Src:     "client 1",
+		Dst:     "user 2",
+		Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Desc: strings.Repeat("a", 128)}},
+	})
+	assert.Equal(t, websocket.CloseMessageTooBig, closeCode(t, conn))
+	select {
+	case <-sw.unregister:
+	case <-time.After(1 * time.Second):
+		t.Error("oversize sender should not await resume")
+	}
+}
+
+func TestClient_Reject(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(testutil.Echo))
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+
+	sw := &fakeSwitch{
+		forward: make(chan *proto.Frame),
+	}
+	client := NewClient(conn, "client 1")
+	sw.Register(client)
+
+	tests := []struct {
+		desc string
+		give *proto.Frame
+		want *proto.Frame
+	}{
+		{
+			desc: "sender mismatch",
+			give: &proto.Frame{Src: "user 1", Dst: "user 2", Id: 1},
+			want: &proto.Frame{
+				Src:     "user 2",
+				Dst:     "client 1",
+				Payload: proto.PayloadWithError(proto.Error_FORBIDDEN, "sender mismatch", 1),
+			},
+		},
+		{
+			desc: "error payload from client",
+			give: &proto.Frame{
+				Src:     "client 1",
+				Dst:     "user 2",
+				Id:      2,
+				Payload: proto.PayloadWithError(proto.Error_PEER_OFFLINE, "", 0),
+			},
+			want: &proto.Frame{
+				Src:     "user 2",
+				Dst:     "client 1",
+				Payload: proto.PayloadWithError(proto.Error_FORBIDDEN, "payload type not allowed", 2),
+			},
+		},
+		{
+			desc: "notice payload from client",
+			give: &proto.Frame{
+				Src:     "client 1",
+				Dst:     "user 2",
+				Id:      3,
+				Payload: proto.PayloadWithNotice(proto.Notice_CRITICAL, "restart", time.Time{}),
+			},
+			want: &proto.Frame{
+				Src:     "user 2",
+				Dst:     "client 1",
+				Payload: proto.PayloadWithError(proto.Error_FORBIDDEN, "payload type not allowed", 3),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client.Send() <- tt.give
+
+			select {
+			case have := <-sw.forward:
+				assert.True(t, pb.Equal(tt.want, have), "have: %v", have)
+			case <-time.After(1 * time.Second):
+				t.Error("receive timeout")
+			}
+		})
+	}
+}
+
+// dialHelloClient connects to a new client that requires a hello.
+func dialHelloClient(t *testing.T, sw *fakeSwitch) *websocket.Conn {
+	t.Helper()
+	return dialClient(t, sw, func(c *DefaultClient) { c.SetMinProtocol(1) })
+}
+
+// dialClient connects to a new client "client 1" registered with sw after
+// it was set up by setup. The session handshake is consumed.
+func dialClient(t *testing.T, sw *fakeSwitch, setup func(*DefaultClient)) *websocket.Conn {
+	t.Helper()
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := NewClient(conn, "client 1")
+		setup(c)
+		sw.Register(c)
+	}))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NotNil(t, readFrame(t, conn).GetResume())
+	return conn
+}
+
+func TestClient_Hello(t *testing.T) {
+	frame := &proto.Frame{Src: "client 1", Dst: "user 2"}
+
+	t.Run("welcome", func(t *testing.T) {
+		sw := &fakeSwitch{forward: make(chan *proto.Frame, 1)}
+		conn := dialHelloClient(t, sw)
+
+		writeFrame(t, conn, &proto.Frame{Payload: proto.PayloadWithHello(
+			"1.0", "device", []string{proto.FeatureAck, proto.FeatureRCon},
+		)})
+		want := &proto.Frame{
+			Dst: "client 1",
+			Payload: &proto.Frame_Welcome{Welcome: &proto.Welcome{
+				Protocol: proto.ProtocolVersion,
+				Version:  Version,
+				Features: []string{proto.FeatureAck},
+			}},
+		}
+		have := readFrame(t, conn)
+		assert.True(t, pb.Equal(want, have), "have: %v", have)
+
+		writeFrame(t, conn, frame)
+		assert.True(t, pb.Equal(frame, <-sw.forward))
+	})
+
+	t.Run("second hello", func(t *testing.T) {
+		sw := &fakeSwitch{forward: make(chan *proto.Frame, 1)}
+		conn := dialHelloClient(t, sw)
+		hello := &proto.Frame{Id: 2, Payload: proto.PayloadWithHello("1.0", "device", nil)}
+
+		writeFrame(t, conn, hello)
+		require.NotNil(t, readFrame(t, conn).GetWelcome())
+		writeFrame(t, conn, hello)
+		have := (<-sw.forward).GetError()
+		require.NotNil(t, have)
+		assert.Equal(t, proto.Error_FORBIDDEN, have.Code)
+		assert.Equal(t, uint64(2), have.Ref)
+	})
+
+	t.Run("hello rate limit", func(t *testing.T) {
+		sw := &fakeSwitch{forward: make(chan *proto.Frame, 1)}
+		conn := dialClient(t, sw, func(c *DefaultClient) {
+			c.SetLimits(&Limits{Rates: map[string]Rate{"hello": {Rate: 0.001, Burst: 1}}})
+		})
+		hello := &proto.Frame{Id: 3, Payload: proto.PayloadWithHello("1.0", "device", nil)}
+
+		writeFrame(t, conn, hello)
+		require.NotNil(t, readFrame(t, conn).GetWelcome())
+		writeFrame(t, conn, hello)
+		have := (<-sw.forward).GetError()
+		require.NotNil(t, have)
+		assert.Equal(t, proto.Error_RATE_LIMITED, have.Code)
+	})
+
+	t.Run("hello required", func(t *testing.T) {
+		conn := dialHelloClient(t, &fakeSwitch{})
+
+		writeFrame(t, conn, frame)
+		have := readFrame(t, conn).GetError()
+		require.NotNil(t, have)
+		assert.Equal(t, proto.Error_INCOMPATIBLE, have.Code)
+		assert.Equal(t, "hello required", have.Message)
+		assert.Equal(t, proto.CloseIncompatible, closeCode(t, conn))
+	})
+
+	t.Run("protocol too old", func(t *testing.T) {
+		conn := dialHelloClient(t, &fakeSwitch{})
+
+		writeFrame(t, conn, &proto.Frame{Payload: &proto.Frame_Hello{Hello: &proto.Hello{}}})
+		have := readFrame(t, conn).GetError()
+		require.NotNil(t, have)
+		assert.Equal(t, proto.Error_INCOMPATIBLE, have.Code)
+		assert.Equal(t, proto.CloseIncompatible, closeCode(t, conn))
+	})
+}
+
 type fakeSwitch struct {
-	client  Client
-	forward chan *proto.Frame
+	client     Client
+	forward    chan *proto.Frame
+	unregister chan Client
 }
 
 func (s *fakeSwitch) Register(c Client) {
@@ -60,12 +302,18 @@ func (s *fakeSwitch) Register(c Client) {
 
 func (s *fakeSwitch) Unregister(c Client) {
 	s.client = nil
+	if s.unregister != nil {
+		s.unregister <- c
+	}
 }
 
 func (s *fakeSwitch) Forward() chan<- *proto.Frame {
 	return s.forward
 }
 
+func (*fakeSwitch) Broadcast(*proto.Frame) {
+}
+
 func (*fakeSwitch) Run() {
 }
 
@@ -0,0 +1,543 @@
+package signaling
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lx7/devnet/internal/listen"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	linkMessageSize = 1 << 20
+	linkQueueSize   = 256
+	linkTimeout     = 10 * time.Second
+	linkRetry       = time.Second
+	linkRetryMax    = 30 * time.Second
+)
+
+// ClusterConfig defines the inter-node link of a signaling cluster.
+type ClusterConfig struct {
+	// Addr is the listen address for links from other nodes.
+	Addr string
+
+	// Peers lists the link addresses of all other nodes.
+	Peers []string
+
+	// TLSCrt and TLSKey are used for both sides of a link. The certificate
+	// common name is the node name.
+	TLSCrt string `mapstructure:"tls_crt"`
+	TLSKey string `mapstructure:"tls_key"`
+
+	// TLSCA is used to verify the certificates of other nodes.
+	TLSCA string `mapstructure:"tls_ca"`
+}
+
+// ClusterSwitch implements the Switch interface across several signaling
+// nodes. Every node connects to all of its peers over mutual TLS, announces
+// the users registered locally and forwards frames for remote users.
+type ClusterSwitch struct {
+	*DefaultSwitch
+	node     string
+	tls      *tls.Config
+	peers    []string
+	listener net.Listener
+
+	mu      sync.Mutex
+	users   map[string]bool
+	routes  map[string]string
+	links   map[string]*link
+	inbound map[string]net.Conn
+	quit    chan bool
+}
+
+// link is the outbound connection to another node.
+type link struct {
+	node string
+	conn net.Conn
+	send chan *proto.Link
+}
+
+// NewClusterSwitch returns a new ClusterSwitch instance listening on
+// conf.Addr. Peers are connected by Run.
+func NewClusterSwitch(conf *ClusterConfig) (*ClusterSwitch, error) {
+	crt, err := tls.LoadX509KeyPair(conf.TLSCrt, conf.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(crt.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %v", err)
+	}
+	if leaf.Subject.CommonName == "" {
+		return nil, errors.New("certificate without common name")
+	}
+
+	ca, err := ioutil.ReadFile(conf.TLSCA)
+	if err != nil {
+		return nil, fmt.Errorf("read ca: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no ca certificates found")
+	}
+
+	c := &ClusterSwitch{
+		DefaultSwitch: NewSwitch(),
+		node:          leaf.Subject.CommonName,
+		tls: &tls.Config{
+			Certificates: []tls.Certificate{crt},
+			RootCAs:      pool,
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		},
+		peers:   conf.Peers,
+		users:   make(map[string]bool),
+		routes:  make(map[string]string),
+		links:   make(map[string]*link),
+		inbound: make(map[string]net.Conn),
+		quit:    make(chan bool),
+	}
+	c.DefaultSwitch.router = c
+
+	ln, err := listen.Listen(conf.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %v", err)
+	}
+	c.listener = tls.NewListener(ln, c.tls)
+	return c, nil
+}
+
+// Node returns the name of the local node.
+func (c *ClusterSwitch) Node() string {
+	return c.node
+}
+
+// Addr returns the listen address for links from other nodes.
+func (c *ClusterSwitch) Addr() net.Addr {
+	return c.listener.Addr()
+}
+
+// Run connects to the configured peers and implements the message handling
+// loop.
+func (c *ClusterSwitch) Run() {
+	log.Info().
+		Str("node", c.node).
+		Stringer("addr", c.Addr()).
+		Msg("starting cluster node")
+
+	go c.accept()
+	for _, addr := range c.peers {
+		c.Connect(addr)
+	}
+	c.DefaultSwitch.Run()
+}
+
+// Connect maintains an outbound link to the node at addr until shutdown.
+func (c *ClusterSwitch) Connect(addr string) {
+	go func() {
+		retry := linkRetry
+		for {
+			if c.dial(addr) {
+				retry = linkRetry
+			}
+			select {
+			case <-c.quit:
+				return
+			case <-time.After(retry):
+			}
+			if retry *= 2; retry > linkRetryMax {
+				retry = linkRetryMax
+			}
+		}
+	}()
+}
+
+// Shutdown closes all links and stops the run loop.
+func (c *ClusterSwitch) Shutdown() {
+	close(c.quit)
+	c.listener.Close()
+
+	c.mu.Lock()
+	for _, l := range c.links {
+		l.conn.Close()
+	}
+	for _, conn := range c.inbound {
+		conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.DefaultSwitch.Shutdown()
+}
+
+// join announces a local user to all nodes.
+func (c *ClusterSwitch) join(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[name] = true
+	c.announce(&proto.Presence{Users: []string{name}, Online: true})
+}
+
+// leave announces the departure of a local user to all nodes.
+func (c *ClusterSwitch) leave(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.users, name)
+	c.announce(&proto.Presence{Users: []string{name}})
+}
+
+// route forwards f to the node the recipient is registered with. Returns
+// false if the recipient is unknown or the link is congested.
+func (c *ClusterSwitch) route(f *proto.Frame) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok := c.links[c.routes[f.Dst]]
+	if !ok {
+		return false
+	}
+	return l.push(&proto.Link{Payload: &proto.Link_Frame{Frame: f}})
+}
+
+// online returns the users registered with other nodes.
+func (c *ClusterSwitch) online() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	users := make([]string, 0, len(c.routes))
+	for u := range c.routes {
+		users = append(users, u)
+	}
+	return users
+}
+
+// registered reports whether name is registered with another node.
+func (c *ClusterSwitch) registered(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.routes[name]
+	return ok
+}
+
+// Broadcast sends f to the clients of all nodes.
+func (c *ClusterSwitch) Broadcast(f *proto.Frame) {
+	c.mu.Lock()
+	for _, l := range c.links {
+		l.push(&proto.Link{Payload: &proto.Link_Frame{Frame: f}})
+	}
+	c.mu.Unlock()
+	c.DefaultSwitch.Broadcast(f)
+}
+
+// announce sends a presence update on all links. The caller must hold the
+// lock.
+func (c *ClusterSwitch) announce(p *proto.Presence) {
+	for _, l := range c.links {
+		l.push(&proto.Link{Payload: &proto.Link_Presence{Presence: p}})
+	}
+}
+
+// dial runs a single outbound link. Returns true if the link was
+// established.
+func (c *ClusterSwitch) dial(addr string) bool {
+	d := &net.Dialer{Timeout: linkTimeout}
+	conn, err := tls.DialWithDialer(d, "tcp", addr, c.tls)
+	if err != nil {
+		log.Warn().Str("addr", addr).Err(err).Msg("cluster link dial failed")
+		return false
+	}
+	defer conn.Close()
+
+	l := &link{
+		node: peerNode(conn),
+		conn: conn,
+		send: make(chan *proto.Link, linkQueueSize),
+	}
+
+	c.mu.Lock()
+	if old, ok := c.links[l.node]; ok {
+		old.conn.Close()
+	}
+	c.links[l.node] = l
+	users := make([]string, 0, len(c.users))
+	for u := range c.users {
+		users = append(users, u)
+	}
+	l.push(&proto.Link{Payload: &proto.Link_Presence{Presence: &proto.Presence{
+		Users:  users,
+		Online: true,
+		Full:   true,
+	}}})
+	c.mu.Unlock()
+
+	log.Info().Str("node", l.node).Str("addr", addr).Msg("cluster link established")
+	defer func() {
+		c.mu.Lock()
+		if c.links[l.node] == l {
+			delete(c.links, l.node)
+		}
+		c.mu.Unlock()
+		log.Info().Str("node", l.node).Msg("cluster link closed")
+	}()
+
+	// nothing is received on outbound links, reading detects the close
+	closed := make(chan bool)
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		close(closed)
+	}()
+
+	w := bufio.NewWriter(conn)
+	for {
+		select {
+		case m := <-l.send:
+			conn.SetWriteDeadline(time.Now().Add(linkTimeout))
+			if err := writeLink(w, m); err != nil {
+				log.Warn().Str("node", l.node).Err(err).Msg("cluster link write")
+				return true
+			}
+		case <-closed:
+			return true
+		case <-c.quit:
+			return true
+		}
+	}
+}
+
+func (c *ClusterSwitch) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			select {
+			case <-c.quit:
+			default:
+				log.Error().Err(err).Msg("cluster link accept")
+			}
+			return
+		}
+		go c.receive(conn.(*tls.Conn))
+	}
+}
+
+// receive processes presence updates and frames from an inbound link.
+func (c *ClusterSwitch) receive(conn *tls.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(linkTimeout))
+	if err := conn.Handshake(); err != nil {
+		log.Warn().
+			Stringer("src", conn.RemoteAddr()).
+			Err(err).
+			Msg("cluster link handshake failed")
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	node := peerNode(conn)
+
+	c.mu.Lock()
+	if old, ok := c.inbound[node]; ok {
+		old.Close()
+	}
+	c.inbound[node] = conn
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		if c.inbound[node] == conn {
+			delete(c.inbound, node)
+			c.pass(c.departed, c.forget(node))
+		}
+		c.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		m, err := readLink(r)
+		if err != nil {
+			select {
+			case <-c.quit:
+			default:
+				if err != io.EOF {
+					log.Warn().Str("node", node).Err(err).Msg("cluster link read")
+				}
+			}
+			return
+		}
+
+		switch pl := m.Payload.(type) {
+		case *proto.Link_Presence:
+			c.update(node, pl.Presence)
+		case *proto.Link_Frame:
+			// frames without recipient are broadcasts
+			deliver := c.deliver
+			if pl.Frame.Dst == "" {
+				c.notices.add(pl.Frame)
+				deliver = c.broadcast
+			}
+			select {
+			case deliver <- pl.Frame:
+			case <-c.quit:
+				return
+			}
+		}
+	}
+}
+
+// update applies a presence announcement of node to the routing table.
+func (c *ClusterSwitch) update(node string, p *proto.Presence) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	log.Debug().
+		Str("node", node).
+		Strs("users", p.Users).
+		Bool("online", p.Online).
+		Msg("cluster presence update")
+	var gone []string
+	if p.Full {
+		gone = c.forget(node)
+	}
+	for _, u := range p.Users {
+		if p.Online {
+			c.routes[u] = node
+		} else if c.routes[u] == node {
+			delete(c.routes, u)
+			gone = append(gone, u)
+		}
+	}
+	var departed []string
+	for _, u := range gone {
+		if _, ok := c.routes[u]; !ok {
+			departed = append(departed, u)
+		}
+	}
+	c.pass(c.departed, departed)
+
+	// a new registration on node replaces local clients of the same name.
+	// Full announcements only resynchronize registrations.
+	if p.Online && !p.Full {
+		var replaced []string
+		for _, u := range p.Users {
+			if c.users[u] {
+				replaced = append(replaced, u)
+			}
+		}
+		c.pass(c.replaced, replaced)
+	}
+
+	// frames stored here for users online elsewhere are handed off
+	if p.Online && len(p.Users) > 0 {
+		go func(users []string) {
+			for _, u := range users {
+				select {
+				case c.handoff <- u:
+				case <-c.quit:
+					return
+				}
+			}
+		}(p.Users)
+	}
+}
+
+// forget removes all routes to node and returns the users that were
+// routed to it. The caller must hold the lock.
+func (c *ClusterSwitch) forget(node string) []string {
+	var users []string
+	for u, n := range c.routes {
+		if n == node {
+			delete(c.routes, u)
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// pass reports users to the switch run loop on ch, e.g. users that are no
+// longer registered with another node on c.departed. The caller must hold
+// the lock.
+func (c *ClusterSwitch) pass(ch chan<- string, users []string) {
+	if len(users) == 0 {
+		return
+	}
+	go func() {
+		for _, u := range users {
+			select {
+			case ch <- u:
+			case <-c.quit:
+				return
+			}
+		}
+	}()
+}
+
+// push queues m for sending. A congested link is closed and reconnected,
+// which resynchronizes the presence state.
+func (l *link) push(m *proto.Link) bool {
+	select {
+	case l.send <- m:
+		return true
+	default:
+		log.Warn().Str("node", l.node).Msg("cluster link congested, reconnecting")
+		l.conn.Close()
+		return false
+	}
+}
+
+// peerNode returns the node name from the verified peer certificate.
+func peerNode(conn *tls.Conn) string {
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	return certs[0].Subject.CommonName
+}
+
+// writeLink writes m with a 4 byte length prefix.
+func writeLink(w *bufio.Writer, m *proto.Link) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	var head [4]byte
+	binary.BigEndian.PutUint32(head[:], uint32(len(data)))
+	if _, err := w.Write(head[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readLink reads a message written by writeLink.
+func readLink(r *bufio.Reader) (*proto.Link, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(head[:])
+	if n > linkMessageSize {
+		return nil, fmt.Errorf("message size %d exceeds limit", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	m := &proto.Link{}
+	if err := m.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,322 @@
+package signaling
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestClusterSwitch(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	node1 := newTestNode(t, dir, ca, "node1")
+	node2 := newTestNode(t, dir, ca, "node2")
+	require.NoError(t, auth.Configure(conf.Sub("auth")))
+	node1.EnableMailbox(&MailboxConfig{Types: []string{"chat"}, Size: 5})
+	calls1, calls2 := NewCallLog(nil, 5), NewCallLog(nil, 5)
+	node1.Observe(calls1)
+	node2.Observe(calls2)
+
+	go node1.Run()
+	go node2.Run()
+	defer node1.Shutdown()
+	defer node2.Shutdown()
+	node1.Connect(node2.Addr().String())
+	node2.Connect(node1.Addr().String())
+
+	alice := &bufClient{name: "alice", send: make(chan *proto.Frame, 1)}
+	bob := &bufClient{name: "bob", send: make(chan *proto.Frame, 1)}
+	node1.Register(alice)
+	node2.Register(bob)
+
+	require.Eventually(t, func() bool {
+		return routed(node1, "bob", "node2") && routed(node2, "alice", "node1")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	tests := []struct {
+		desc string
+		give *proto.Frame
+		to   *bufClient
+		want *proto.Frame
+	}{
+		{
+			desc: "forward to remote user",
+			give: &proto.Frame{Src: "alice", Dst: "bob", Id: 1},
+			to:   bob,
+			want: &proto.Frame{Src: "alice", Dst: "bob", Id: 1},
+		},
+		{
+			desc: "remote acknowledgement",
+			give: &proto.Frame{Src: "alice", Dst: "bob", Id: 2, WantAck: true},
+			to:   alice,
+			want: &proto.Frame{
+				Src:     "bob",
+				Dst:     "alice",
+				Payload: proto.PayloadWithAck(2),
+			},
+		},
+		{
+			desc: "unknown user",
+			give: &proto.Frame{Src: "alice", Dst: "carol", Id: 3},
+			to:   alice,
+			want: &proto.Frame{
+				Src:     "carol",
+				Dst:     "alice",
+				Payload: proto.PayloadWithError(proto.Error_PEER_OFFLINE, "peer offline", 3),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			node1.Forward() <- tt.give
+
+			select {
+			case have := <-tt.to.send:
+				assert.True(t, pb.Equal(tt.want, have), "have: %v", have)
+			case <-time.After(1 * time.Second):
+				t.Error("receive timeout")
+			}
+			drain(alice, bob)
+		})
+	}
+
+	t.Run("broadcast to all nodes", func(t *testing.T) {
+		notice := &proto.Frame{
+			Payload: proto.PayloadWithNotice(proto.Notice_INFO, "restart", time.Time{}),
+		}
+		node1.Broadcast(notice)
+		for _, c := range []*bufClient{alice, bob} {
+			select {
+			case have := <-c.send:
+				assert.True(t, pb.Equal(notice, have), "have: %v", have)
+			case <-time.After(1 * time.Second):
+				t.Errorf("receive timeout for %s", c.name)
+			}
+		}
+		assert.Len(t, node2.Notices(), 1)
+	})
+
+	t.Run("hand off stored frames", func(t *testing.T) {
+		node1.Forward() <- &proto.Frame{
+			Src:     "alice",
+			Dst:     "user2",
+			Id:      4,
+			Payload: proto.PayloadWithChat("hello"),
+		}
+		select {
+		case have := <-alice.send:
+			assert.Equal(t, proto.Error_PEER_OFFLINE, have.GetError().GetCode())
+		case <-time.After(1 * time.Second):
+			t.Fatal("receive timeout")
+		}
+
+		// notices of the broadcast test are delivered first
+		user2 := &bufClient{name: "user2", send: make(chan *proto.Frame, 2)}
+		node2.Register(user2)
+		defer node2.Unregister(user2)
+		for {
+			select {
+			case have := <-user2.send:
+				if have.GetNotice() != nil {
+					continue
+				}
+				assert.Equal(t, "hello", have.GetChat().GetText())
+				assert.NotZero(t, have.Queued)
+			case <-time.After(5 * time.Second):
+				t.Error("stored frame not handed off")
+			}
+			break
+		}
+	})
+
+	t.Run("call between nodes", func(t *testing.T) {
+		node1.Forward() <- &proto.Frame{
+			Src:     "alice",
+			Dst:     "bob",
+			Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_OFFER}},
+		}
+		select {
+		case <-bob.send:
+		case <-time.After(1 * time.Second):
+			t.Fatal("receive timeout")
+		}
+		node2.Forward() <- &proto.Frame{
+			Src:     "bob",
+			Dst:     "alice",
+			Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_ANSWER}},
+		}
+		select {
+		case <-alice.send:
+		case <-time.After(1 * time.Second):
+			t.Fatal("receive timeout")
+		}
+
+		// the node of the caller tracks the call
+		active := calls1.Active("")
+		require.Len(t, active, 1)
+		assert.Equal(t, "alice", active[0].Caller)
+		assert.NotNil(t, active[0].Answer)
+		assert.Empty(t, calls2.Active(""))
+	})
+
+	t.Run("remote user leaves", func(t *testing.T) {
+		node2.Unregister(bob)
+		require.Eventually(t, func() bool {
+			return !routed(node1, "bob", "node2")
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.Eventually(t, func() bool {
+			return len(calls1.Ended("", time.Time{})) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, EndOffline, calls1.Ended("", time.Time{})[0].Reason)
+	})
+
+	t.Run("name registered with another node", func(t *testing.T) {
+		// guests may not take the name of a user of another node
+		guest := newGuestClient("alice", "Lobby")
+		node2.Register(guest)
+		select {
+		case have := <-guest.send:
+			assert.Equal(t, "name already taken", have.GetError().GetMessage())
+		case <-time.After(1 * time.Second):
+			t.Fatal("receive timeout")
+		}
+
+		// users replace the client registered with the other node
+		alice2 := &bufClient{name: "alice", send: make(chan *proto.Frame, 1)}
+		node2.Register(alice2)
+		defer node2.Unregister(alice2)
+		require.Eventually(t, func() bool {
+			return routed(node1, "alice", "node2")
+		}, 5*time.Second, 10*time.Millisecond)
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case _, ok := <-alice.send:
+				if ok {
+					continue
+				}
+			case <-timeout:
+				t.Fatal("replaced client not disconnected")
+			}
+			break
+		}
+	})
+
+	t.Run("untrusted node", func(t *testing.T) {
+		other := newTestCA(t, dir, "other")
+		node3 := newTestNode(t, dir, other, "node3")
+		defer node3.listener.Close()
+
+		assert.False(t, node3.dial(node1.Addr().String()))
+	})
+}
+
+func routed(c *ClusterSwitch, user, node string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.routes[user] == node
+}
+
+func drain(clients ...*bufClient) {
+	for _, c := range clients {
+		select {
+		case <-c.send:
+		default:
+		}
+	}
+}
+
+type testCA struct {
+	crt  *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, name+".crt")
+	writePEM(t, file, "CERTIFICATE", der)
+	return &testCA{crt: crt, key: key, file: file}
+}
+
+func newTestNode(t *testing.T, dir string, ca *testCA, name string) *ClusterSwitch {
+	crt, key := ca.issue(t, dir, &x509.Certificate{
+		Subject: pkix.Name{CommonName: name},
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+	})
+	conf := &ClusterConfig{
+		Addr:   "127.0.0.1:0",
+		TLSCrt: crt,
+		TLSKey: key,
+		TLSCA:  ca.file,
+	}
+
+	c, err := NewClusterSwitch(conf)
+	require.NoError(t, err)
+	assert.Equal(t, name, c.Node())
+	return c
+}
+
+// issue creates a certificate from tmpl signed by ca and returns the
+// certificate and key files in dir. They are named after the common name.
+func (ca *testCA) issue(t *testing.T, dir string, tmpl *x509.Certificate) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.crt, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	kder, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	crt := filepath.Join(dir, tmpl.Subject.CommonName+".crt")
+	keyFile := filepath.Join(dir, tmpl.Subject.CommonName+".key")
+	writePEM(t, crt, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", kder)
+	return crt, keyFile
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	require.NoError(t, ioutil.WriteFile(file, data, 0600))
+}
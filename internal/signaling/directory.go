@@ -0,0 +1,244 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/rs/zerolog/hlog"
+)
+
+// memberRequest is the body of a membership request to the admin API.
+type memberRequest struct {
+	Channel string `json:"channel"`
+	User    string `json:"user"`
+}
+
+// serveUsers returns the names of all users in the store as JSON. POST
+// requests create or update the user in the JSON request body, DELETE
+// requests remove the user given by the name query parameter and its
+// channel memberships. Changes apply to new connections immediately.
+func (s *Server) serveUsers(w http.ResponseWriter, r *http.Request) {
+	if !s.storeEnabled(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var u auth.User
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if u.Name == "" || u.Hash == "" {
+			http.Error(w, "name or hash missing", http.StatusBadRequest)
+			return
+		}
+		if !s.storeDone(w, r, s.store.PutUser(u)) {
+			return
+		}
+		hlog.FromRequest(r).Info().Str("user", u.Name).Msg("user stored")
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if _, ok := s.store.User(name); !ok {
+			http.Error(w, "unknown user", http.StatusNotFound)
+			return
+		}
+		if !s.storeDone(w, r, s.store.DeleteUser(name)) {
+			return
+		}
+		if !s.storeDone(w, r, s.loadChannels()) {
+			return
+		}
+		hlog.FromRequest(r).Info().Str("user", name).Msg("user deleted")
+	default:
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	users, err := s.store.Users()
+	if !s.storeDone(w, r, err) {
+		return
+	}
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	writeJSON(w, r, names)
+}
+
+// serveChannels returns all channels with their members as JSON. POST
+// requests create or update the channel in the JSON request body, DELETE
+// requests remove the channel given by the name query parameter. Members
+// are changed through serveMembers.
+func (s *Server) serveChannels(w http.ResponseWriter, r *http.Request) {
+	if !s.storeEnabled(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var c store.Channel
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if c.Name == "" {
+			http.Error(w, "name missing", http.StatusBadRequest)
+			return
+		}
+		if !s.storeDone(w, r, s.store.PutChannel(c)) {
+			return
+		}
+		hlog.FromRequest(r).Info().Str("channel", c.Name).Msg("channel stored")
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		err := s.store.DeleteChannel(name)
+		if err == store.ErrNotFound {
+			http.Error(w, "unknown channel", http.StatusNotFound)
+			return
+		}
+		if !s.storeDone(w, r, err) {
+			return
+		}
+		hlog.FromRequest(r).Info().Str("channel", name).Msg("channel deleted")
+	default:
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	if r.Method != http.MethodGet && !s.storeDone(w, r, s.loadChannels()) {
+		return
+	}
+	writeJSON(w, r, s.Channels())
+}
+
+// serveMembers returns the members of the channel given by the channel
+// query parameter as JSON. POST requests add the user in the JSON request
+// body to the channel, DELETE requests remove the user given by the user
+// query parameter.
+func (s *Server) serveMembers(w http.ResponseWriter, r *http.Request) {
+	if !s.storeEnabled(w) {
+		return
+	}
+
+	req := memberRequest{
+		Channel: r.URL.Query().Get("channel"),
+		User:    r.URL.Query().Get("user"),
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, ok := s.store.User(req.User); !ok {
+			http.Error(w, "unknown user", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+	default:
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = s.store.Join(req.Channel, req.User)
+	case http.MethodDelete:
+		err = s.store.Leave(req.Channel, req.User)
+	}
+	if err == nil && r.Method != http.MethodGet {
+		hlog.FromRequest(r).Info().
+			Str("channel", req.Channel).
+			Str("user", req.User).
+			Str("method", r.Method).
+			Msg("channel members changed")
+		err = s.loadChannels()
+	}
+
+	var members []string
+	if err == nil {
+		members, err = s.store.Members(req.Channel)
+	}
+	if err == store.ErrNotFound {
+		http.Error(w, "unknown channel", http.StatusNotFound)
+		return
+	}
+	if !s.storeDone(w, r, err) {
+		return
+	}
+	if members == nil {
+		members = []string{}
+	}
+	writeJSON(w, r, members)
+}
+
+// serveHistory returns the event history as JSON. The query parameters
+// since (RFC 3339) and limit restrict the results to the most recent
+// events.
+func (s *Server) serveHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	if !s.storeEnabled(w) {
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := s.store.History(since, limit)
+	if !s.storeDone(w, r, err) {
+		return
+	}
+	if events == nil {
+		events = []store.Event{}
+	}
+	writeJSON(w, r, events)
+}
+
+// storeEnabled answers the request with 404 if no store is configured.
+func (s *Server) storeEnabled(w http.ResponseWriter) bool {
+	if s.store == nil {
+		http.Error(w, "store disabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// storeDone answers the request with 500 if err is set.
+func (s *Server) storeDone(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("store")
+		code := http.StatusInternalServerError
+		http.Error(w, http.StatusText(code), code)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package signaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin_Directory(t *testing.T) {
+	defer auth.Configure(conf.Sub("auth"))
+
+	s := newAdminTestServer(t)
+	s.openStore(filepath.Join(t.TempDir(), "test.db"))
+	defer s.store.Close()
+	require.NoError(t, s.loadChannels())
+	require.NoError(t, s.store.Record(store.Event{
+		Time: time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC),
+		Type: "online",
+		User: "user1",
+	}))
+	h := s.adminHandler()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.SetBasicAuth("testuser", "test")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		desc       string
+		giveMethod string
+		giveTarget string
+		giveBody   string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			desc:       "list users",
+			giveMethod: "GET",
+			giveTarget: "/users",
+			wantCode:   http.StatusOK,
+			wantBody:   `["testuser","user1","user2"]`,
+		},
+		{
+			desc:       "add user",
+			giveMethod: "POST",
+			giveTarget: "/users",
+			giveBody:   `{"name":"user3","hash":"$2a$10$abc"}`,
+			wantCode:   http.StatusOK,
+			wantBody:   `["testuser","user1","user2","user3"]`,
+		},
+		{
+			desc:       "add user without hash",
+			giveMethod: "POST",
+			giveTarget: "/users",
+			giveBody:   `{"name":"user4"}`,
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			desc:       "join channel",
+			giveMethod: "POST",
+			giveTarget: "/members",
+			giveBody:   `{"channel":"Lobby","user":"user3"}`,
+			wantCode:   http.StatusOK,
+			wantBody:   `["user3"]`,
+		},
+		{
+			desc:       "join unknown channel",
+			giveMethod: "POST",
+			giveTarget: "/members",
+			giveBody:   `{"channel":"Standup","user":"user3"}`,
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			desc:       "join unknown user",
+			giveMethod: "POST",
+			giveTarget: "/members",
+			giveBody:   `{"channel":"Lobby","user":"nobody"}`,
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			desc:       "delete user",
+			giveMethod: "DELETE",
+			giveTarget: "/users?name=user3",
+			wantCode:   http.StatusOK,
+			wantBody:   `["testuser","user1","user2"]`,
+		},
+		{
+			desc:       "membership removed with user",
+			giveMethod: "GET",
+			giveTarget: "/members?channel=Lobby",
+			wantCode:   http.StatusOK,
+			wantBody:   `[]`,
+		},
+		{
+			desc:       "delete unknown user",
+			giveMethod: "DELETE",
+			giveTarget: "/users?name=user3",
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			desc:       "add channel",
+			giveMethod: "POST",
+			giveTarget: "/channels",
+			giveBody:   `{"name":"Standup","desc":"Daily standup."}`,
+			wantCode:   http.StatusOK,
+			wantBody: `[{"name":"Lobby","desc":"This is the lobby.",` +
+				`"hash":"bef8ef72b9935ed7709f700f6a78a84a217b5714238316136156e28333251552",` +
+				`"default":true},` +
+				`{"name":"Standup","desc":"Daily standup.","hash":"","default":false}]`,
+		},
+		{
+			desc:       "leave channel",
+			giveMethod: "DELETE",
+			giveTarget: "/members?channel=Standup&user=user1",
+			wantCode:   http.StatusOK,
+			wantBody:   `[]`,
+		},
+		{
+			desc:       "delete channel",
+			giveMethod: "DELETE",
+			giveTarget: "/channels?name=Standup",
+			wantCode:   http.StatusOK,
+			wantBody: `[{"name":"Lobby","desc":"This is the lobby.",` +
+				`"hash":"bef8ef72b9935ed7709f700f6a78a84a217b5714238316136156e28333251552",` +
+				`"default":true}]`,
+		},
+		{
+			desc:       "history",
+			giveMethod: "GET",
+			giveTarget: "/history?since=2020-12-01T09:00:00Z&limit=1",
+			wantCode:   http.StatusOK,
+			wantBody:   `[{"time":"2020-12-01T10:00:00Z","type":"online","user":"user1"}]`,
+		},
+		{
+			desc:       "invalid history limit",
+			giveMethod: "GET",
+			giveTarget: "/history?limit=many",
+			wantCode:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rr := do(tt.giveMethod, tt.giveTarget, tt.giveBody)
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("channels reloaded", func(t *testing.T) {
+		require.Len(t, s.Channels(), 1)
+		assert.Equal(t, "Lobby", s.Channels()[0].Name)
+	})
+	t.Run("members reloaded", func(t *testing.T) {
+		rr := do("POST", "/members", `{"channel":"Lobby","user":"user1"}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		c, ok := s.channel("Lobby")
+		require.True(t, ok)
+		assert.Equal(t, []string{"user1"}, c.Members)
+	})
+	t.Run("user removed from auth", func(t *testing.T) {
+		assert.False(t, auth.Exists("user3"))
+	})
+}
+
+func TestAdmin_DirectoryDisabled(t *testing.T) {
+	s := newAdminTestServer(t)
+	h := s.adminHandler()
+
+	for _, target := range []string{"/users", "/channels", "/members", "/history"} {
+		req := httptest.NewRequest("GET", target, nil)
+		req.SetBasicAuth("testuser", "test")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code, target)
+	}
+}
@@ -0,0 +1,135 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	historyQueueSize     = 256
+	historyPruneInterval = time.Hour
+)
+
+// HistoryConfig defines the retention of the event history.
+type HistoryConfig struct {
+	// Retention is the time events are kept. Events are kept forever if
+	// it is zero.
+	Retention time.Duration
+
+	// MaxEvents is the maximum number of events kept. The number is not
+	// limited if it is zero.
+	MaxEvents int `mapstructure:"max_events"`
+}
+
+// History implements an Observer that records logins, logouts, call offers
+// and answers in a store.
+type History struct {
+	store  store.Store
+	config HistoryConfig
+	events chan *Event
+	done   chan bool
+}
+
+// NewHistory returns a new History instance writing to s. Events beyond
+// the retention defined by c are pruned on start and then every hour.
+func NewHistory(s store.Store, c HistoryConfig) *History {
+	h := &History{
+		store:  s,
+		config: c,
+		events: make(chan *Event, historyQueueSize),
+		done:   make(chan bool),
+	}
+	go h.run()
+	return h
+}
+
+// Notify implements the Observer interface.
+func (h *History) Notify(e *Event) {
+	if _, ok := historyEvent(e); !ok {
+		return
+	}
+	select {
+	case h.events <- e:
+	default:
+		log.Warn().Stringer("type", e.Type).Msg("history queue full, discarding event")
+	}
+}
+
+// Close writes all queued events and stops recording.
+func (h *History) Close() {
+	close(h.events)
+	<-h.done
+}
+
+func (h *History) run() {
+	defer close(h.done)
+
+	var prune <-chan time.Time
+	if h.config.Retention > 0 || h.config.MaxEvents > 0 {
+		h.prune()
+		t := time.NewTicker(historyPruneInterval)
+		defer t.Stop()
+		prune = t.C
+	}
+
+	for {
+		select {
+		case e, ok := <-h.events:
+			if !ok {
+				return
+			}
+			he, _ := historyEvent(e)
+			if err := h.store.Record(he); err != nil {
+				log.Error().Err(err).Msg("record history event")
+			}
+		case <-prune:
+			h.prune()
+		}
+	}
+}
+
+// prune deletes the events beyond the retention.
+func (h *History) prune() {
+	var before time.Time
+	if h.config.Retention > 0 {
+		before = time.Now().Add(-h.config.Retention)
+	}
+	n, err := h.store.Prune(before, h.config.MaxEvents)
+	if err != nil {
+		log.Error().Err(err).Msg("prune history")
+		return
+	}
+	if n > 0 {
+		log.Info().Int("events", n).Msg("pruned history")
+	}
+}
+
+// historyEvent converts e to a store event. Returns false if e is not
+// recorded.
+func historyEvent(e *Event) (store.Event, bool) {
+	he := store.Event{Time: e.Time, User: e.User}
+	switch e.Type {
+	case EventOnline, EventOffline:
+		he.Type = e.Type.String()
+		return he, true
+	case EventForward:
+		pl, ok := e.Frame.Payload.(*proto.Frame_Sdp)
+		if !ok {
+			return he, false
+		}
+		switch pl.Sdp.Type {
+		case proto.SDP_OFFER:
+			he.Type = "offer"
+		case proto.SDP_ANSWER:
+			he.Type = "answer"
+		default:
+			return he, false
+		}
+		he.User, he.Peer = e.Frame.Src, e.Frame.Dst
+		return he, true
+	}
+	return he, false
+}
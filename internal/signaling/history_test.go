@@ -0,0 +1,105 @@
+package signaling
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	st, err := store.OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer st.Close()
+
+	sdp := func(typ proto.SDP_Type) *proto.Frame {
+		return &proto.Frame{
+			Src:     "user1",
+			Dst:     "user2",
+			Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: typ}},
+		}
+	}
+	now := time.Now()
+
+	tests := []struct {
+		desc string
+		give *Event
+		want *store.Event
+	}{
+		{
+			desc: "online",
+			give: &Event{Type: EventOnline, Time: now, User: "user1"},
+			want: &store.Event{Type: "online", User: "user1"},
+		},
+		{
+			desc: "offer",
+			give: &Event{Type: EventForward, Time: now, User: "user2", Frame: sdp(proto.SDP_OFFER)},
+			want: &store.Event{Type: "offer", User: "user1", Peer: "user2"},
+		},
+		{
+			desc: "answer",
+			give: &Event{Type: EventForward, Time: now, User: "user2", Frame: sdp(proto.SDP_ANSWER)},
+			want: &store.Event{Type: "answer", User: "user1", Peer: "user2"},
+		},
+		{
+			desc: "ice candidate",
+			give: &Event{Type: EventForward, Time: now, User: "user2", Frame: &proto.Frame{
+				Payload: &proto.Frame_Ice{Ice: &proto.ICE{}},
+			}},
+			want: nil,
+		},
+		{
+			desc: "offline",
+			give: &Event{Type: EventOffline, Time: now, User: "user1"},
+			want: &store.Event{Type: "offline", User: "user1"},
+		},
+	}
+
+	h := NewHistory(st, HistoryConfig{})
+	var want []store.Event
+	for _, tt := range tests {
+		h.Notify(tt.give)
+		if tt.want != nil {
+			want = append(want, *tt.want)
+		}
+	}
+	h.Close()
+
+	have, err := st.History(time.Time{}, 0)
+	require.NoError(t, err)
+	require.Len(t, have, len(want))
+	for i := range want {
+		assert.Equal(t, want[i].Type, have[i].Type)
+		assert.Equal(t, want[i].User, have[i].User)
+		assert.Equal(t, want[i].Peer, have[i].Peer)
+	}
+}
+
+func TestHistory_Prune(t *testing.T) {
+	st, err := store.OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer st.Close()
+
+	now := time.Now()
+	for _, d := range []time.Duration{48 * time.Hour, 2 * time.Hour, time.Hour, 0} {
+		require.NoError(t, st.Record(store.Event{
+			Time: now.Add(-d),
+			Type: "online",
+			User: "user1",
+		}))
+	}
+
+	// events are pruned on start
+	h := NewHistory(st, HistoryConfig{Retention: 24 * time.Hour, MaxEvents: 2})
+	h.Close()
+
+	have, err := st.History(time.Time{}, 0)
+	require.NoError(t, err)
+	require.Len(t, have, 2)
+	assert.True(t, now.Add(-time.Hour).Equal(have[0].Time))
+	assert.True(t, now.Equal(have[1].Time))
+}
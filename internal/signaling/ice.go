@@ -0,0 +1,138 @@
+package signaling
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/lx7/devnet/internal/turn"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// defaultTURNInterval is the default interval between turn server checks.
+const defaultTURNInterval = 5 * time.Minute
+
+// TURNConfig lists the turn servers advertised to clients as ICE servers.
+type TURNConfig struct {
+	Servers []TURNServer
+
+	// Timeout applies to health requests and reachability checks.
+	Timeout time.Duration
+
+	// Interval between checks after startup. Servers are added and removed
+	// as they become reachable or unreachable.
+	Interval time.Duration
+}
+
+// TURNServer defines a turn server statically or by the url of its health
+// endpoint. Static values override those served by the endpoint.
+type TURNServer struct {
+	Host       string
+	Port       int
+	Transports []string
+	Health     string
+}
+
+// info returns the turn server info of ts.
+func (ts *TURNServer) info(timeout time.Duration) (*turn.Info, error) {
+	i := &turn.Info{}
+	if ts.Health != "" {
+		var err error
+		if i, err = turn.FetchInfo(ts.Health, timeout); err != nil {
+			return nil, err
+		}
+	}
+	if ts.Host != "" {
+		i.Host = ts.Host
+	}
+	if ts.Port != 0 {
+		i.Port = ts.Port
+	}
+	if len(ts.Transports) > 0 {
+		i.Transports = ts.Transports
+	}
+	return i, nil
+}
+
+// ICEServers returns the ICE server urls of all reachable turn servers.
+// Unreachable servers are logged and left out.
+func (tc *TURNConfig) ICEServers() []string {
+	timeout := tc.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+
+	var urls []string
+	for _, ts := range tc.Servers {
+		i, err := ts.info(timeout)
+		if err == nil {
+			err = i.Check(timeout)
+		}
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("host", ts.Host).
+				Str("health", ts.Health).
+				Msg("turn server unreachable, not advertised")
+			continue
+		}
+		log.Debug().
+			Str("host", i.Host).
+			Int("port", i.Port).
+			Str("realm", i.Realm).
+			Msg("turn server reachable")
+		urls = append(urls, i.URLs()...)
+	}
+	return urls
+}
+
+// turnConfig returns the turn server configuration in conf.
+func turnConfig(conf *viper.Viper) *TURNConfig {
+	tc := &TURNConfig{}
+	if err := conf.UnmarshalKey("signaling.turn", tc); err != nil {
+		log.Error().Err(err).Msg("unmarshal turn config")
+	}
+	if tc.Interval <= 0 {
+		tc.Interval = defaultTURNInterval
+	}
+	return tc
+}
+
+// discoverTURN checks the turn servers in tc and advertises those that are
+// reachable in place of the previous ones.
+func (s *Server) discoverTURN(tc *TURNConfig) {
+	urls := tc.ICEServers()
+
+	s.imu.Lock()
+	changed := !reflect.DeepEqual(urls, s.discovered)
+	s.discovered = urls
+	s.imu.Unlock()
+
+	if changed {
+		log.Info().Strs("urls", urls).Msg("advertised turn servers changed")
+	}
+}
+
+// watchTURN repeats the turn server discovery with the current
+// configuration until quit is closed.
+func (s *Server) watchTURN(quit <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(turnConfig(s.config()).Interval):
+			s.discoverTURN(turnConfig(s.config()))
+		case <-quit:
+			return
+		}
+	}
+}
+
+// iceURLs returns the urls of the discovered turn servers followed by
+// those added with Advertise.
+func (s *Server) iceURLs() []string {
+	s.imu.RLock()
+	defer s.imu.RUnlock()
+
+	urls := make([]string, 0, len(s.discovered)+len(s.advertised))
+	urls = append(urls, s.discovered...)
+	return append(urls, s.advertised...)
+}
@@ -0,0 +1,106 @@
+package signaling
+
+import (
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/turn"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTURNConfig_ICEServers(t *testing.T) {
+	ts, err := turn.NewServer(net.IPv4(127, 0, 0, 1), "127.0.0.1:40310", "devnet.test")
+	require.NoError(t, err)
+	defer ts.Close()
+
+	hs := httptest.NewServer(turn.HealthHandler(&turn.Info{
+		Port:  40310,
+		Realm: "devnet.test",
+	}))
+	defer hs.Close()
+
+	tc := &TURNConfig{
+		Servers: []TURNServer{
+			{Host: "127.0.0.1", Port: 40310},
+			{Host: "127.0.0.1", Port: 40311},
+			{Health: hs.URL + turn.HealthPath},
+			{Health: "http://127.0.0.1:1/health"},
+		},
+		Timeout: 200 * time.Millisecond,
+	}
+	want := []string{
+		"stun:127.0.0.1:40310",
+		"turn:127.0.0.1:40310?transport=udp",
+		"stun:127.0.0.1:40310",
+		"turn:127.0.0.1:40310?transport=udp",
+	}
+	assert.Equal(t, want, tc.ICEServers())
+}
+
+func TestTURNServer_Info(t *testing.T) {
+	hs := httptest.NewServer(turn.HealthHandler(&turn.Info{
+		Host:  "internal.devnet.test",
+		Port:  3478,
+		Realm: "devnet.test",
+	}))
+	defer hs.Close()
+
+	ts := &TURNServer{
+		Host:       "devnet.test",
+		Transports: []string{"tcp"},
+		Health:     hs.URL,
+	}
+	i, err := ts.info(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, &turn.Info{
+		Host:       "devnet.test",
+		Port:       3478,
+		Realm:      "devnet.test",
+		Transports: []string{"tcp"},
+	}, i)
+}
+
+func TestServer_DiscoverTURN(t *testing.T) {
+	turnConf := map[string]interface{}{
+		"servers":  []map[string]interface{}{{"host": "127.0.0.1", "port": 40312}},
+		"timeout":  "100ms",
+		"interval": "50ms",
+	}
+	c := viper.New()
+	for k, v := range conf.AllSettings() {
+		c.Set(k, v)
+	}
+	c.Set("signaling.turn", turnConf)
+	s := NewServer(c)
+	assert.Empty(t, s.discovered, "unreachable server advertised")
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go s.watchTURN(quit)
+
+	ts, err := turn.NewServer(net.IPv4(127, 0, 0, 1), "127.0.0.1:40312", "devnet.test")
+	require.NoError(t, err)
+	defer ts.Close()
+
+	want := []string{"stun:127.0.0.1:40312", "turn:127.0.0.1:40312?transport=udp"}
+	assert.Eventually(t, func() bool {
+		urls := s.iceURLs()
+		return len(urls) >= 2 && reflect.DeepEqual(want, urls[:2])
+	}, 2*time.Second, 10*time.Millisecond, "reachable server not advertised")
+
+	t.Run("reload", func(t *testing.T) {
+		c := viper.New()
+		for k, v := range conf.AllSettings() {
+			c.Set(k, v)
+		}
+		require.NoError(t, s.Reload(c))
+		s.imu.RLock()
+		defer s.imu.RUnlock()
+		assert.Empty(t, s.discovered)
+	})
+}
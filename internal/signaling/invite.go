@@ -0,0 +1,156 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// defaultInviteTTL is the validity of invites issued without ttl.
+const defaultInviteTTL = 24 * time.Hour
+
+// InviteConfig defines the signing of invite tokens for guests.
+type InviteConfig struct {
+	Secret string
+
+	// TTL is the validity of invites issued without explicit ttl.
+	TTL time.Duration
+}
+
+// inviteRequest is the body of an invite request to the admin API.
+type inviteRequest struct {
+	Channel  string `json:"channel"`
+	TTL      string `json:"ttl"`
+	MaxUses  int    `json:"max_uses"`
+	ViewOnly bool   `json:"view_only"`
+}
+
+func (s *Server) configureInvites(conf *viper.Viper) {
+	var ic InviteConfig
+	if err := conf.UnmarshalKey("signaling.invites", &ic); err != nil {
+		log.Error().Err(err).Msg("unmarshal invite config")
+	}
+	if ic.Secret == "" {
+		log.Error().Msg("invite secret missing, invites disabled")
+		return
+	}
+	if ic.TTL <= 0 {
+		ic.TTL = defaultInviteTTL
+	}
+	s.invites = auth.NewInvites(ic.Secret)
+	s.inviteTTL = ic.TTL
+}
+
+// serveInvites issues an invite token for the channel in the JSON request
+// body.
+func (s *Server) serveInvites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	if s.invites == nil {
+		http.Error(w, "invites disabled", http.StatusNotFound)
+		return
+	}
+
+	var req inviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.channel(req.Channel); !ok {
+		http.Error(w, "unknown channel", http.StatusBadRequest)
+		return
+	}
+	ttl := s.inviteTTL
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	inv := auth.Invite{
+		Channel:  req.Channel,
+		Expires:  time.Now().Add(ttl).UTC().Truncate(time.Second),
+		MaxUses:  req.MaxUses,
+		ViewOnly: req.ViewOnly,
+	}
+	token, err := s.invites.Issue(inv)
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("issue invite")
+		code := http.StatusInternalServerError
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	hlog.FromRequest(r).Info().
+		Str("channel", inv.Channel).
+		Time("expires", inv.Expires).
+		Int("max_uses", inv.MaxUses).
+		Bool("view_only", inv.ViewOnly).
+		Msg("invite issued")
+
+	writeJSON(w, r, struct {
+		Token   string    `json:"token"`
+		Expires time.Time `json:"expires"`
+	}{
+		Token:   token,
+		Expires: inv.Expires,
+	})
+}
+
+// identified is implemented by clients with an authenticated identity.
+type identified interface {
+	Identity() *auth.Identity
+}
+
+func identityOf(c Client) *auth.Identity {
+	if i, ok := c.(identified); ok {
+		return i.Identity()
+	}
+	return nil
+}
+
+// guestRestriction returns the reason why the guest src may not send f to
+// the user dst with identity dstID or an empty string if it is permitted.
+// View-only guests may not initiate calls or send control frames. Guests
+// may only reach users of the channel of their invite. dstID is nil for
+// remote or absent users.
+func (m *moderation) guestRestriction(src *auth.Identity, dst string, dstID *auth.Identity, f *proto.Frame) string {
+	if src == nil || !src.Guest {
+		return ""
+	}
+	if src.ViewOnly {
+		switch p := f.Payload.(type) {
+		case *proto.Frame_Control:
+			return "view-only guest"
+		case *proto.Frame_Sdp:
+			if p.Sdp.Type == proto.SDP_OFFER {
+				return "view-only guest"
+			}
+		}
+	}
+	if m.channels == nil {
+		return "unknown channel"
+	}
+	c, ok := m.channels(src.Channel)
+	if !ok {
+		return "unknown channel"
+	}
+	if m.role(dst, dstID, &c) == store.RoleNone {
+		if dstID != nil && dstID.Guest {
+			return "guest of another channel"
+		}
+		return "not in channel"
+	}
+	return ""
+}
@@ -0,0 +1,261 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestInvite_GuestRestriction(t *testing.T) {
+	user := &auth.Identity{Name: "user1"}
+	guest := &auth.Identity{Name: "guest:a", Guest: true, Channel: "Standup"}
+	viewer := &auth.Identity{Name: "guest:b", Guest: true, Channel: "Standup", ViewOnly: true}
+	other := &auth.Identity{Name: "guest:c", Guest: true, Channel: "Other"}
+	lost := &auth.Identity{Name: "guest:d", Guest: true, Channel: "Deleted"}
+
+	offer := &proto.Frame{Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_OFFER}}}
+	answer := &proto.Frame{Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_ANSWER}}}
+	control := &proto.Frame{Payload: &proto.Frame_Control{Control: &proto.Control{}}}
+
+	m := newModeration()
+	m.channels = func(name string) (store.Channel, bool) {
+		switch name {
+		case "Standup":
+			return store.Channel{Name: name, Members: []string{"user1"}}, true
+		case "Other":
+			return store.Channel{Name: name}, true
+		}
+		return store.Channel{}, false
+	}
+
+	tests := []struct {
+		desc    string
+		giveSrc *auth.Identity
+		giveDst *auth.Identity
+		give    *proto.Frame
+		want    string
+	}{
+		{
+			desc:    "user",
+			giveSrc: user,
+			giveDst: other,
+			give:    control,
+		},
+		{
+			desc: "unidentified",
+			give: offer,
+		},
+		{
+			desc:    "guest offer",
+			giveSrc: guest,
+			giveDst: user,
+			give:    offer,
+		},
+		{
+			desc:    "guest offer to unrelated user",
+			giveSrc: guest,
+			giveDst: &auth.Identity{Name: "user2"},
+			give:    offer,
+			want:    "not in channel",
+		},
+		{
+			desc:    "guest of unknown channel",
+			giveSrc: lost,
+			giveDst: user,
+			give:    offer,
+			want:    "unknown channel",
+		},
+		{
+			desc:    "guest to guest of same channel",
+			giveSrc: guest,
+			giveDst: viewer,
+			give:    offer,
+		},
+		{
+			desc:    "guest to guest of other channel",
+			giveSrc: guest,
+			giveDst: other,
+			give:    offer,
+			want:    "guest of another channel",
+		},
+		{
+			desc:    "view-only offer",
+			giveSrc: viewer,
+			giveDst: user,
+			give:    offer,
+			want:    "view-only guest",
+		},
+		{
+			desc:    "view-only answer",
+			giveSrc: viewer,
+			giveDst: user,
+			give:    answer,
+		},
+		{
+			desc:    "view-only control",
+			giveSrc: viewer,
+			giveDst: user,
+			give:    control,
+			want:    "view-only guest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var dst string
+			if tt.giveDst != nil {
+				dst = tt.giveDst.Name
+			}
+			assert.Equal(t, tt.want, m.guestRestriction(tt.giveSrc, dst, tt.giveDst, tt.give))
+		})
+	}
+
+	t.Run("absent member", func(t *testing.T) {
+		assert.Empty(t, m.guestRestriction(guest, "user1", nil, offer))
+	})
+	t.Run("kicked member", func(t *testing.T) {
+		m.banned["Standup"] = map[string]bool{"user1": true}
+		defer delete(m.banned, "Standup")
+		assert.Equal(t, "not in channel", m.guestRestriction(guest, "user1", user, offer))
+	})
+}
+
+type guestClient struct {
+	bufClient
+	id *auth.Identity
+}
+
+func (c *guestClient) Identity() *auth.Identity {
+	return c.id
+}
+
+func TestSwitch_Guest(t *testing.T) {
+	viewer := &guestClient{
+		bufClient: bufClient{name: "guest:viewer", send: make(chan *proto.Frame, 1)},
+		id:        &auth.Identity{Name: "guest:viewer", Guest: true, Channel: "Lobby", ViewOnly: true},
+	}
+	host := &bufClient{name: "host", send: make(chan *proto.Frame, 1)}
+
+	sw := NewSwitch()
+	sw.SetChannels(func(name string) (store.Channel, bool) {
+		return store.Channel{Name: name, Members: []string{"host"}}, name == "Lobby"
+	})
+	go sw.Run()
+	sw.Register(viewer)
+	sw.Register(host)
+	defer sw.Shutdown()
+
+	sw.Forward() <- &proto.Frame{
+		Src:     "guest:viewer",
+		Dst:     "host",
+		Id:      1,
+		Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_OFFER}},
+	}
+	want := &proto.Frame{
+		Src:     "host",
+		Dst:     "guest:viewer",
+		Payload: proto.PayloadWithError(proto.Error_FORBIDDEN, "view-only guest", 1),
+	}
+	select {
+	case have := <-viewer.send:
+		assert.True(t, pb.Equal(want, have), "have: %v", have)
+	case <-time.After(time.Second):
+		t.Fatal("receive timeout")
+	}
+
+	answer := &proto.Frame{
+		Src:     "guest:viewer",
+		Dst:     "host",
+		Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_ANSWER}},
+	}
+	sw.Forward() <- answer
+	select {
+	case have := <-host.send:
+		assert.True(t, pb.Equal(answer, have), "have: %v", have)
+	case <-time.After(time.Second):
+		t.Fatal("receive timeout")
+	}
+
+	impostor := newGuestClient("guest:viewer", "Lobby")
+	sw.Register(impostor)
+	have := receive(t, impostor.send)
+	assert.Equal(t, "name already taken", have.GetError().GetMessage())
+	_, ok := <-impostor.send
+	assert.False(t, ok, "refused client should be closed")
+	select {
+	case <-viewer.send:
+		t.Error("guest should not be replaced")
+	default:
+	}
+}
+
+func TestAdmin_Invites(t *testing.T) {
+	s := newAdminTestServer(t)
+	h := s.adminHandler()
+
+	tests := []struct {
+		desc     string
+		give     string
+		wantCode int
+	}{
+		{
+			desc:     "issue",
+			give:     `{"channel":"Lobby","ttl":"1h","max_uses":2,"view_only":true}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			desc:     "default ttl",
+			give:     `{"channel":"Lobby"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			desc:     "unknown channel",
+			give:     `{"channel":"Unknown"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			desc:     "invalid ttl",
+			give:     `{"channel":"Lobby","ttl":"-1h"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			desc:     "invalid body",
+			give:     `{`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/invites", strings.NewReader(tt.give))
+			req.SetBasicAuth("testuser", "test")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var have struct {
+				Token   string
+				Expires time.Time
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&have))
+			assert.True(t, have.Expires.After(time.Now()))
+
+			inv, err := s.invites.Redeem(have.Token, "alice")
+			require.NoError(t, err)
+			assert.Equal(t, "Lobby", inv.Channel)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/lx7/devnet/proto"
+)
+
+// Limits defines the restrictions applied to frames received from a client.
+type Limits struct {
+	// FrameSize is the maximum size of a frame in bytes. Zero disables the
+	// size check.
+	FrameSize int64 `mapstructure:"frame_size"`
+
+	// Rates maps payload types to token bucket limits. The key "default"
+	// applies to all payload types without a specific entry.
+	Rates map[string]Rate
+
+	// Abuse limits the number of discarded frames. A client that exceeds it
+	// is disconnected.
+	Abuse Rate
+}
+
+// Rate defines a token bucket that is refilled with Rate tokens per second
+// and holds at most Burst tokens. A zero Rate disables the limit.
+type Rate struct {
+	Rate  float64
+	Burst float64
+}
+
+// limiter enforces Limits for a single client. It is not safe for
+// concurrent use.
+type limiter struct {
+	buckets map[string]*bucket
+	abuse   *bucket
+}
+
+func newLimiter(l *Limits) *limiter {
+	lim := &limiter{
+		buckets: make(map[string]*bucket),
+	}
+	if l == nil {
+		return lim
+	}
+	for t, r := range l.Rates {
+		if r.Rate > 0 {
+			lim.buckets[t] = newBucket(r)
+		}
+	}
+	if l.Abuse.Rate > 0 {
+		lim.abuse = newBucket(l.Abuse)
+	}
+	return lim
+}
+
+// allow reports whether f may be forwarded.
+func (l *limiter) allow(f *proto.Frame) bool {
+	b, ok := l.buckets[payloadType(f)]
+	if !ok {
+		b, ok = l.buckets["default"]
+	}
+	if !ok {
+		return true
+	}
+	return b.take(time.Now())
+}
+
+// abusive records a discarded frame and reports whether the client has
+// exceeded the abuse limit.
+func (l *limiter) abusive() bool {
+	if l.abuse == nil {
+		return false
+	}
+	return !l.abuse.take(time.Now())
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(r Rate) *bucket {
+	burst := r.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{
+		rate:   r.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// take removes a token from the bucket. Returns false if the bucket is
+// empty.
+func (b *bucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// payloadType returns the name of the payload type of f as used in the
+// configuration.
+func payloadType(f *proto.Frame) string {
+	switch f.Payload.(type) {
+	case *proto.Frame_Config:
+		return "config"
+	case *proto.Frame_Ice:
+		return "ice"
+	case *proto.Frame_Sdp:
+		return "sdp"
+	case *proto.Frame_Control:
+		return "control"
+	case *proto.Frame_Error:
+		return "error"
+	case *proto.Frame_Ack:
+		return "ack"
+	case *proto.Frame_Notice:
+		return "notice"
+	case *proto.Frame_Hello:
+		return "hello"
+	case *proto.Frame_Welcome:
+		return "welcome"
+	case *proto.Frame_Chat:
+		return "chat"
+	case *proto.Frame_FileOffer:
+		return "file_offer"
+	case *proto.Frame_Share:
+		return "share"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,85 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimit_Bucket(t *testing.T) {
+	b := newBucket(Rate{Rate: 1, Burst: 2})
+	now := b.last
+
+	assert.True(t, b.take(now), "first token should be available")
+	assert.True(t, b.take(now), "second token should be available")
+	assert.False(t, b.take(now), "bucket should be empty")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.False(t, b.take(now), "bucket should not be refilled yet")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, b.take(now), "bucket should be refilled")
+
+	now = now.Add(10 * time.Second)
+	assert.True(t, b.take(now))
+	assert.True(t, b.take(now))
+	assert.False(t, b.take(now), "refill should not exceed burst")
+}
+
+func TestLimit_Limiter(t *testing.T) {
+	ice := &proto.Frame{Payload: &proto.Frame_Ice{Ice: &proto.ICE{}}}
+	sdp := &proto.Frame{Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{}}}
+	none := &proto.Frame{}
+
+	tests := []struct {
+		desc string
+		give *Limits
+		send []*proto.Frame
+		want []bool
+	}{
+		{
+			desc: "no limits",
+			give: nil,
+			send: []*proto.Frame{sdp, sdp, sdp},
+			want: []bool{true, true, true},
+		},
+		{
+			desc: "payload type limit",
+			give: &Limits{Rates: map[string]Rate{
+				"sdp": {Rate: 0.001, Burst: 1},
+			}},
+			send: []*proto.Frame{sdp, ice, sdp, ice},
+			want: []bool{true, true, false, true},
+		},
+		{
+			desc: "default limit",
+			give: &Limits{Rates: map[string]Rate{
+				"default": {Rate: 0.001, Burst: 2},
+				"ice":     {Rate: 0.001, Burst: 3},
+			}},
+			send: []*proto.Frame{none, sdp, none, ice, ice, ice, ice},
+			want: []bool{true, true, false, true, true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			l := newLimiter(tt.give)
+			for i, f := range tt.send {
+				assert.Equal(t, tt.want[i], l.allow(f), "frame #%v", i)
+			}
+		})
+	}
+}
+
+func TestLimit_Abuse(t *testing.T) {
+	l := newLimiter(nil)
+	assert.False(t, l.abusive(), "no abuse limit configured")
+
+	l = newLimiter(&Limits{Abuse: Rate{Rate: 0.001, Burst: 2}})
+	assert.False(t, l.abusive())
+	assert.False(t, l.abusive())
+	assert.True(t, l.abusive(), "abuse limit should be exceeded")
+}
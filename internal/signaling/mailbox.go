@@ -0,0 +1,95 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+)
+
+// MailboxConfig defines which frames are stored for absent users.
+type MailboxConfig struct {
+	// Types lists the payload types to store. The type "offer" matches SDP
+	// offers, i.e. call invites.
+	Types []string
+
+	// TTL is the maximum time a frame is kept.
+	TTL time.Duration
+
+	// Size is the maximum number of frames kept per user. The oldest frame is
+	// dropped if the mailbox is full.
+	Size int
+}
+
+// mailbox stores frames for absent users until their next registration. It
+// is owned by the switch run loop and not safe for concurrent use.
+type mailbox struct {
+	types map[string]bool
+	ttl   time.Duration
+	size  int
+	boxes map[string][]*proto.Frame
+}
+
+func newMailbox(conf *MailboxConfig) *mailbox {
+	m := &mailbox{
+		types: make(map[string]bool),
+		ttl:   conf.TTL,
+		size:  conf.Size,
+		boxes: make(map[string][]*proto.Frame),
+	}
+	for _, t := range conf.Types {
+		m.types[t] = true
+	}
+	return m
+}
+
+// store keeps f for later delivery. Returns false if f is not accepted.
+// Frames handed off by another node keep their original queue time.
+func (m *mailbox) store(f *proto.Frame) bool {
+	if m == nil || m.size <= 0 || !m.types[mailType(f)] || !auth.Exists(f.Dst) {
+		return false
+	}
+
+	now := time.Now()
+	box := m.unexpired(m.boxes[f.Dst], now)
+	if len(box) >= m.size {
+		log.Debug().Str("user", f.Dst).Msg("mailbox full, dropping oldest message")
+		box = box[1:]
+	}
+	if f.Queued == 0 {
+		f.Queued = now.Unix()
+	}
+	m.boxes[f.Dst] = append(box, f)
+	return true
+}
+
+// collect removes and returns all unexpired frames stored for name.
+func (m *mailbox) collect(name string) []*proto.Frame {
+	if m == nil {
+		return nil
+	}
+	box := m.unexpired(m.boxes[name], time.Now())
+	delete(m.boxes, name)
+	return box
+}
+
+func (m *mailbox) unexpired(box []*proto.Frame, now time.Time) []*proto.Frame {
+	if m.ttl <= 0 {
+		return box
+	}
+	deadline := now.Add(-m.ttl).Unix()
+	for len(box) > 0 && box[0].Queued < deadline {
+		box = box[1:]
+	}
+	return box
+}
+
+// mailType returns the payload type of f as used in the mailbox
+// configuration.
+func mailType(f *proto.Frame) string {
+	if pl, ok := f.Payload.(*proto.Frame_Sdp); ok && pl.Sdp.Type == proto.SDP_OFFER {
+		return "offer"
+	}
+	return payloadType(f)
+}
@@ -0,0 +1,128 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailbox(t *testing.T) {
+	require.NoError(t, auth.Configure(conf.Sub("auth")))
+
+	offer := func(dst string) *proto.Frame {
+		return &proto.Frame{
+			Src:     "user1",
+			Dst:     dst,
+			Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_OFFER}},
+		}
+	}
+	answer := &proto.Frame{
+		Src:     "user1",
+		Dst:     "user2",
+		Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_ANSWER}},
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		var m *mailbox
+		assert.False(t, m.store(offer("user2")))
+		assert.Empty(t, m.collect("user2"))
+	})
+
+	t.Run("payload types", func(t *testing.T) {
+		m := newMailbox(&MailboxConfig{Types: []string{"offer"}, Size: 5})
+		assert.True(t, m.store(offer("user2")), "offer should be stored")
+		assert.False(t, m.store(answer), "answer should not be stored")
+		assert.False(t, m.store(offer("unknown")), "unknown user")
+
+		box := m.collect("user2")
+		require.Len(t, box, 1)
+		assert.NotZero(t, box[0].Queued)
+		assert.Empty(t, m.collect("user2"), "mailbox should be empty")
+	})
+
+	t.Run("notifications", func(t *testing.T) {
+		m := newMailbox(&MailboxConfig{Types: []string{"chat", "file_offer"}, Size: 5})
+		assert.True(t, m.store(&proto.Frame{
+			Dst:     "user2",
+			Payload: proto.PayloadWithChat("hello"),
+		}))
+		assert.True(t, m.store(&proto.Frame{
+			Dst:     "user2",
+			Payload: proto.PayloadWithFileOffer("f1", "notes.txt", 42, "text/plain"),
+		}))
+		assert.Len(t, m.collect("user2"), 2)
+	})
+
+	t.Run("handed off", func(t *testing.T) {
+		m := newMailbox(&MailboxConfig{Types: []string{"offer"}, Size: 5})
+		f := offer("user2")
+		f.Queued = 1600000000
+		assert.True(t, m.store(f))
+		assert.Equal(t, int64(1600000000), m.collect("user2")[0].Queued, "queue time should be kept")
+	})
+
+	t.Run("size", func(t *testing.T) {
+		m := newMailbox(&MailboxConfig{Types: []string{"offer"}, Size: 2})
+		for i := uint64(1); i <= 3; i++ {
+			f := offer("user2")
+			f.Id = i
+			assert.True(t, m.store(f))
+		}
+
+		box := m.collect("user2")
+		require.Len(t, box, 2)
+		assert.Equal(t, uint64(2), box[0].Id, "oldest frame should be dropped")
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		m := newMailbox(&MailboxConfig{
+			Types: []string{"offer"},
+			Size:  2,
+			TTL:   time.Hour,
+		})
+		assert.True(t, m.store(offer("user2")))
+		m.boxes["user2"][0].Queued -= 7200
+
+		assert.Empty(t, m.collect("user2"), "frame should be expired")
+	})
+}
+
+func TestSwitch_Mailbox(t *testing.T) {
+	require.NoError(t, auth.Configure(conf.Sub("auth")))
+
+	sender := &bufClient{name: "user1", send: make(chan *proto.Frame, 1)}
+	receiver := &bufClient{name: "user2", send: make(chan *proto.Frame, 1)}
+
+	sw := NewSwitch()
+	sw.EnableMailbox(&MailboxConfig{Types: []string{"offer"}, Size: 1})
+	go sw.Run()
+	sw.Register(sender)
+
+	sw.Forward() <- &proto.Frame{
+		Src:     "user1",
+		Dst:     "user2",
+		Id:      1,
+		Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_OFFER}},
+	}
+
+	select {
+	case f := <-sender.send:
+		assert.Equal(t, proto.Error_PEER_OFFLINE, f.GetError().GetCode())
+	case <-time.After(1 * time.Second):
+		t.Error("receive timeout")
+	}
+
+	sw.Register(receiver)
+	select {
+	case f := <-receiver.send:
+		assert.Equal(t, uint64(1), f.Id, "stored frame should be delivered")
+		assert.NotZero(t, f.Queued)
+	case <-time.After(1 * time.Second):
+		t.Error("receive timeout")
+	}
+	sw.Shutdown()
+}
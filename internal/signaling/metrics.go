@@ -0,0 +1,65 @@
+package signaling
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics implements an Observer that counts the clients connected to the
+// local switch and the frames delivered to them.
+type Metrics struct {
+	online    int64
+	forwarded uint64
+}
+
+// MetricsSnapshot holds the signaling metrics of a node.
+type MetricsSnapshot struct {
+	Online    int64  `json:"online"`
+	Forwarded uint64 `json:"forwarded"`
+	Calls     int    `json:"calls"`
+}
+
+// Notify implements the Observer interface.
+func (m *Metrics) Notify(e *Event) {
+	switch e.Type {
+	case EventOnline:
+		atomic.AddInt64(&m.online, 1)
+	case EventOffline:
+		atomic.AddInt64(&m.online, -1)
+	case EventForward:
+		atomic.AddUint64(&m.forwarded, 1)
+	}
+}
+
+// AddMetrics adds the metrics returned by f to the admin API under name,
+// e.g. those of a turn server in the same process. f must be safe for
+// concurrent use. AddMetrics must be called before Serve.
+func (s *Server) AddMetrics(name string, f func() interface{}) {
+	if s.collectors == nil {
+		s.collectors = make(map[string]func() interface{})
+	}
+	s.collectors[name] = f
+}
+
+// serveMetrics returns the signaling metrics of this node and those added
+// with AddMetrics as JSON.
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	m := MetricsSnapshot{
+		Online:    atomic.LoadInt64(&s.metrics.online),
+		Forwarded: atomic.LoadUint64(&s.metrics.forwarded),
+	}
+	if s.calls != nil {
+		m.Calls = len(s.calls.Active(""))
+	}
+	res := map[string]interface{}{"signaling": m}
+	for name, f := range s.collectors {
+		res[name] = f()
+	}
+	writeJSON(w, r, res)
+}
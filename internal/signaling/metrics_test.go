@@ -0,0 +1,36 @@
+package signaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newAdminTestServer(t)
+	s.AddMetrics("turn", func() interface{} {
+		return map[string]int{"allocations": 2}
+	})
+	for _, e := range []*Event{
+		{Type: EventOnline, User: "user1"},
+		{Type: EventOnline, User: "user2"},
+		{Type: EventForward, User: "user2"},
+		{Type: EventOffline, User: "user1"},
+	} {
+		s.metrics.Notify(e)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.SetBasicAuth("testuser", "test")
+	rr := httptest.NewRecorder()
+	s.adminHandler().ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"signaling": {"online": 1, "forwarded": 1, "calls": 0},
+		"turn": {"allocations": 2}
+	}`, rr.Body.String())
+}
@@ -0,0 +1,212 @@
+package signaling
+
+import (
+	"sort"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+)
+
+// moderation holds the state changed by moderator actions. It is only
+// accessed from the switch run loop. Bans last until a moderator sends
+// UNBAN, revoked remote control until RESTORE_CONTROL or the user goes
+// offline. In a cluster, locks and bans apply to the node that handled the
+// action and are lost on restart.
+type moderation struct {
+	channels func(name string) (store.Channel, bool)
+
+	// locked channels refuse new guest sessions
+	locked map[string]bool
+
+	// banned holds the users kicked per channel
+	banned map[string]map[string]bool
+
+	// revoked holds the users that no longer accept remote control. Only
+	// control frames through the switch are blocked; remote control over
+	// an established peer connection is refused by the client.
+	revoked map[string]bool
+}
+
+func newModeration() *moderation {
+	return &moderation{
+		locked:  make(map[string]bool),
+		banned:  make(map[string]map[string]bool),
+		revoked: make(map[string]bool),
+	}
+}
+
+// SetChannels sets the channel lookup used to authorize moderator actions.
+// Moderation is disabled without it. Must be called before Run.
+func (sw *DefaultSwitch) SetChannels(f func(name string) (store.Channel, bool)) {
+	sw.mod.channels = f
+}
+
+// admit returns the reason why client may not register or an empty string.
+func (m *moderation) admit(client Client) string {
+	id := identityOf(client)
+	if id == nil || !id.Guest {
+		return ""
+	}
+	if m.locked[id.Channel] {
+		return "channel locked"
+	}
+	if m.banned[id.Channel][id.Name] {
+		return "kicked from channel"
+	}
+	return ""
+}
+
+// forget clears the state of a user that went offline.
+func (m *moderation) forget(name string) {
+	delete(m.revoked, name)
+}
+
+// moderate authorizes and applies the moderator action in f. It returns
+// the reason why f is not permitted or an empty string. Control frames to
+// users that revoked remote control are not permitted.
+func (sw *DefaultSwitch) moderate(f *proto.Frame) string {
+	mod := f.Moderation()
+	if mod == nil {
+		if _, ok := f.Payload.(*proto.Frame_Control); ok && sw.mod.revoked[f.Dst] {
+			return "remote control revoked"
+		}
+		return ""
+	}
+	if sw.mod.channels == nil {
+		return "moderation disabled"
+	}
+	c, ok := sw.mod.channels(mod.Channel)
+	if !ok {
+		return "unknown channel"
+	}
+	actor := sw.mod.role(f.Src, identityOf(sw.clients[f.Src]), &c)
+	if actor < store.RoleModerator {
+		return "not a moderator"
+	}
+
+	switch mod.Action {
+	case proto.Control_Moderation_LOCK, proto.Control_Moderation_UNLOCK:
+		sw.mod.locked[c.Name] = mod.Action == proto.Control_Moderation_LOCK
+		sw.announce(&c, f)
+	case proto.Control_Moderation_UNBAN:
+		if !sw.mod.banned[c.Name][f.Dst] {
+			return "not kicked"
+		}
+		if roleOf(f.Dst, identityOf(sw.clients[f.Dst]), &c) >= actor {
+			return "insufficient role"
+		}
+		delete(sw.mod.banned[c.Name], f.Dst)
+	case proto.Control_Moderation_KICK,
+		proto.Control_Moderation_STOP_SHARE,
+		proto.Control_Moderation_REVOKE_CONTROL,
+		proto.Control_Moderation_RESTORE_CONTROL:
+		target := sw.mod.role(f.Dst, identityOf(sw.clients[f.Dst]), &c)
+		if target == store.RoleNone {
+			return "not in channel"
+		}
+		if target >= actor {
+			return "insufficient role"
+		}
+		switch mod.Action {
+		case proto.Control_Moderation_REVOKE_CONTROL:
+			sw.mod.revoked[f.Dst] = true
+		case proto.Control_Moderation_RESTORE_CONTROL:
+			delete(sw.mod.revoked, f.Dst)
+		case proto.Control_Moderation_KICK:
+			mod.Users = sw.participants(&c, f.Dst)
+			if sw.mod.banned[c.Name] == nil {
+				sw.mod.banned[c.Name] = make(map[string]bool)
+			}
+			sw.mod.banned[c.Name][f.Dst] = true
+		}
+	default:
+		return "unknown action"
+	}
+
+	log.Info().
+		Str("user", f.Src).
+		Str("target", f.Dst).
+		Str("channel", c.Name).
+		Stringer("action", mod.Action).
+		Msg("moderator action")
+	return ""
+}
+
+// channelAction reports whether mod changes the channel rather than acting
+// on a connected user. Channel actions are applied by the switch and not
+// forwarded to the destination.
+func channelAction(mod *proto.Control_Moderation) bool {
+	switch mod.GetAction() {
+	case proto.Control_Moderation_LOCK,
+		proto.Control_Moderation_UNLOCK,
+		proto.Control_Moderation_UNBAN:
+		return true
+	}
+	return false
+}
+
+// participants returns the connected users with a role in c except
+// exclude, including the users of other nodes.
+func (sw *DefaultSwitch) participants(c *store.Channel, exclude string) []string {
+	users := []string{}
+	for name, client := range sw.clients {
+		if name != exclude && sw.mod.role(name, identityOf(client), c) != store.RoleNone {
+			users = append(users, name)
+		}
+	}
+	if sw.router != nil {
+		for _, name := range sw.router.online() {
+			if _, ok := sw.clients[name]; ok {
+				continue
+			}
+			if name != exclude && sw.mod.role(name, nil, c) != store.RoleNone {
+				users = append(users, name)
+			}
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// announce sends the channel action in f to all local participants of c
+// except the sender.
+func (sw *DefaultSwitch) announce(c *store.Channel, f *proto.Frame) {
+	for name, client := range sw.clients {
+		if name == f.Src || sw.mod.role(name, identityOf(client), c) == store.RoleNone {
+			continue
+		}
+		select {
+		case client.Send() <- f:
+		default:
+			log.Warn().Str("user", name).Msg("send buffer full, discarding announcement")
+		}
+	}
+}
+
+// role returns the role of the user name with identity id in c. Users
+// kicked from c have no role.
+func (m *moderation) role(name string, id *auth.Identity, c *store.Channel) store.Role {
+	if m.banned[c.Name][name] {
+		return store.RoleNone
+	}
+	return roleOf(name, id, c)
+}
+
+// roleOf returns the role of the user name with identity id in c. Guests
+// only take part in the channel of their invite. id is nil for remote or
+// absent users.
+func roleOf(name string, id *auth.Identity, c *store.Channel) store.Role {
+	if id != nil && id.Guest {
+		switch {
+		case id.Channel != c.Name:
+			return store.RoleNone
+		case id.ViewOnly:
+			return store.RoleViewer
+		default:
+			return store.RoleMember
+		}
+	}
+	return c.Role(name)
+}
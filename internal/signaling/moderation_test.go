@@ -0,0 +1,186 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func receive(t *testing.T, c chan *proto.Frame) *proto.Frame {
+	t.Helper()
+	select {
+	case f := <-c:
+		return f
+	case <-time.After(time.Second):
+		t.Fatal("receive timeout")
+	}
+	return nil
+}
+
+func newGuestClient(name, channel string) *guestClient {
+	return &guestClient{
+		bufClient: bufClient{name: name, send: make(chan *proto.Frame, 2)},
+		id:        &auth.Identity{Name: name, Guest: true, Channel: channel},
+	}
+}
+
+func TestSwitch_Moderation(t *testing.T) {
+	standup := store.Channel{
+		Name:       "Standup",
+		Owner:      "owner",
+		Moderators: []string{"mod"},
+		Members:    []string{"member"},
+	}
+	owner := &bufClient{name: "owner", send: make(chan *proto.Frame, 2)}
+	mod := &bufClient{name: "mod", send: make(chan *proto.Frame, 2)}
+	member := &bufClient{name: "member", send: make(chan *proto.Frame, 2)}
+	guest := newGuestClient("guest:alice", "Standup")
+
+	sw := NewSwitch()
+	sw.SetChannels(func(name string) (store.Channel, bool) {
+		return standup, name == standup.Name
+	})
+	go sw.Run()
+	defer sw.Shutdown()
+	sw.Register(owner)
+	sw.Register(mod)
+	sw.Register(member)
+	sw.Register(guest)
+
+	action := func(src, dst string, a proto.Control_Moderation_Action) *proto.Frame {
+		return &proto.Frame{
+			Src:     src,
+			Dst:     dst,
+			Id:      1,
+			Payload: proto.PayloadWithModeration(a, "Standup"),
+		}
+	}
+	forbidden := func(t *testing.T, c chan *proto.Frame, msg string) {
+		t.Helper()
+		have := receive(t, c)
+		require.NotNil(t, have.GetError(), "have: %v", have)
+		assert.Equal(t, proto.Error_FORBIDDEN, have.GetError().Code)
+		assert.Equal(t, msg, have.GetError().Message)
+	}
+
+	t.Run("not a moderator", func(t *testing.T) {
+		sw.Forward() <- action("member", "guest:alice", proto.Control_Moderation_KICK)
+		forbidden(t, member.send, "not a moderator")
+	})
+
+	t.Run("unknown channel", func(t *testing.T) {
+		f := action("mod", "member", proto.Control_Moderation_KICK)
+		f.GetControl().Moderation.Channel = "Unknown"
+		sw.Forward() <- f
+		forbidden(t, mod.send, "unknown channel")
+	})
+
+	t.Run("not in channel", func(t *testing.T) {
+		outsider := &bufClient{name: "outsider", send: make(chan *proto.Frame, 2)}
+		sw.Register(outsider)
+		sw.Forward() <- action("mod", "outsider", proto.Control_Moderation_KICK)
+		forbidden(t, mod.send, "not in channel")
+	})
+
+	t.Run("insufficient role", func(t *testing.T) {
+		sw.Forward() <- action("mod", "owner", proto.Control_Moderation_STOP_SHARE)
+		forbidden(t, mod.send, "insufficient role")
+	})
+
+	t.Run("revoke control", func(t *testing.T) {
+		f := action("mod", "member", proto.Control_Moderation_REVOKE_CONTROL)
+		sw.Forward() <- f
+		assert.True(t, pb.Equal(f, receive(t, member.send)))
+
+		sw.Forward() <- &proto.Frame{
+			Src:     "owner",
+			Dst:     "member",
+			Payload: &proto.Frame_Control{Control: &proto.Control{}},
+		}
+		forbidden(t, owner.send, "remote control revoked")
+	})
+
+	t.Run("lock", func(t *testing.T) {
+		f := action("mod", "", proto.Control_Moderation_LOCK)
+		f.WantAck = true
+		sw.Forward() <- f
+		assert.NotNil(t, receive(t, mod.send).GetAck())
+		assert.True(t, pb.Equal(f, receive(t, member.send)))
+		assert.True(t, pb.Equal(f, receive(t, guest.send)))
+
+		late := newGuestClient("guest:bob", "Standup")
+		sw.Register(late)
+		forbidden(t, late.send, "channel locked")
+		_, ok := <-late.send
+		assert.False(t, ok, "refused client should be closed")
+
+		sw.Forward() <- action("mod", "", proto.Control_Moderation_UNLOCK)
+		receive(t, member.send)
+		receive(t, guest.send)
+	})
+
+	t.Run("kick guest", func(t *testing.T) {
+		f := action("mod", "guest:alice", proto.Control_Moderation_KICK)
+		sw.Forward() <- f
+		assert.True(t, pb.Equal(f, receive(t, guest.send)))
+		_, ok := <-guest.send
+		assert.False(t, ok, "kicked client should be closed")
+
+		again := newGuestClient("guest:alice", "Standup")
+		sw.Register(again)
+		forbidden(t, again.send, "kicked from channel")
+	})
+
+	t.Run("kick member", func(t *testing.T) {
+		// lock and unlock announcements
+		receive(t, owner.send)
+		receive(t, owner.send)
+
+		f := action("mod", "member", proto.Control_Moderation_KICK)
+		sw.Forward() <- f
+		have := receive(t, member.send)
+		assert.Equal(t, proto.Control_Moderation_KICK, have.Moderation().GetAction())
+		assert.Equal(t, []string{"mod", "owner"}, have.Moderation().GetUsers(),
+			"the kicked user should hang up on the channel participants")
+
+		// the member stays connected but is no longer part of the channel
+		sw.Forward() <- action("owner", "member", proto.Control_Moderation_STOP_SHARE)
+		forbidden(t, owner.send, "not in channel")
+		msg := &proto.Frame{Src: "owner", Dst: "member", Payload: proto.PayloadWithChat("hi")}
+		sw.Forward() <- msg
+		assert.True(t, pb.Equal(msg, receive(t, member.send)))
+	})
+
+	t.Run("unban", func(t *testing.T) {
+		f := action("mod", "member", proto.Control_Moderation_UNBAN)
+		f.WantAck = true
+		sw.Forward() <- f
+		assert.NotNil(t, receive(t, mod.send).GetAck())
+
+		sw.Forward() <- action("mod", "member", proto.Control_Moderation_UNBAN)
+		forbidden(t, mod.send, "not kicked")
+
+		// the member is part of the channel again
+		sw.Forward() <- action("owner", "member", proto.Control_Moderation_STOP_SHARE)
+		receive(t, member.send)
+	})
+
+	t.Run("restore control", func(t *testing.T) {
+		sw.Forward() <- action("mod", "member", proto.Control_Moderation_RESTORE_CONTROL)
+		receive(t, member.send)
+
+		f := &proto.Frame{
+			Src:     "owner",
+			Dst:     "member",
+			Payload: &proto.Frame_Control{Control: &proto.Control{}},
+		}
+		sw.Forward() <- f
+		assert.True(t, pb.Equal(f, receive(t, member.send)))
+	})
+}
@@ -0,0 +1,146 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/hlog"
+)
+
+// noticeRequest is the body of a notice request to the admin API.
+type noticeRequest struct {
+	Severity string `json:"severity"`
+	Text     string `json:"text"`
+	TTL      string `json:"ttl"`
+}
+
+// noticeResponse describes an active notice in the admin API.
+type noticeResponse struct {
+	Severity string     `json:"severity"`
+	Text     string     `json:"text"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+// maxNotices is the number of notices kept for clients registering later.
+const maxNotices = 16
+
+// notices keeps the broadcast notices until they expire or are cleared, so
+// that clients registering later receive them as well. Only the most
+// recent maxNotices are kept.
+type notices struct {
+	mu     sync.Mutex
+	frames []*proto.Frame
+}
+
+// add keeps f if it carries a notice that has not expired. The oldest
+// notice is discarded if maxNotices are kept.
+func (n *notices) add(f *proto.Frame) {
+	if nt := f.GetNotice(); nt == nil || nt.Expired(time.Now()) {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.frames) >= maxNotices {
+		n.frames = append(n.frames[:0], n.frames[1:]...)
+	}
+	n.frames = append(n.frames, f)
+}
+
+// clear discards all notices.
+func (n *notices) clear() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.frames = nil
+}
+
+// active returns the frames of the notices that have not expired at t in
+// the order they were added. Expired notices are discarded.
+func (n *notices) active(t time.Time) []*proto.Frame {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	active := n.frames[:0]
+	for _, f := range n.frames {
+		if !f.GetNotice().Expired(t) {
+			active = append(active, f)
+		}
+	}
+	n.frames = active
+	return append([]*proto.Frame(nil), active...)
+}
+
+// serveNotices returns the active notices as JSON. POST requests broadcast
+// the notice in the JSON request body to all clients, DELETE requests
+// discard all notices of this node. Clients that received a notice keep
+// it until it expires or they reconnect.
+func (s *Server) serveNotices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		s.local.ClearNotices()
+		hlog.FromRequest(r).Info().Msg("notices cleared")
+	case http.MethodPost:
+		f, msg := noticeFrame(r)
+		if msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		nt := f.GetNotice()
+		hlog.FromRequest(r).Info().
+			Stringer("severity", nt.Severity).
+			Str("text", nt.Text).
+			Int64("expires", nt.Expires).
+			Msg("broadcasting notice")
+		s.sw.Broadcast(f)
+	default:
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	res := []noticeResponse{}
+	for _, f := range s.local.Notices() {
+		nt := f.GetNotice()
+		nr := noticeResponse{Severity: nt.Severity.String(), Text: nt.Text}
+		if t := nt.ExpiresAt(); !t.IsZero() {
+			nr.Expires = &t
+		}
+		res = append(res, nr)
+	}
+	writeJSON(w, r, res)
+}
+
+// noticeFrame returns the broadcast frame for the notice in the request
+// body or the reason it is invalid.
+func noticeFrame(r *http.Request) (*proto.Frame, string) {
+	var req noticeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, "invalid request body"
+	}
+	if req.Text == "" {
+		return nil, "text missing"
+	}
+	severity := proto.Notice_INFO
+	if req.Severity != "" {
+		v, ok := proto.Notice_Severity_value[strings.ToUpper(req.Severity)]
+		if !ok {
+			return nil, "invalid severity"
+		}
+		severity = proto.Notice_Severity(v)
+	}
+	var expires time.Time
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, "invalid ttl"
+		}
+		expires = time.Now().Add(ttl)
+	}
+	return &proto.Frame{
+		Payload: proto.PayloadWithNotice(severity, req.Text, expires),
+	}, ""
+}
@@ -0,0 +1,170 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestNotices(t *testing.T) {
+	now := time.Now()
+	n := &notices{}
+	n.add(&proto.Frame{Payload: proto.PayloadWithNotice(proto.Notice_INFO, "expired", now.Add(-time.Second))})
+	n.add(&proto.Frame{Payload: proto.PayloadWithNotice(proto.Notice_INFO, "permanent", time.Time{})})
+	n.add(&proto.Frame{Payload: proto.PayloadWithNotice(proto.Notice_WARNING, "restart", now.Add(time.Minute))})
+	n.add(&proto.Frame{Payload: proto.PayloadWithAck(1)})
+
+	have := n.active(now)
+	require.Len(t, have, 2)
+	assert.Equal(t, "permanent", have[0].GetNotice().Text)
+	assert.Equal(t, "restart", have[1].GetNotice().Text)
+
+	have = n.active(now.Add(time.Hour))
+	require.Len(t, have, 1)
+	assert.Equal(t, "permanent", have[0].GetNotice().Text)
+
+	t.Run("limit", func(t *testing.T) {
+		for i := 0; i < maxNotices; i++ {
+			n.add(&proto.Frame{Payload: proto.PayloadWithNotice(proto.Notice_INFO, "more", time.Time{})})
+		}
+		have := n.active(now)
+		require.Len(t, have, maxNotices)
+		assert.Equal(t, "more", have[0].GetNotice().Text, "oldest notice discarded")
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		n.clear()
+		assert.Empty(t, n.active(now))
+	})
+}
+
+func TestSwitch_Broadcast(t *testing.T) {
+	sw := NewSwitch()
+	go sw.Run()
+	defer sw.Shutdown()
+
+	alice := &bufClient{name: "alice", send: make(chan *proto.Frame, 1)}
+	sw.Register(alice)
+
+	notice := &proto.Frame{
+		Payload: proto.PayloadWithNotice(proto.Notice_WARNING, "restart", time.Now().Add(time.Minute)),
+	}
+	sw.Broadcast(notice)
+	select {
+	case have := <-alice.send:
+		assert.True(t, pb.Equal(notice, have), "have: %v", have)
+	case <-time.After(time.Second):
+		t.Fatal("receive timeout")
+	}
+
+	bob := &bufClient{name: "bob", send: make(chan *proto.Frame, 1)}
+	sw.Register(bob)
+	select {
+	case have := <-bob.send:
+		assert.True(t, pb.Equal(notice, have), "have: %v", have)
+	case <-time.After(time.Second):
+		t.Fatal("receive timeout")
+	}
+	assert.Len(t, sw.Notices(), 1)
+}
+
+func TestAdmin_Notices(t *testing.T) {
+	s := newAdminTestServer(t)
+	h := s.adminHandler()
+	go s.sw.Run()
+	defer s.sw.Shutdown()
+
+	tests := []struct {
+		desc     string
+		giveMeth string
+		giveBody string
+		wantCode int
+		wantLen  int
+	}{
+		{
+			desc:     "no notices",
+			giveMeth: "GET",
+			wantCode: http.StatusOK,
+			wantLen:  0,
+		},
+		{
+			desc:     "broadcast notice",
+			giveMeth: "POST",
+			giveBody: `{"severity":"warning","text":"restart at 12:00","ttl":"1h"}`,
+			wantCode: http.StatusOK,
+			wantLen:  1,
+		},
+		{
+			desc:     "default severity",
+			giveMeth: "POST",
+			giveBody: `{"text":"welcome"}`,
+			wantCode: http.StatusOK,
+			wantLen:  2,
+		},
+		{
+			desc:     "text missing",
+			giveMeth: "POST",
+			giveBody: `{"severity":"info"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			desc:     "invalid severity",
+			giveMeth: "POST",
+			giveBody: `{"severity":"fatal","text":"restart"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			desc:     "invalid ttl",
+			giveMeth: "POST",
+			giveBody: `{"text":"restart","ttl":"-1h"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			desc:     "invalid method",
+			giveMeth: "PUT",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tt.giveMeth, "/notices", strings.NewReader(tt.giveBody))
+			req.SetBasicAuth("testuser", "test")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			require.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var have []noticeResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&have))
+			assert.Len(t, have, tt.wantLen)
+		})
+	}
+
+	have := s.local.Notices()
+	require.Len(t, have, 2)
+	assert.Equal(t, proto.Notice_WARNING, have[0].GetNotice().Severity)
+	assert.NotZero(t, have[0].GetNotice().Expires)
+	assert.Equal(t, proto.Notice_INFO, have[1].GetNotice().Severity)
+	assert.Zero(t, have[1].GetNotice().Expires)
+
+	t.Run("clear notices", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/notices", nil)
+		req.SetBasicAuth("testuser", "test")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `[]`, rr.Body.String())
+		assert.Empty(t, s.local.Notices())
+	})
+}
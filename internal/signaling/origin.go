@@ -0,0 +1,90 @@
+package signaling
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+)
+
+// OriginPolicy defines the origins that are allowed to open websocket
+// connections and to issue cross-origin requests.
+type OriginPolicy struct {
+	// SameOrigin allows requests from pages served by the signaling host.
+	SameOrigin bool `mapstructure:"same_origin"`
+
+	// Allowed lists additional origins. Wildcards match subdomains, e.g.
+	// "https://*.example.com". A single "*" allows all origins.
+	Allowed []string
+}
+
+// CheckOrigin implements the websocket.Upgrader CheckOrigin function. It
+// also guards the event stream transport.
+// Requests without an Origin header are not issued by browsers and
+// are always allowed.
+func (p *OriginPolicy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.allows(origin, r.Host) {
+		return true
+	}
+	log.Warn().
+		Str("origin", origin).
+		Str("src", r.RemoteAddr).
+		Msg("origin rejected")
+	return false
+}
+
+// CORS provides a http.Handler wrapper that sets the CORS headers for
+// allowed origins and answers preflight requests.
+func (p *OriginPolicy) CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !p.allows(origin, r.Host) {
+			hlog.FromRequest(r).Warn().
+				Str("origin", origin).
+				Msg("cross-origin request rejected")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", proto.StreamHeader)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, "+proto.StreamHeader)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *OriginPolicy) allows(origin, host string) bool {
+	origin = strings.ToLower(origin)
+	if p.SameOrigin {
+		if u, err := url.Parse(origin); err == nil && u.Host == strings.ToLower(host) {
+			return true
+		}
+	}
+	for _, pattern := range p.Allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package signaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrigin_CheckOrigin(t *testing.T) {
+	tests := []struct {
+		desc       string
+		givePolicy *OriginPolicy
+		giveOrigin string
+		want       bool
+	}{
+		{
+			desc:       "no origin header",
+			givePolicy: &OriginPolicy{},
+			giveOrigin: "",
+			want:       true,
+		},
+		{
+			desc:       "same origin",
+			givePolicy: &OriginPolicy{SameOrigin: true},
+			giveOrigin: "https://devnet.test",
+			want:       true,
+		},
+		{
+			desc:       "same origin disabled",
+			givePolicy: &OriginPolicy{},
+			giveOrigin: "https://devnet.test",
+			want:       false,
+		},
+		{
+			desc:       "foreign origin",
+			givePolicy: &OriginPolicy{SameOrigin: true},
+			giveOrigin: "https://evil.test",
+			want:       false,
+		},
+		{
+			desc: "exact match",
+			givePolicy: &OriginPolicy{
+				Allowed: []string{"https://app.example.com"},
+			},
+			giveOrigin: "https://APP.example.com",
+			want:       true,
+		},
+		{
+			desc: "wildcard match",
+			givePolicy: &OriginPolicy{
+				Allowed: []string{"https://*.example.com"},
+			},
+			giveOrigin: "https://app.example.com",
+			want:       true,
+		},
+		{
+			desc: "wildcard scheme mismatch",
+			givePolicy: &OriginPolicy{
+				Allowed: []string{"https://*.example.com"},
+			},
+			giveOrigin: "http://app.example.com",
+			want:       false,
+		},
+		{
+			desc: "wildcard suffix mismatch",
+			givePolicy: &OriginPolicy{
+				Allowed: []string{"https://*.example.com"},
+			},
+			giveOrigin: "https://app.example.com.evil.test",
+			want:       false,
+		},
+		{
+			desc: "allow all",
+			givePolicy: &OriginPolicy{
+				Allowed: []string{"*"},
+			},
+			giveOrigin: "https://evil.test",
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "https://devnet.test/channel", nil)
+			require.NoError(t, err)
+			if tt.giveOrigin != "" {
+				req.Header.Set("Origin", tt.giveOrigin)
+			}
+
+			assert.Equal(t, tt.want, tt.givePolicy.CheckOrigin(req))
+		})
+	}
+}
+
+func TestOrigin_CORS(t *testing.T) {
+	p := &OriginPolicy{Allowed: []string{"https://*.example.com"}}
+	handler := p.CORS(http.HandlerFunc(s200))
+
+	tests := []struct {
+		desc       string
+		giveMethod string
+		giveOrigin string
+		wantCode   int
+		wantHeader string
+	}{
+		{
+			desc:       "no origin",
+			giveMethod: "GET",
+			wantCode:   http.StatusOK,
+			wantHeader: "",
+		},
+		{
+			desc:       "allowed origin",
+			giveMethod: "GET",
+			giveOrigin: "https://app.example.com",
+			wantCode:   http.StatusOK,
+			wantHeader: "https://app.example.com",
+		},
+		{
+			desc:       "rejected origin",
+			giveMethod: "GET",
+			giveOrigin: "https://evil.test",
+			wantCode:   http.StatusOK,
+			wantHeader: "",
+		},
+		{
+			desc:       "preflight",
+			giveMethod: "OPTIONS",
+			giveOrigin: "https://app.example.com",
+			wantCode:   http.StatusNoContent,
+			wantHeader: "https://app.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req, err := http.NewRequest(tt.giveMethod, "https://devnet.test/", nil)
+			require.NoError(t, err)
+			if tt.giveOrigin != "" {
+				req.Header.Set("Origin", tt.giveOrigin)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantHeader, rr.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func s200(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,111 @@
+package signaling
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lx7/devnet/internal/listen"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// ProxyPolicy defines the reverse proxies that are trusted to report the
+// client address in the X-Forwarded-For header. Peers of a unix socket
+// listener are always trusted.
+type ProxyPolicy struct {
+	nets []*net.IPNet
+}
+
+// NewProxyPolicy returns a ProxyPolicy trusting the given addresses or
+// CIDR networks.
+func NewProxyPolicy(trusted []string) (*ProxyPolicy, error) {
+	p := &ProxyPolicy{}
+	for _, t := range trusted {
+		if !strings.Contains(t, "/") {
+			ip := net.ParseIP(t)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address: %v", t)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			p.nets = append(p.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network: %v", t)
+		}
+		p.nets = append(p.nets, n)
+	}
+	return p, nil
+}
+
+func (s *Server) configureProxies(conf *viper.Viper) {
+	p, err := NewProxyPolicy(conf.GetStringSlice("signaling.proxies"))
+	if err != nil {
+		log.Error().Err(err).Msg("configure trusted proxies")
+		return
+	}
+	s.proxies = p
+}
+
+// Handler provides a http.Handler wrapper that replaces the remote address
+// of requests from trusted proxies with the last untrusted address in the
+// X-Forwarded-For header.
+func (p *ProxyPolicy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if src := p.forwarded(r); src != "" {
+			r.RemoteAddr = src
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwarded returns the client address reported by a trusted proxy or an
+// empty string.
+func (p *ProxyPolicy) forwarded(r *http.Request) string {
+	if !p.trusted(r.RemoteAddr) {
+		return ""
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			return ""
+		}
+		addr := net.JoinHostPort(hop, "0")
+		if i == 0 || !p.trusted(addr) {
+			return addr
+		}
+	}
+	return ""
+}
+
+// trusted reports whether the remote address addr belongs to a trusted
+// proxy.
+func (p *ProxyPolicy) trusted(addr string) bool {
+	if listen.IsUnix(addr) {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package signaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyPolicy_Handler(t *testing.T) {
+	p, err := NewProxyPolicy([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc       string
+		giveRemote string
+		giveXFF    []string
+		want       string
+	}{
+		{
+			desc:       "untrusted peer",
+			giveRemote: "203.0.113.5:4000",
+			giveXFF:    []string{"198.51.100.1"},
+			want:       "203.0.113.5:4000",
+		},
+		{
+			desc:       "trusted peer",
+			giveRemote: "10.0.0.1:4000",
+			giveXFF:    []string{"198.51.100.1"},
+			want:       "198.51.100.1:0",
+		},
+		{
+			desc:       "trusted ipv6 peer",
+			giveRemote: "[::1]:4000",
+			giveXFF:    []string{"2001:db8::1"},
+			want:       "[2001:db8::1]:0",
+		},
+		{
+			desc:       "trusted chain",
+			giveRemote: "10.0.0.1:4000",
+			giveXFF:    []string{"203.0.113.9, 198.51.100.1", "192.168.1.1"},
+			want:       "198.51.100.1:0",
+		},
+		{
+			desc:       "all trusted",
+			giveRemote: "10.0.0.1:4000",
+			giveXFF:    []string{"192.168.1.2, 192.168.1.1"},
+			want:       "192.168.1.2:0",
+		},
+		{
+			desc:       "unix socket peer",
+			giveRemote: "@",
+			giveXFF:    []string{"198.51.100.1"},
+			want:       "198.51.100.1:0",
+		},
+		{
+			desc:       "invalid header",
+			giveRemote: "10.0.0.1:4000",
+			giveXFF:    []string{"unknown"},
+			want:       "10.0.0.1:4000",
+		},
+		{
+			desc:       "no header",
+			giveRemote: "10.0.0.1:4000",
+			want:       "10.0.0.1:4000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var have string
+			h := p.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				have = r.RemoteAddr
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.giveRemote
+			for _, v := range tt.giveXFF {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, have)
+		})
+	}
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := NewProxyPolicy([]string{"proxy.example.com"})
+		assert.Error(t, err)
+		_, err = NewProxyPolicy([]string{"10.0.0.0/33"})
+		assert.Error(t, err)
+	})
+}
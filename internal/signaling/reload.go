@@ -0,0 +1,271 @@
+package signaling
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Reload replaces the configuration with conf and applies changes of
+// users, channels, captured users, turn servers and TLS certificates. The
+// call log and the capture are reopened. Connected clients are not
+// affected.
+//
+// Users, channels and the certificate are validated before anything is
+// changed; the server keeps running on the previous configuration if conf
+// is invalid. Errors reopening the files are returned after conf has been
+// applied.
+//
+// With a store, only users and channels that are new in conf are
+// imported. Changes to existing ones are ignored, and users and channels
+// removed from conf are kept in the store and keep their access until
+// they are deleted through the admin API.
+func (s *Server) Reload(conf *viper.Viper) error {
+	var crt tls.Certificate
+	tlsOn := conf.GetBool("signaling.tls")
+	if tlsOn {
+		var err error
+		crt, err = tls.LoadX509KeyPair(
+			conf.GetString("signaling.tls_crt"),
+			conf.GetString("signaling.tls_key"),
+		)
+		if err != nil {
+			return fmt.Errorf("reload certificate: %v", err)
+		}
+	}
+
+	var users auth.UserMap
+	if s.store != nil {
+		if err := store.Import(s.store, conf); err != nil {
+			return fmt.Errorf("import config: %v", err)
+		}
+		s.warnUnlisted(conf)
+	} else {
+		ac := conf.Sub("auth")
+		if ac == nil {
+			return errors.New("reload users: auth section missing")
+		}
+		var err error
+		if users, err = auth.Load(ac); err != nil {
+			return fmt.Errorf("reload users: %v", err)
+		}
+	}
+
+	channels, err := s.readChannels(conf)
+	if err != nil {
+		return fmt.Errorf("reload channels: %v", err)
+	}
+
+	s.vmu.Lock()
+	s.conf = conf
+	s.vmu.Unlock()
+
+	if users != nil {
+		auth.Replace(users)
+	}
+	s.setChannels(channels)
+	if s.capture != nil {
+		s.capture.SetUsers(conf.GetStringSlice("signaling.capture.users"))
+	}
+	s.discoverTURN(turnConfig(conf))
+	if tlsOn {
+		s.cert.set(&crt)
+		log.Info().Msg("certificate reloaded")
+	}
+
+	if s.callfile != nil {
+		if err := s.callfile.Reopen(); err != nil {
+			return fmt.Errorf("reopen call log: %v", err)
+		}
+	}
+	if s.capfile != nil {
+		if err := s.capfile.Reopen(); err != nil {
+			return fmt.Errorf("reopen capture: %v", err)
+		}
+	}
+	return nil
+}
+
+// config returns the current configuration.
+func (s *Server) config() *viper.Viper {
+	s.vmu.RLock()
+	defer s.vmu.RUnlock()
+	return s.conf
+}
+
+// warnUnlisted logs the users and channels in the store that are missing
+// from conf. Reload does not delete them.
+func (s *Server) warnUnlisted(conf *viper.Viper) {
+	var cu []auth.User
+	var cc []store.Channel
+	if conf.UnmarshalKey("auth.users", &cu) != nil ||
+		conf.UnmarshalKey("channels", &cc) != nil {
+		return
+	}
+	listed := make(map[string]bool)
+	for _, u := range cu {
+		listed["user:"+u.Name] = true
+	}
+	for _, c := range cc {
+		listed["channel:"+c.Name] = true
+	}
+
+	var users, channels []string
+	su, err := s.store.Users()
+	if err != nil {
+		log.Error().Err(err).Msg("read users from store")
+		return
+	}
+	for _, u := range su {
+		if !listed["user:"+u.Name] {
+			users = append(users, u.Name)
+		}
+	}
+	sc, err := s.store.Channels()
+	if err != nil {
+		log.Error().Err(err).Msg("read channels from store")
+		return
+	}
+	for _, c := range sc {
+		if !listed["channel:"+c.Name] {
+			channels = append(channels, c.Name)
+		}
+	}
+	if len(users) == 0 && len(channels) == 0 {
+		return
+	}
+	log.Warn().
+		Strs("users", users).
+		Strs("channels", channels).
+		Msg("not in configuration but kept in store, delete through the admin API")
+}
+
+// Channels returns all channels ordered by name.
+func (s *Server) Channels() []store.Channel {
+	s.cmu.RLock()
+	defer s.cmu.RUnlock()
+
+	channels := make([]store.Channel, 0, len(s.channels))
+	for _, c := range s.channels {
+		channels = append(channels, c)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+	return channels
+}
+
+// channel returns the channel with the given name.
+func (s *Server) channel(name string) (store.Channel, bool) {
+	s.cmu.RLock()
+	defer s.cmu.RUnlock()
+	c, ok := s.channels[name]
+	return c, ok
+}
+
+// loadChannels reads the channel definitions from the store or the
+// configuration and applies them.
+func (s *Server) loadChannels() error {
+	channels, err := s.readChannels(s.config())
+	if err != nil {
+		return err
+	}
+	s.setChannels(channels)
+	return nil
+}
+
+// readChannels reads the channel definitions from the store or, without
+// a store, from conf.
+func (s *Server) readChannels(conf *viper.Viper) (map[string]store.Channel, error) {
+	var list []store.Channel
+	var err error
+	if s.store != nil {
+		list, err = s.store.Channels()
+	} else {
+		err = conf.UnmarshalKey("channels", &list)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make(map[string]store.Channel)
+	for _, c := range list {
+		channels[c.Name] = c
+	}
+	return channels, nil
+}
+
+// setChannels replaces the channels and logs the changes.
+func (s *Server) setChannels(channels map[string]store.Channel) {
+	s.cmu.Lock()
+	old := s.channels
+	s.channels = channels
+	s.cmu.Unlock()
+
+	if old == nil {
+		return
+	}
+	added, removed, changed := diffChannels(old, channels)
+	log.Info().
+		Strs("added", added).
+		Strs("removed", removed).
+		Strs("changed", changed).
+		Msg("channels reloaded")
+}
+
+func diffChannels(old, n map[string]store.Channel) (added, removed, changed []string) {
+	for name, c := range n {
+		if o, ok := old[name]; !ok {
+			added = append(added, name)
+		} else if !reflect.DeepEqual(o, c) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := n[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// certificate holds the server certificate and allows replacing it while
+// the server is running.
+type certificate struct {
+	mu  sync.RWMutex
+	crt *tls.Certificate
+}
+
+func (c *certificate) load(crtFile, keyFile string) error {
+	crt, err := tls.LoadX509KeyPair(crtFile, keyFile)
+	if err != nil {
+		return err
+	}
+	c.set(&crt)
+	return nil
+}
+
+// set replaces the certificate with crt.
+func (c *certificate) set(crt *tls.Certificate) {
+	c.mu.Lock()
+	c.crt = crt
+	c.mu.Unlock()
+}
+
+// get implements the tls.Config GetCertificate function.
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.crt, nil
+}
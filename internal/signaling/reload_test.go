@@ -0,0 +1,142 @@
+package signaling
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Reload(t *testing.T) {
+	defer auth.Configure(conf.Sub("auth"))
+
+	data, err := ioutil.ReadFile("../../configs/signald.yaml")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "signald.yaml")
+	require.NoError(t, ioutil.WriteFile(file, data, 0600))
+
+	c := viper.New()
+	c.SetConfigFile(file)
+	require.NoError(t, c.ReadInConfig())
+	c.Set("signaling.tls", true)
+	c.Set("signaling.tls_crt", "../../test/localhost.crt")
+	c.Set("signaling.tls_key", "../../test/localhost.key")
+
+	s := NewServer(c)
+	assert.Equal(t, []store.Channel{{
+		Name:    "Lobby",
+		Desc:    "This is the lobby.",
+		Hash:    "bef8ef72b9935ed7709f700f6a78a84a217b5714238316136156e28333251552",
+		Default: true,
+	}}, s.Channels())
+	assert.True(t, auth.Exists("testuser"))
+
+	// remove testuser and add a channel
+	edited := strings.Replace(string(data), "    - name: testuser\n", "    - name: renamed\n", 1)
+	edited = strings.Replace(edited, "channels:\n", "channels:\n  - name: Standup\n", 1)
+	require.NoError(t, ioutil.WriteFile(file, []byte(edited), 0600))
+	n := viper.New()
+	n.SetConfigFile(file)
+	require.NoError(t, n.ReadInConfig())
+	n.Set("signaling.tls", true)
+	n.Set("signaling.tls_crt", "../../test/localhost.crt")
+	n.Set("signaling.tls_key", "../../test/localhost.key")
+
+	require.NoError(t, s.Reload(n))
+	assert.Same(t, n, s.config())
+	assert.False(t, auth.Exists("testuser"), "removed user should not exist")
+	assert.True(t, auth.Exists("renamed"), "added user should exist")
+
+	channels := s.Channels()
+	require.Len(t, channels, 2)
+	assert.Equal(t, "Lobby", channels[0].Name)
+	assert.Equal(t, "Standup", channels[1].Name)
+
+	crt, err := s.cert.get(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, crt, "certificate should be loaded")
+}
+
+func TestServer_ReloadInvalid(t *testing.T) {
+	defer auth.Configure(conf.Sub("auth"))
+
+	c := viper.New()
+	for k, v := range conf.AllSettings() {
+		c.Set(k, v)
+	}
+	s := NewServer(c)
+	require.NoError(t, s.cert.load("../../test/localhost.crt", "../../test/localhost.key"))
+	old, _ := s.cert.get(nil)
+	channels := s.Channels()
+
+	tests := []struct {
+		desc string
+		give map[string]interface{}
+	}{
+		{
+			desc: "invalid certificate",
+			give: map[string]interface{}{
+				"signaling.tls":     true,
+				"signaling.tls_crt": "missing.crt",
+			},
+		},
+		{
+			desc: "invalid users",
+			give: map[string]interface{}{"auth.users": "invalid"},
+		},
+		{
+			desc: "invalid channels",
+			give: map[string]interface{}{"channels": "invalid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			n := viper.New()
+			for k, v := range c.AllSettings() {
+				n.Set(k, v)
+			}
+			n.Set("auth.users", []map[string]interface{}{{"name": "user3", "hash": "x"}})
+			n.Set("channels", []map[string]interface{}{{"name": "Standup"}})
+			for k, v := range tt.give {
+				n.Set(k, v)
+			}
+			assert.Error(t, s.Reload(n))
+
+			assert.Same(t, c, s.config(), "configuration should not be replaced")
+			assert.True(t, auth.Exists("testuser"), "users should not be replaced")
+			assert.False(t, auth.Exists("user3"), "users should not be replaced")
+			assert.Equal(t, channels, s.Channels(), "channels should not be replaced")
+			crt, _ := s.cert.get(nil)
+			assert.Same(t, old, crt, "certificate should not be replaced")
+		})
+	}
+}
+
+func TestServer_ReloadStore(t *testing.T) {
+	defer auth.Configure(conf.Sub("auth"))
+
+	c := viper.New()
+	for k, v := range conf.AllSettings() {
+		c.Set(k, v)
+	}
+	c.Set("store.path", filepath.Join(t.TempDir(), "test.db"))
+	s := NewServer(c)
+	defer s.store.Close()
+
+	n := viper.New()
+	for k, v := range c.AllSettings() {
+		n.Set(k, v)
+	}
+	n.Set("auth.users", []map[string]interface{}{{"name": "user3", "hash": "x"}})
+	require.NoError(t, s.Reload(n))
+
+	assert.True(t, auth.Exists("user3"), "added user should be imported")
+	assert.True(t, auth.Exists("testuser"), "removed user should be kept")
+}
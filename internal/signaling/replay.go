@@ -0,0 +1,79 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/proto"
+)
+
+// replayQueueSize is the send buffer of replay clients.
+const replayQueueSize = 256
+
+// Replay feeds captured frames into sw, which must be running. A client is
+// registered for every sender and recipient in records before the frames
+// are forwarded in order, spaced as in the capture divided by speed.
+// Returns the records of the frames delivered by sw per user, including
+// errors and acks.
+func Replay(sw Switch, records []*capture.Record, speed float64) map[string][]*capture.Record {
+	clients := make(map[string]*replayClient)
+	for _, r := range records {
+		for _, name := range []string{r.Frame.Src, r.Frame.Dst} {
+			if _, ok := clients[name]; ok || name == "" {
+				continue
+			}
+			c := newReplayClient(name)
+			clients[name] = c
+			sw.Register(c)
+		}
+	}
+
+	capture.Play(records, speed, func(r *capture.Record) {
+		sw.Forward() <- r.Frame
+	})
+
+	// frames are handled on receipt, unregistering ends the replay
+	delivered := make(map[string][]*capture.Record)
+	for name, c := range clients {
+		sw.Unregister(c)
+		<-c.done
+		delivered[name] = c.received
+	}
+	return delivered
+}
+
+// replayClient implements a Client that records the frames it receives.
+type replayClient struct {
+	name     string
+	send     chan *proto.Frame
+	done     chan bool
+	received []*capture.Record
+}
+
+func newReplayClient(name string) *replayClient {
+	c := &replayClient{
+		name: name,
+		send: make(chan *proto.Frame, replayQueueSize),
+		done: make(chan bool),
+	}
+	go func() {
+		defer close(c.done)
+		for f := range c.send {
+			c.received = append(c.received, &capture.Record{
+				Time:  time.Now(),
+				Frame: f,
+			})
+		}
+	}()
+	return c
+}
+
+func (c *replayClient) Attach(Switch) {}
+
+func (c *replayClient) Send() chan<- *proto.Frame {
+	return c.send
+}
+
+func (c *replayClient) Name() string {
+	return c.name
+}
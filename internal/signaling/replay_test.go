@@ -0,0 +1,64 @@
+package signaling
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/capture"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestReplay(t *testing.T) {
+	t0 := time.Now()
+	records := []*capture.Record{
+		{Time: t0, Frame: &proto.Frame{
+			Src:     "user1",
+			Dst:     "user2",
+			Id:      1,
+			Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_OFFER}},
+		}},
+		{Time: t0.Add(10 * time.Millisecond), Frame: &proto.Frame{
+			Src:     "user2",
+			Dst:     "user1",
+			Id:      1,
+			WantAck: true,
+			Payload: &proto.Frame_Sdp{Sdp: &proto.SDP{Type: proto.SDP_ANSWER}},
+		}},
+		{Time: t0.Add(20 * time.Millisecond), Frame: &proto.Frame{
+			Src:     "user1",
+			Dst:     "user2",
+			Id:      2,
+			Payload: &proto.Frame_Ice{Ice: &proto.ICE{Candidate: "candidate"}},
+		}},
+	}
+
+	sw := NewSwitch()
+	go sw.Run()
+
+	// capture the replay and replay the capture
+	var buf bytes.Buffer
+	c := NewCapture(&buf, nil)
+	sw.Observe(c)
+	have := Replay(sw, records, 1)
+	sw.Shutdown()
+	c.Close()
+
+	user1, user2 := have["user1"], have["user2"]
+	require.Len(t, user1, 1)
+	assert.True(t, pb.Equal(records[1].Frame, user1[0].Frame))
+	require.Len(t, user2, 3)
+	assert.True(t, pb.Equal(records[0].Frame, user2[0].Frame))
+	assert.Equal(t, uint64(1), user2[1].Frame.GetAck().GetRef())
+	assert.True(t, pb.Equal(records[2].Frame, user2[2].Frame))
+
+	captured, err := capture.ReadAll(&buf)
+	require.NoError(t, err)
+	require.Len(t, captured, 3)
+	for i := range records {
+		assert.True(t, pb.Equal(records[i].Frame, captured[i].Frame))
+	}
+}
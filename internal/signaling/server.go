@@ -2,25 +2,77 @@ package signaling
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/justinas/alice"
 	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/listen"
+	"github.com/lx7/devnet/internal/rotate"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/internal/webhook"
+	"github.com/lx7/devnet/proto"
 	"github.com/rs/zerolog/hlog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
+// shutdownTimeout limits the time Shutdown waits for running requests.
+const shutdownTimeout = 10 * time.Second
+
 // Server represents the http signaling server.
 type Server struct {
 	*http.Server
-	conf     *viper.Viper
 	upgrader websocket.Upgrader
 	sw       Switch
+	local    *DefaultSwitch
+	store    store.Store
+	history  *History
+	webhooks *webhook.Dispatcher
+	calls    *CallLog
+	metrics  *Metrics
+	callfile *rotate.Writer
+	capture  *Capture
+	capfile  *rotate.Writer
+	admin    *http.Server
+	admins   map[string]bool
+	ln       net.Listener
+	adminLn  net.Listener
+	invites  *auth.Invites
+	certs    *auth.CertAuth
+	limits   *Limits
+	origins  *OriginPolicy
+	proxies  *ProxyPolicy
+	cert     certificate
+
+	inviteTTL  time.Duration
+	advertised []string
+	minProto   uint32
+	clientCAs  *x509.CertPool
+	clientAuth tls.ClientAuthType
+	collectors map[string]func() interface{}
+
+	mu       sync.Mutex
+	sessions map[string]*DefaultClient
+	streams  map[string]*streamConn
+
+	cmu      sync.RWMutex
+	channels map[string]store.Channel
+
+	vmu  sync.RWMutex
+	conf *viper.Viper
+
+	imu        sync.RWMutex
+	discovered []string
+
+	quit chan struct{}
 }
 
 // NewServer returns a new Server instance.
@@ -31,23 +83,172 @@ func NewServer(conf *viper.Viper) *Server {
 		Server: &http.Server{
 			Addr: conf.GetString("signaling.addr"),
 		},
-		conf: conf,
-		upgrader: websocket.Upgrader{
-			ReadBufferSize:  0,
-			WriteBufferSize: 0,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
-		},
-		sw: NewSwitch(),
+		conf:     conf,
+		origins:  &OriginPolicy{SameOrigin: true},
+		proxies:  &ProxyPolicy{},
+		sessions: make(map[string]*DefaultClient),
+		streams:  make(map[string]*streamConn),
+		quit:     make(chan struct{}),
+	}
+	s.sw, s.local = newSwitch(conf)
+	s.metrics = &Metrics{}
+	s.local.Observe(s.metrics)
+	if conf.IsSet("store.path") {
+		s.openStore(conf.GetString("store.path"))
+	}
+	if err := s.loadChannels(); err != nil {
+		log.Error().Err(err).Msg("load channels")
+	}
+	s.local.SetChannels(s.channel)
+	if conf.IsSet("signaling.webhooks") {
+		var wc webhook.Config
+		if err := conf.UnmarshalKey("signaling.webhooks", &wc); err != nil {
+			log.Error().Err(err).Msg("unmarshal webhook config")
+		}
+		s.webhooks = webhook.New(&wc)
+		o := newWebhookObserver(s.webhooks, s.Channels)
+		s.local.Observe(o)
+		auth.OnFailure(o.authFailed)
+	}
+	if conf.IsSet("signaling.calllog") {
+		s.openCallLog(conf)
+	}
+	if conf.IsSet("signaling.capture") {
+		s.openCapture(conf)
+	}
+	if conf.IsSet("signaling.invites") {
+		s.configureInvites(conf)
+	}
+	if conf.IsSet("signaling.client_certs") {
+		s.configureClientCerts(conf)
+	}
+	if conf.IsSet("signaling.proxies") {
+		s.configureProxies(conf)
+	}
+	if conf.IsSet("signaling.admin") {
+		s.configureAdmin(conf)
+	}
+	if conf.IsSet("signaling.turn") {
+		s.discoverTURN(turnConfig(conf))
+	}
+
+	s.minProto = uint32(conf.GetUint("signaling.min_protocol"))
+	if s.minProto > proto.ProtocolVersion {
+		log.Error().Uint32("min_protocol", s.minProto).Msg("minimum protocol version not supported")
+	}
+
+	if err := conf.UnmarshalKey("signaling.limits", &s.limits); err != nil {
+		log.Error().Err(err).Msg("unmarshal client limits")
+	}
+	if err := conf.UnmarshalKey("signaling.origins", s.origins); err != nil {
+		log.Error().Err(err).Msg("unmarshal origin policy")
+	}
+
+	s.upgrader = websocket.Upgrader{
+		ReadBufferSize:  0,
+		WriteBufferSize: 0,
+		Subprotocols:    proto.Subprotocols,
+		CheckOrigin:     s.origins.CheckOrigin,
 	}
 	return s
 }
 
+// Advertise adds the ICE server urls to the configuration sent to clients,
+// e.g. those of a turn server in the same process. It must be called
+// before Serve.
+func (s *Server) Advertise(urls ...string) {
+	s.advertised = append(s.advertised, urls...)
+}
+
+// newSwitch returns a standalone or clustered switch as defined in conf
+// and the local switch it is based on.
+func newSwitch(conf *viper.Viper) (Switch, *DefaultSwitch) {
+	sw := NewSwitch()
+	var s Switch = sw
+	if conf.IsSet("signaling.cluster") {
+		var cc ClusterConfig
+		if err := conf.UnmarshalKey("signaling.cluster", &cc); err != nil {
+			log.Fatal().Err(err).Msg("unmarshal cluster config")
+		}
+		c, err := NewClusterSwitch(&cc)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cluster setup")
+		}
+		sw, s = c.DefaultSwitch, c
+	}
+
+	switch p := DuplicatePolicy(conf.GetString("signaling.duplicates")); p {
+	case "":
+	case DuplicateReplace, DuplicateReject:
+		sw.SetDuplicatePolicy(p)
+	default:
+		log.Error().Str("policy", string(p)).Msg("unknown duplicate policy")
+	}
+
+	if conf.IsSet("signaling.mailbox") {
+		var mc MailboxConfig
+		if err := conf.UnmarshalKey("signaling.mailbox", &mc); err != nil {
+			log.Error().Err(err).Msg("unmarshal mailbox config")
+		}
+		sw.EnableMailbox(&mc)
+	}
+	return s, sw
+}
+
+// openStore uses the database at path for user lookups and the event
+// history. Users and channels from the config are imported into an empty
+// database. The history is pruned as defined by store.history.
+func (s *Server) openStore(path string) {
+	st, err := store.OpenBolt(path)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", path).Msg("open store")
+	}
+
+	users, err := st.Users()
+	if err != nil {
+		log.Fatal().Err(err).Msg("read users from store")
+	}
+	if len(users) == 0 {
+		if err := store.Import(st, s.config()); err != nil {
+			log.Error().Err(err).Msg("import config into store")
+		}
+	}
+
+	var hc HistoryConfig
+	if err := s.config().UnmarshalKey("store.history", &hc); err != nil {
+		log.Error().Err(err).Msg("unmarshal history config")
+	}
+
+	auth.SetProvider(st)
+	s.store = st
+	s.history = NewHistory(st, hc)
+	s.local.Observe(s.history)
+}
+
+// openCallLog records call details as defined in conf.
+func (s *Server) openCallLog(conf *viper.Viper) {
+	var cc CallLogConfig
+	if err := conf.UnmarshalKey("signaling.calllog", &cc); err != nil {
+		log.Error().Err(err).Msg("unmarshal call log config")
+	}
+
+	if cc.File != "" {
+		w, err := rotate.Open(cc.File, cc.MaxSize, cc.MaxFiles)
+		if err != nil {
+			log.Fatal().Err(err).Str("file", cc.File).Msg("open call log")
+		}
+		s.callfile = w
+		s.calls = NewCallLog(w, cc.Recent)
+	} else {
+		s.calls = NewCallLog(nil, cc.Recent)
+	}
+	s.local.Observe(s.calls)
+}
+
 // Serve starts listening and serves HTTP requests. Connections will be
 // upgraded to the WebSocket protocol as defined per RFC 6455.
 func (s *Server) Serve() error {
-	wspath := s.conf.GetString("signaling.wspath")
+	wspath := s.config().GetString("signaling.wspath")
 	log.Info().
 		Str("addr", s.Addr).
 		Msg("starting signaling server")
@@ -61,46 +262,106 @@ func (s *Server) Serve() error {
 
 	c := alice.New()
 	c = c.Append(hlog.NewHandler(log.Logger))
-	c = c.Append(hlog.AccessHandler(func(r *http.Request, st, si int, d time.Duration) {
-		hlog.FromRequest(r).Info().
-			Str("method", r.Method).
-			Stringer("url", r.URL).
-			Int("status", st).
-			Int("size", si).
-			Dur("duration", d).
-			Msg("REQ")
-	}))
+	c = c.Append(hlog.AccessHandler(logRequest))
+	c = c.Append(s.proxies.Handler)
 	c = c.Append(hlog.RemoteAddrHandler("src"))
+	c = c.Append(s.origins.CORS)
+	c = c.Append(s.invites.Handler)
+	c = c.Append(s.certs.Handler)
 	c = c.Append(auth.BasicAuth)
 	http.Handle("/", c.Then(http.HandlerFunc(s.serveOK)))
 	http.Handle(wspath, c.Then(http.HandlerFunc(s.serveWS)))
+	http.Handle(wspath+proto.StreamPath, c.Then(http.HandlerFunc(s.serveStream)))
 
-	if s.conf.GetBool("signaling.tls") {
-		crt := s.conf.GetString("signaling.tls_crt")
-		key := s.conf.GetString("signaling.tls_key")
-		if err := s.Server.ListenAndServeTLS(crt, key); err != http.ErrServerClosed {
+	if s.ln == nil {
+		if err := s.Listen(); err != nil {
 			return err
 		}
+	}
+	if s.admin != nil {
+		go s.serveAdmin()
+	}
+	go s.watchTURN(s.quit)
+
+	var err error
+	if s.Server.TLSConfig != nil {
+		err = s.Server.ServeTLS(s.ln, "", "")
 	} else {
-		if err := s.Server.ListenAndServe(); err != http.ErrServerClosed {
+		err = s.Server.Serve(s.ln)
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	wg.Wait()
+	return nil
+}
+
+// Listen loads the TLS certificate and binds the listeners. It is called
+// by Serve unless called before, e.g. to drop privileges in between.
+func (s *Server) Listen() error {
+	if s.config().GetBool("signaling.tls") {
+		crt := s.config().GetString("signaling.tls_crt")
+		key := s.config().GetString("signaling.tls_key")
+		if err := s.cert.load(crt, key); err != nil {
 			return err
 		}
+		s.Server.TLSConfig = s.tlsConfig()
 	}
-	wg.Wait()
+
+	ln, err := listen.Listen(s.Addr)
+	if err != nil {
+		return err
+	}
+	if s.admin != nil {
+		if s.adminLn, err = listen.Listen(s.admin.Addr); err != nil {
+			ln.Close()
+			return fmt.Errorf("admin listener: %v", err)
+		}
+	}
+	s.ln = ln
 	return nil
 }
 
-// Shutdown terminates the http server.
+// Shutdown terminates the http server. The switch is shut down first so
+// that the open websocket and event stream handlers return; requests still
+// running after shutdownTimeout are abandoned.
 func (s *Server) Shutdown() {
-	if err := s.Server.Shutdown(context.TODO()); err != nil {
+	close(s.quit)
+	s.sw.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.Server.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("signaling server shutdown")
 	}
-	s.sw.Shutdown()
+	if s.admin != nil {
+		if err := s.admin.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("admin server shutdown")
+		}
+	}
+	if s.webhooks != nil {
+		auth.OnFailure(nil)
+		s.webhooks.Close()
+	}
+	if s.store != nil {
+		s.history.Close()
+		if err := s.store.Close(); err != nil {
+			log.Error().Err(err).Msg("close store")
+		}
+	}
+	if s.callfile != nil {
+		s.calls.Close()
+		s.callfile.Close()
+	}
+	if s.capfile != nil {
+		s.capture.Close()
+		s.capfile.Close()
+	}
 	log.Info().Msg("signaling server shutdown complete")
 }
 
 func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
-	user, _, ok := r.BasicAuth()
+	id, ok := requestIdentity(r)
 	if !ok {
 		log.Error().Msg("request without user")
 		code := http.StatusUnauthorized
@@ -113,17 +374,74 @@ func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
 		log.Error().Err(err).Msg("upgrade")
 		return
 	}
+	s.attach(conn, r, id)
+}
+
+// attach resumes the session requested in r on conn or starts a new
+// session for id. Returns when a new session has ended.
+func (s *Server) attach(conn Conn, r *http.Request, id *auth.Identity) {
+	user := id.Name
+	if c := s.session(user, r.Header.Get(proto.ResumeTokenHeader)); c != nil {
+		seq, _ := strconv.ParseUint(r.Header.Get(proto.ResumeSeqHeader), 10, 64)
+		if c.Resume(conn, seq) {
+			return
+		}
+	}
+
 	c := NewClient(conn, user)
+	c.SetIdentity(id)
+	c.SetLimits(s.limits)
+	c.SetMinProtocol(s.minProto)
 
-	err = c.Configure(s.conf.Sub("client"))
-	if err != nil {
+	if err := c.Configure(s.config().Sub("client"), s.iceURLs()...); err != nil {
 		log.Error().Err(err).Msg("configure client")
-		code := http.StatusInternalServerError
-		http.Error(w, http.StatusText(code), code)
+		closeWith(conn, websocket.CloseInternalServerErr, "configuration error")
+		conn.Close()
 		return
 	}
 
+	s.mu.Lock()
+	s.sessions[c.Token()] = c
+	s.mu.Unlock()
+
 	s.sw.Register(c)
+
+	s.mu.Lock()
+	delete(s.sessions, c.Token())
+	s.mu.Unlock()
+}
+
+// requestIdentity returns the identity set by the authentication wrappers.
+func requestIdentity(r *http.Request) (*auth.Identity, bool) {
+	return auth.IdentityFrom(r)
+}
+
+// session returns the resumable client session for user and token or nil
+// if there is none.
+func (s *Server) session(user, token string) *DefaultClient {
+	if token == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.sessions[token]
+	if !ok || c.Name() != user {
+		log.Warn().Str("user", user).Msg("invalid resume token")
+		return nil
+	}
+	return c
+}
+
+// logRequest writes the access log entry for a http request.
+func logRequest(r *http.Request, st, si int, d time.Duration) {
+	hlog.FromRequest(r).Info().
+		Str("method", r.Method).
+		Stringer("url", r.URL).
+		Int("status", st).
+		Int("size", si).
+		Dur("duration", d).
+		Msg("REQ")
 }
 
 func (s *Server) serveOK(w http.ResponseWriter, r *http.Request) {
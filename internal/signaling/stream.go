@@ -0,0 +1,273 @@
+package signaling
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lx7/devnet/proto"
+	"github.com/rs/zerolog/log"
+)
+
+// keepaliveInterval must be shorter than the read timeout of clients.
+const keepaliveInterval = 10 * time.Second
+
+var errStreamClosed = errors.New("event stream closed")
+
+// streamConn implements Conn on an event stream. Frames to the client are
+// written as server-sent events, frames posted by the client are returned
+// by ReadMessage.
+type streamConn struct {
+	id      string
+	user    string
+	limit   int64
+	in      chan []byte
+	done    chan bool
+	flusher http.Flusher
+
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	closed bool
+	err    error
+}
+
+func newStreamConn(w http.ResponseWriter, f http.Flusher, user string) *streamConn {
+	return &streamConn{
+		id:      newToken(),
+		user:    user,
+		in:      make(chan []byte),
+		done:    make(chan bool),
+		flusher: f,
+		w:       w,
+	}
+}
+
+// ReadMessage returns the next frame posted by the client.
+func (c *streamConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.in:
+		return websocket.TextMessage, data, nil
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return 0, nil, c.err
+	}
+}
+
+// WriteMessage sends data as an event.
+func (c *streamConn) WriteMessage(_ int, data []byte) error {
+	var b bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	return c.write(b.Bytes())
+}
+
+// WriteControl sends close messages as close event. Other control messages
+// are not supported by event streams and discarded.
+func (c *streamConn) WriteControl(messageType int, data []byte, _ time.Time) error {
+	if messageType != websocket.CloseMessage {
+		return nil
+	}
+	code := websocket.CloseNoStatusReceived
+	if len(data) >= 2 {
+		code = int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+	}
+	return c.write([]byte(fmt.Sprintf("event: %s\ndata: %d %s\n\n",
+		proto.StreamCloseEvent, code, data)))
+}
+
+// SetReadLimit sets the maximum size of posted frames.
+func (c *streamConn) SetReadLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+}
+
+// SetWriteDeadline is not supported by event streams.
+func (c *streamConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Subprotocol returns the subprotocol of the event format.
+func (c *streamConn) Subprotocol() string {
+	return proto.SubprotocolJSON
+}
+
+// Close ends the event stream. The session may be resumed on a new stream.
+func (c *streamConn) Close() error {
+	return c.closeWith(&websocket.CloseError{Code: websocket.CloseAbnormalClosure})
+}
+
+// closeWith ends the event stream. err is returned by subsequent reads.
+func (c *streamConn) closeWith(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.err = err
+	close(c.done)
+	return nil
+}
+
+func (c *streamConn) write(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errStreamClosed
+	}
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+// post passes a frame posted by the client to ReadMessage. Returns false if
+// the stream was closed.
+func (c *streamConn) post(data []byte) bool {
+	select {
+	case c.in <- data:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// keepalive sends comments to keep proxies and clients from timing out the
+// stream until it is closed or the client went away.
+func (c *streamConn) keepalive(gone <-chan struct{}) {
+	t := time.NewTicker(keepaliveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.write([]byte(": keepalive\n\n"))
+		case <-gone:
+			c.Close()
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// serveStream implements the event stream transport. GET opens a stream
+// and attaches it to the session like a websocket connection, POST sends a
+// frame and DELETE closes the stream. Requests are subject to the same
+// origin policy as websocket connections.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	if !s.origins.CheckOrigin(r) {
+		code := http.StatusForbidden
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	id, ok := requestIdentity(r)
+	if !ok {
+		log.Error().Msg("request without user")
+		code := http.StatusUnauthorized
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		s.serveStreamRequest(w, r, id.Name)
+		return
+	default:
+		code := http.StatusMethodNotAllowed
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		code := http.StatusInternalServerError
+		http.Error(w, "streaming not supported", code)
+		return
+	}
+	conn := newStreamConn(w, f, id.Name)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	h.Set(proto.StreamHeader, conn.id)
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	s.mu.Lock()
+	s.streams[conn.id] = conn
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, conn.id)
+		s.mu.Unlock()
+	}()
+
+	log.Info().Str("user", id.Name).Msg("event stream opened")
+	go conn.keepalive(r.Context().Done())
+	s.attach(conn, r, id)
+	<-conn.done
+}
+
+// serveStreamRequest passes a posted frame to the stream of user or closes
+// the stream. Oversize frames end the session, a frame that could not be
+// read is rejected and the session continues.
+func (s *Server) serveStreamRequest(w http.ResponseWriter, r *http.Request, user string) {
+	s.mu.Lock()
+	conn, ok := s.streams[r.Header.Get(proto.StreamHeader)]
+	s.mu.Unlock()
+	if !ok || conn.user != user {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		conn.closeWith(&websocket.CloseError{Code: websocket.CloseNormalClosure})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	conn.mu.Lock()
+	limit := conn.limit
+	conn.mu.Unlock()
+	if limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	switch {
+	case err != nil && limit > 0 && int64(len(data)) >= limit:
+		// like websocket connections, oversize frames end the session.
+		// MaxBytesReader returns the body up to the limit with the error.
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseMessageTooBig, ""), time.Time{})
+		conn.closeWith(websocket.ErrReadLimit)
+		http.Error(w, "frame too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		// the client may post the frame again
+		log.Debug().Err(err).Str("user", user).Msg("reading posted frame")
+		http.Error(w, "reading frame failed", http.StatusBadRequest)
+		return
+	}
+	if !conn.post(data) {
+		http.Error(w, "stream closed", http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
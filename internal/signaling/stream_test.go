@@ -0,0 +1,212 @@
+package signaling
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+// readEvent returns the type and data of the next event on r, skipping
+// comments.
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var event string
+	var data []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && data != nil:
+			return event, strings.Join(data, "\n")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestServer_Stream(t *testing.T) {
+	s := NewServer(conf)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.sw.Run()
+	}()
+	server := httptest.NewServer(asUser("testuser", s.serveStream))
+	defer server.Close()
+
+	request := func(method, stream, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL, strings.NewReader(body))
+		require.NoError(t, err)
+		if stream != "" {
+			req.Header.Set(proto.StreamHeader, stream)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := request("GET", "", "")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	stream := res.Header.Get(proto.StreamHeader)
+	require.NotEmpty(t, stream)
+
+	codec := proto.CodecFor(proto.SubprotocolJSON)
+	events := bufio.NewReader(res.Body)
+	read := func() *proto.Frame {
+		_, data := readEvent(t, events)
+		f := &proto.Frame{}
+		require.NoError(t, codec.Unmarshal([]byte(data), f), "data: %s", data)
+		return f
+	}
+	assert.NotNil(t, read().GetResume(), "resume frame expected")
+	assert.NotNil(t, read().GetConfig(), "config frame expected")
+
+	t.Run("echo", func(t *testing.T) {
+		give := &proto.Frame{Src: "testuser", Dst: "testuser", Seq: 1}
+		data, err := codec.Marshal(give)
+		require.NoError(t, err)
+		res := request("POST", stream, string(data))
+		res.Body.Close()
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		want := &proto.Frame{Src: "testuser", Dst: "testuser", Seq: 2}
+		have := read()
+		assert.True(t, pb.Equal(want, have), "have: %v", have)
+	})
+
+	t.Run("foreign origin", func(t *testing.T) {
+		for _, method := range []string{"GET", "POST"} {
+			req, err := http.NewRequest(method, server.URL, strings.NewReader("{}"))
+			require.NoError(t, err)
+			req.Header.Set(proto.StreamHeader, stream)
+			req.Header.Set("Origin", "https://evil.test")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, http.StatusForbidden, res.StatusCode, method)
+		}
+	})
+
+	t.Run("unknown stream", func(t *testing.T) {
+		res := request("POST", "unknown", "{}")
+		res.Body.Close()
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		res := request("DELETE", stream, "")
+		res.Body.Close()
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		done := make(chan error)
+		go func() {
+			_, err := events.ReadString('\n')
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			assert.Error(t, err, "stream should end")
+		case <-time.After(time.Second):
+			t.Fatal("stream not closed")
+		}
+	})
+
+	s.sw.Shutdown()
+	wg.Wait()
+}
+
+func TestServer_StreamRequestError(t *testing.T) {
+	s := NewServer(conf)
+	post := func(body io.Reader) (*httptest.ResponseRecorder, *streamConn) {
+		rec := httptest.NewRecorder()
+		conn := newStreamConn(rec, rec, "testuser")
+		conn.SetReadLimit(8)
+		s.streams[conn.id] = conn
+		defer delete(s.streams, conn.id)
+
+		req := httptest.NewRequest("POST", "/", body)
+		req.Header.Set(proto.StreamHeader, conn.id)
+		w := httptest.NewRecorder()
+		s.serveStreamRequest(w, req, "testuser")
+		return w, conn
+	}
+
+	t.Run("frame too large", func(t *testing.T) {
+		w, conn := post(strings.NewReader("0123456789"))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		_, _, err := conn.ReadMessage()
+		assert.Equal(t, websocket.ErrReadLimit, err)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		w, conn := post(&errReader{data: "{}"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.False(t, conn.closed, "session should continue")
+	})
+}
+
+// errReader returns data followed by a read error.
+type errReader struct {
+	data string
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestServer_StreamShutdown(t *testing.T) {
+	s := NewServer(conf)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.sw.Run()
+	}()
+	server := httptest.NewServer(asUser("testuser", s.serveStream))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the switch shutdown ends open streams so that the http server
+	// shutdown does not wait for them
+	s.sw.Shutdown()
+	wg.Wait()
+
+	done := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(res.Body)
+		done <- err
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream not closed")
+	}
+}
@@ -1,6 +1,10 @@
 package signaling
 
 import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lx7/devnet/internal/auth"
 	"github.com/lx7/devnet/proto"
 
 	"github.com/rs/zerolog/log"
@@ -11,19 +15,127 @@ type Switch interface {
 	Register(Client)
 	Unregister(Client)
 	Forward() chan<- *proto.Frame
+	Broadcast(*proto.Frame)
 	Run()
 	Shutdown()
 }
 
+// Observer is notified of switch events. Notify is called from the switch
+// run loop and must not block.
+type Observer interface {
+	Notify(*Event)
+}
+
+// EventType identifies the type of a switch event.
+type EventType int
+
+const (
+	// EventOnline occurs when a client registers.
+	EventOnline EventType = iota + 1
+
+	// EventOffline occurs when a client unregisters.
+	EventOffline
+
+	// EventForward occurs when a frame is delivered to a local client.
+	EventForward
+
+	// EventReceive occurs when the switch accepts a frame from a local
+	// client or another node, before it is forwarded, routed or stored.
+	EventReceive
+
+	// EventRemoteOffline occurs when a user registered with another node
+	// of the cluster unregisters or the node becomes unreachable.
+	EventRemoteOffline
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventOnline:
+		return "online"
+	case EventOffline:
+		return "offline"
+	case EventForward:
+		return "forward"
+	case EventReceive:
+		return "receive"
+	case EventRemoteOffline:
+		return "remote_offline"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a change observed by the switch.
+type Event struct {
+	Type  EventType
+	Time  time.Time
+	User  string
+	Frame *proto.Frame
+
+	// Remote is set for frames received from another node.
+	Remote bool
+
+	// Identity is the identity of the user on EventOnline. It is nil for
+	// users without one.
+	Identity *auth.Identity
+}
+
+// DuplicatePolicy defines the handling of a registration with the name of a
+// registered client. In a cluster, clients registered with other nodes are
+// taken into account.
+type DuplicatePolicy string
+
+const (
+	// DuplicateReplace disconnects the registered client. It is the
+	// default.
+	DuplicateReplace DuplicatePolicy = "replace"
+
+	// DuplicateReject refuses the new client.
+	DuplicateReject DuplicatePolicy = "reject"
+)
+
+// disconnecter is implemented by clients that can be disconnected by the
+// switch.
+type disconnecter interface {
+	Disconnect(code int, reason string)
+}
+
+// router forwards frames to users that are not registered with the local
+// switch. It is called from the switch run loop and must not block.
+type router interface {
+	join(name string)
+	leave(name string)
+	route(f *proto.Frame) bool
+
+	// online returns the users registered with other nodes.
+	online() []string
+
+	// registered reports whether name is registered with another node.
+	registered(name string) bool
+}
+
 // DefaultSwitch implements the Switch interface.
 type DefaultSwitch struct {
-	clients map[string]Client
+	clients   map[string]Client
+	mailbox   *mailbox
+	router    router
+	mod       *moderation
+	notices   *notices
+	observers []Observer
+
+	duplicates DuplicatePolicy
 
 	forward    chan *proto.Frame
+	deliver    chan *proto.Frame
 	broadcast  chan *proto.Frame
+	handoff    chan string
+	departed   chan string
+	replaced   chan string
 	register   chan Client
 	unregister chan Client
 	done       chan bool
+	started    chan bool
+	stopped    chan bool
 }
 
 // NewSwitch returns a new Switch instance.
@@ -31,22 +143,58 @@ func NewSwitch() *DefaultSwitch {
 	return &DefaultSwitch{
 		broadcast:  make(chan *proto.Frame),
 		forward:    make(chan *proto.Frame),
+		deliver:    make(chan *proto.Frame),
+		handoff:    make(chan string),
+		departed:   make(chan string),
+		replaced:   make(chan string),
 		register:   make(chan Client),
 		unregister: make(chan Client),
 		clients:    make(map[string]Client),
+		mod:        newModeration(),
+		notices:    &notices{},
 		done:       make(chan bool),
+		started:    make(chan bool),
+		stopped:    make(chan bool),
 	}
 }
 
+// EnableMailbox stores frames for absent users according to conf and
+// delivers them on the next registration. Must be called before Run.
+func (sw *DefaultSwitch) EnableMailbox(conf *MailboxConfig) {
+	sw.mailbox = newMailbox(conf)
+}
+
+// SetDuplicatePolicy defines how a registration is handled while a client
+// of the same name is registered. Must be called before Run.
+func (sw *DefaultSwitch) SetDuplicatePolicy(p DuplicatePolicy) {
+	sw.duplicates = p
+}
+
+// Observe adds o to the observers notified of switch events. Must be called
+// before Run.
+func (sw *DefaultSwitch) Observe(o Observer) {
+	sw.observers = append(sw.observers, o)
+}
+
 // Register connects c to the switch and starts message processing.
-// Returns on termination of the client run loop.
+// Returns on termination of the client run loop. Clients registering after
+// shutdown are refused.
 func (sw *DefaultSwitch) Register(c Client) {
-	sw.register <- c
+	select {
+	case sw.register <- c:
+	case <-sw.done:
+		sw.refuse(c, websocket.CloseGoingAway, "server shutdown")
+	}
 	c.Attach(sw)
 }
 
+// Unregister disconnects c from the switch. It does nothing if c has been
+// replaced or the switch was shut down.
 func (sw *DefaultSwitch) Unregister(c Client) {
-	sw.unregister <- c
+	select {
+	case sw.unregister <- c:
+	case <-sw.done:
+	}
 }
 
 // Forward returns the switches forward channel.
@@ -54,55 +202,338 @@ func (sw *DefaultSwitch) Forward() chan<- *proto.Frame {
 	return sw.forward
 }
 
+// Broadcast sends f to all registered clients. Notices are also sent to
+// clients registering before they expire. It does nothing after shutdown.
+func (sw *DefaultSwitch) Broadcast(f *proto.Frame) {
+	sw.notices.add(f)
+	select {
+	case sw.broadcast <- f:
+	case <-sw.done:
+	}
+}
+
+// Notices returns the frames of the broadcast notices that have not
+// expired.
+func (sw *DefaultSwitch) Notices() []*proto.Frame {
+	return sw.notices.active(time.Now())
+}
+
+// ClearNotices discards the broadcast notices, so that clients registering
+// later do not receive them.
+func (sw *DefaultSwitch) ClearNotices() {
+	sw.notices.clear()
+}
+
 // Run implements the message handling loop.
 func (sw *DefaultSwitch) Run() {
+	close(sw.started)
 	for {
 		select {
 		case client := <-sw.register:
+			if msg := sw.mod.admit(client); msg != "" {
+				log.Info().
+					Str("user", client.Name()).
+					Str("reason", msg).
+					Msg("refusing client")
+				sw.refuse(client, websocket.ClosePolicyViolation, msg)
+				break
+			}
+			old, ok := sw.clients[client.Name()]
+			local := ok && old != client
+			remote := !local && sw.router != nil && sw.router.registered(client.Name())
+			if local || remote {
+				if id := identityOf(client); id != nil && id.Guest {
+					log.Info().Str("user", client.Name()).Msg("guest name taken, refusing client")
+					sw.refuse(client, websocket.ClosePolicyViolation, "name already taken")
+					break
+				}
+				if sw.duplicates == DuplicateReject {
+					log.Info().Str("user", client.Name()).Msg("already connected, refusing client")
+					sw.refuse(client, websocket.ClosePolicyViolation, "already connected")
+					break
+				}
+				log.Info().Str("user", client.Name()).Bool("remote", remote).Msg("replacing client")
+				if local {
+					sw.disconnect(old, proto.CloseReplaced, "replaced by new connection")
+				}
+			}
 			log.Info().Str("user", client.Name()).Msg("registering client")
 			sw.clients[client.Name()] = client
-		case client := <-sw.unregister:
-			if _, ok := sw.clients[client.Name()]; ok {
-				log.Info().Str("user", client.Name()).Msg("unregistering client")
-				delete(sw.clients, client.Name())
-				close(client.Send())
+			if sw.router != nil {
+				sw.router.join(client.Name())
 			}
-		case f := <-sw.broadcast:
-			for _, client := range sw.clients {
+			sw.observe(&Event{
+				Type:     EventOnline,
+				User:     client.Name(),
+				Identity: identityOf(client),
+			})
+			for _, f := range sw.mailbox.collect(client.Name()) {
 				select {
 				case client.Send() <- f:
 				default:
-					sw.unregister <- client
+					log.Warn().Str("user", client.Name()).Msg("send buffer full, discarding stored message")
 				}
 			}
-		case f := <-sw.forward:
-			if client, ok := sw.clients[f.Dst]; ok {
-				// TODO: verify sender
-				log.Trace().
-					Str("src", f.Src).
-					Str("dst", f.Dst).
-					Msg("forwarding message")
+			for _, f := range sw.notices.active(time.Now()) {
 				select {
 				case client.Send() <- f:
 				default:
-					sw.unregister <- client
+					log.Warn().Str("user", client.Name()).Msg("send buffer full, discarding notice")
 				}
-			} else {
-				log.Trace().
-					Str("src", f.Src).
-					Str("dst", f.Dst).
-					Msg("client absent, discarding message")
+			}
+		case client := <-sw.unregister:
+			sw.remove(client)
+		case f := <-sw.broadcast:
+			for _, client := range sw.clients {
+				select {
+				case client.Send() <- f:
+				default:
+					sw.drop(client)
+				}
+			}
+		case name := <-sw.handoff:
+			sw.handOff(name)
+		case name := <-sw.departed:
+			if _, ok := sw.clients[name]; !ok {
+				sw.notify(EventRemoteOffline, name, nil)
+			}
+		case name := <-sw.replaced:
+			// the client registered last on any node is kept
+			if client, ok := sw.clients[name]; ok && sw.duplicates != DuplicateReject {
+				log.Info().Str("user", name).Msg("replaced on another node, disconnecting client")
+				sw.disconnect(client, proto.CloseReplaced, "replaced by new connection")
+			}
+		case f := <-sw.forward:
+			sw.handleLocal(f)
+		case f := <-sw.deliver:
+			switch f.Payload.(type) {
+			case *proto.Frame_Error, *proto.Frame_Ack:
+				sw.send(f)
+			default:
+				sw.handle(f, false)
 			}
 		case <-sw.done:
+			for _, client := range sw.clients {
+				sw.disconnect(client, websocket.CloseGoingAway, "server shutdown")
+			}
+			close(sw.stopped)
 			return
 		}
 	}
 }
 
-// Shutdown unregisters all clients and stops the run loop.
-func (sw *DefaultSwitch) Shutdown() {
-	for _, c := range sw.clients {
-		sw.unregister <- c
+// handle forwards f to a local client. Frames for absent users are passed
+// to the router if route is set, stored in the mailbox or answered with an
+// error. route is only set for frames of local clients.
+func (sw *DefaultSwitch) handle(f *proto.Frame, route bool) {
+	sw.observe(&Event{Type: EventReceive, User: f.Src, Frame: f, Remote: !route})
+
+	client, ok := sw.clients[f.Dst]
+	if !ok && route && sw.router != nil && sw.router.route(f) {
+		log.Trace().
+			Str("src", f.Src).
+			Str("dst", f.Dst).
+			Msg("routing message")
+		return
+	}
+	if !ok && f.Queued != 0 && sw.mailbox.store(f) {
+		log.Debug().
+			Str("src", f.Src).
+			Str("dst", f.Dst).
+			Msg("client absent, handed off message stored")
+		return
+	}
+	if !ok && sw.mailbox.store(f) {
+		log.Debug().
+			Str("src", f.Src).
+			Str("dst", f.Dst).
+			Msg("client absent, message stored")
+		sw.reply(errorReply(f, proto.Error_PEER_OFFLINE, "peer offline, message stored"))
+		return
 	}
+	if !ok {
+		log.Trace().
+			Str("src", f.Src).
+			Str("dst", f.Dst).
+			Msg("client absent, discarding message")
+		sw.reply(errorReply(f, proto.Error_PEER_OFFLINE, "peer offline"))
+		return
+	}
+
+	log.Trace().
+		Str("src", f.Src).
+		Str("dst", f.Dst).
+		Msg("forwarding message")
+	select {
+	case client.Send() <- f:
+		sw.notify(EventForward, f.Dst, f)
+		if f.WantAck {
+			sw.reply(ackReply(f))
+		}
+		if m := f.Moderation(); m.GetAction() == proto.Control_Moderation_KICK {
+			// guests only take part in the channel of their invite
+			if id := identityOf(client); id != nil && id.Guest {
+				sw.disconnect(client, websocket.ClosePolicyViolation, "kicked from "+m.Channel)
+			}
+		}
+	default:
+		sw.drop(client)
+	}
+}
+
+// handOff routes the frames stored for name to the node name has
+// registered with. Frames that cannot be routed stay in the mailbox.
+func (sw *DefaultSwitch) handOff(name string) {
+	if sw.router == nil {
+		return
+	}
+	for _, f := range sw.mailbox.collect(name) {
+		if !sw.router.route(f) {
+			sw.mailbox.store(f)
+			continue
+		}
+		log.Debug().
+			Str("src", f.Src).
+			Str("dst", f.Dst).
+			Msg("stored message handed off")
+	}
+}
+
+// handleLocal checks the guest restrictions and moderator actions for a
+// frame received from a local client before it is handled.
+func (sw *DefaultSwitch) handleLocal(f *proto.Frame) {
+	src, dst := identityOf(sw.clients[f.Src]), identityOf(sw.clients[f.Dst])
+	msg := sw.mod.guestRestriction(src, f.Dst, dst, f)
+	if msg == "" {
+		msg = sw.moderate(f)
+	}
+	if msg != "" {
+		log.Debug().
+			Str("src", f.Src).
+			Str("dst", f.Dst).
+			Str("reason", msg).
+			Msg("restricted, discarding message")
+		sw.reply(errorReply(f, proto.Error_FORBIDDEN, msg))
+		return
+	}
+	if channelAction(f.Moderation()) {
+		if f.WantAck {
+			sw.send(ackReply(f))
+		}
+		return
+	}
+	sw.handle(f, true)
+}
+
+// disconnect closes the connection of client with code and reason after
+// pending frames have been sent and unregisters it.
+func (sw *DefaultSwitch) disconnect(client Client, code int, reason string) {
+	if d, ok := client.(disconnecter); ok {
+		d.Disconnect(code, reason)
+	}
+	sw.remove(client)
+}
+
+// drop disconnects a client that does not keep up with its frames.
+func (sw *DefaultSwitch) drop(client Client) {
+	log.Warn().Str("user", client.Name()).Msg("send buffer full, dropping client")
+	sw.disconnect(client, websocket.CloseTryAgainLater, "send buffer full")
+}
+
+// refuse rejects a client that is not registered. The client is closed
+// after it has been sent an error frame.
+func (sw *DefaultSwitch) refuse(client Client, code int, reason string) {
+	select {
+	case client.Send() <- &proto.Frame{
+		Dst:     client.Name(),
+		Payload: proto.PayloadWithError(proto.Error_FORBIDDEN, reason, 0),
+	}:
+	default:
+	}
+	if d, ok := client.(disconnecter); ok {
+		d.Disconnect(code, reason)
+	}
+	close(client.Send())
+}
+
+// remove unregisters client if it is the registered client of its name.
+func (sw *DefaultSwitch) remove(client Client) {
+	if c, ok := sw.clients[client.Name()]; ok && c == client {
+		log.Info().Str("user", client.Name()).Msg("unregistering client")
+		delete(sw.clients, client.Name())
+		close(client.Send())
+		if sw.router != nil {
+			sw.router.leave(client.Name())
+		}
+		sw.mod.forget(client.Name())
+		sw.notify(EventOffline, client.Name(), nil)
+	}
+}
+
+func (sw *DefaultSwitch) notify(t EventType, user string, f *proto.Frame) {
+	sw.observe(&Event{Type: t, User: user, Frame: f})
+}
+
+// observe passes e to the observers with the current time.
+func (sw *DefaultSwitch) observe(e *Event) {
+	if len(sw.observers) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	for _, o := range sw.observers {
+		o.Notify(e)
+	}
+}
+
+// reply delivers a frame generated by the switch to a local or remote
+// recipient. Replies are never answered themselves.
+func (sw *DefaultSwitch) reply(r *proto.Frame) {
+	if _, ok := sw.clients[r.Dst]; !ok && sw.router != nil {
+		sw.router.route(r)
+		return
+	}
+	sw.send(r)
+}
+
+// send delivers r if the recipient is registered locally.
+func (sw *DefaultSwitch) send(r *proto.Frame) {
+	client, ok := sw.clients[r.Dst]
+	if !ok {
+		return
+	}
+	select {
+	case client.Send() <- r:
+	default:
+		log.Warn().Str("user", r.Dst).Msg("send buffer full, discarding reply")
+	}
+}
+
+// Shutdown disconnects all clients and stops the run loop. It waits for the
+// run loop to return if it is running.
+func (sw *DefaultSwitch) Shutdown() {
 	close(sw.done)
+	select {
+	case <-sw.started:
+		<-sw.stopped
+	default:
+	}
+}
+
+// errorReply returns an error frame in response to f. The frame is addressed
+// to the sender of f on behalf of the original recipient.
+func errorReply(f *proto.Frame, code proto.Error_Code, msg string) *proto.Frame {
+	return &proto.Frame{
+		Src:     f.Dst,
+		Dst:     f.Src,
+		Payload: proto.PayloadWithError(code, msg, f.Id),
+	}
+}
+
+// ackReply returns an acknowledgement for the delivery of f.
+func ackReply(f *proto.Frame) *proto.Frame {
+	return &proto.Frame{
+		Src:     f.Dst,
+		Dst:     f.Src,
+		Payload: proto.PayloadWithAck(f.Id),
+	}
 }
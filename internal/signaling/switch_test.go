@@ -1,12 +1,20 @@
 package signaling
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/lx7/devnet/proto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
 )
 
 func TestSwitch(t *testing.T) {
@@ -55,7 +63,7 @@ func TestSwitch(t *testing.T) {
 
 			sw.Forward() <- tt.give
 			time.Sleep(10 * time.Millisecond)
-			assert.Equal(t, tt.want, receiver.lastmsg)
+			assert.Equal(t, tt.want, receiver.last())
 
 			receiver.reset()
 		})
@@ -65,19 +73,245 @@ func TestSwitch(t *testing.T) {
 	receiver.AssertExpectations(t)
 }
 
+func TestSwitch_Reply(t *testing.T) {
+	sender := &bufClient{name: "sender", send: make(chan *proto.Frame, 1)}
+	receiver := &bufClient{name: "receiver", send: make(chan *proto.Frame, 1)}
+
+	sw := NewSwitch()
+	go sw.Run()
+	sw.Register(sender)
+	sw.Register(receiver)
+
+	tests := []struct {
+		desc string
+		give *proto.Frame
+		want *proto.Frame
+	}{
+		{
+			desc: "peer offline",
+			give: &proto.Frame{Src: "sender", Dst: "absent", Id: 1},
+			want: &proto.Frame{
+				Src:     "absent",
+				Dst:     "sender",
+				Payload: proto.PayloadWithError(proto.Error_PEER_OFFLINE, "peer offline", 1),
+			},
+		},
+		{
+			desc: "delivery acknowledged",
+			give: &proto.Frame{Src: "sender", Dst: "receiver", Id: 2, WantAck: true},
+			want: &proto.Frame{
+				Src:     "receiver",
+				Dst:     "sender",
+				Payload: proto.PayloadWithAck(2),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			sw.Forward() <- tt.give
+
+			select {
+			case have := <-sender.send:
+				assert.True(t, pb.Equal(tt.want, have), "have: %v", have)
+			case <-time.After(1 * time.Second):
+				t.Error("receive timeout")
+			}
+			select {
+			case <-receiver.send:
+			default:
+			}
+		})
+	}
+	sw.Shutdown()
+}
+
+// newSwitchServer returns a websocket server registering a DefaultClient
+// named after the user query parameter for every connection.
+func newSwitchServer(t *testing.T, sw *DefaultSwitch) (*httptest.Server, string) {
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sw.Register(NewClient(conn, r.URL.Query().Get("user")))
+	}))
+	return server, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// dialSwitch connects as user and consumes the session handshake.
+func dialSwitch(t *testing.T, url, user string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?user="+user, nil)
+	require.NoError(t, err)
+	readFrame(t, conn)
+	return conn
+}
+
+// closeCode reads from conn until it is closed and returns the close code.
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok {
+				return ce.Code
+			}
+			t.Fatalf("connection not closed: %v", err)
+		}
+	}
+}
+
+// assertEcho checks that conn is the registered connection of user.
+func assertEcho(t *testing.T, conn *websocket.Conn, user string) {
+	t.Helper()
+	writeFrame(t, conn, &proto.Frame{Src: user, Dst: user, Id: 1})
+	have := readFrame(t, conn)
+	assert.Equal(t, user, have.Dst)
+	assert.Equal(t, uint64(1), have.Id)
+}
+
+func TestSwitch_Duplicates(t *testing.T) {
+	t.Run("replace", func(t *testing.T) {
+		sw := NewSwitch()
+		go sw.Run()
+		defer sw.Shutdown()
+		server, url := newSwitchServer(t, sw)
+		defer server.Close()
+
+		old := dialSwitch(t, url, "user")
+		defer old.Close()
+		conn := dialSwitch(t, url, "user")
+		defer conn.Close()
+
+		assert.Equal(t, proto.CloseReplaced, closeCode(t, old))
+		assertEcho(t, conn, "user")
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		sw := NewSwitch()
+		sw.SetDuplicatePolicy(DuplicateReject)
+		go sw.Run()
+		defer sw.Shutdown()
+		server, url := newSwitchServer(t, sw)
+		defer server.Close()
+
+		old := dialSwitch(t, url, "user")
+		defer old.Close()
+		conn := dialSwitch(t, url, "user")
+		defer conn.Close()
+
+		have := readFrame(t, conn)
+		assert.Equal(t, "already connected", have.GetError().GetMessage())
+		assert.Equal(t, websocket.ClosePolicyViolation, closeCode(t, conn))
+		assertEcho(t, old, "user")
+	})
+
+	t.Run("reconnect storm", func(t *testing.T) {
+		sw := NewSwitch()
+		go sw.Run()
+		defer sw.Shutdown()
+		server, url := newSwitchServer(t, sw)
+		defer server.Close()
+
+		other := dialSwitch(t, url, "other")
+		defer other.Close()
+		baseline := runtime.NumGoroutine()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, _, err := websocket.DefaultDialer.Dial(url+"?user=user", nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+
+		// the last connection replaces all others
+		time.Sleep(100 * time.Millisecond)
+		conn := dialSwitch(t, url, "user")
+		defer conn.Close()
+		wg.Wait()
+		assertEcho(t, conn, "user")
+
+		// all replaced clients are torn down
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > baseline+10 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), baseline+10)
+	})
+}
+
+func TestSwitch_ShutdownDisconnects(t *testing.T) {
+	sw := NewSwitch()
+	go sw.Run()
+	server, url := newSwitchServer(t, sw)
+	defer server.Close()
+
+	conn := dialSwitch(t, url, "user")
+	defer conn.Close()
+	sw.Shutdown()
+	assert.Equal(t, websocket.CloseGoingAway, closeCode(t, conn))
+
+	late, _, err := websocket.DefaultDialer.Dial(url+"?user=late", nil)
+	require.NoError(t, err)
+	defer late.Close()
+	readFrame(t, late)
+	have := readFrame(t, late)
+	assert.Equal(t, "server shutdown", have.GetError().GetMessage())
+	assert.Equal(t, websocket.CloseGoingAway, closeCode(t, late))
+}
+
+type bufClient struct {
+	name string
+	send chan *proto.Frame
+}
+
+func (c *bufClient) Attach(Switch) {}
+
+func (c *bufClient) Send() chan<- *proto.Frame {
+	return c.send
+}
+
+func (c *bufClient) Name() string {
+	return c.name
+}
+
 type fakeClient struct {
 	mock.Mock
 	name    string
 	send    chan *proto.Frame
+	mu      sync.Mutex
 	lastmsg *proto.Frame
 }
 
 func (c *fakeClient) Attach(Switch) {
 	go func() {
-		c.lastmsg = <-c.send
+		f := <-c.send
+		c.mu.Lock()
+		c.lastmsg = f
+		c.mu.Unlock()
 	}()
 }
 
+func (c *fakeClient) last() *proto.Frame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastmsg
+}
+
 func (c *fakeClient) Send() chan<- *proto.Frame {
 	c.Called()
 	return c.send
@@ -88,5 +322,7 @@ func (c *fakeClient) Name() string {
 }
 
 func (c *fakeClient) reset() {
+	c.mu.Lock()
 	c.lastmsg = nil
+	c.mu.Unlock()
 }
@@ -0,0 +1,89 @@
+package signaling
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/internal/webhook"
+)
+
+// webhookObserver implements an Observer that sends switch events and the
+// calls derived from them to webhooks.
+type webhookObserver struct {
+	hooks    *webhook.Dispatcher
+	calls    *callTracker
+	channels func() []store.Channel
+}
+
+func newWebhookObserver(d *webhook.Dispatcher, channels func() []store.Channel) *webhookObserver {
+	o := &webhookObserver{
+		hooks:    d,
+		channels: channels,
+	}
+	o.calls = newCallTracker(o.answered, o.ended)
+	return o
+}
+
+// Notify implements the Observer interface.
+func (o *webhookObserver) Notify(e *Event) {
+	o.calls.update(e)
+
+	switch e.Type {
+	case EventOnline:
+		o.hooks.Send(&webhook.Event{
+			Type: webhook.UserOnline,
+			Time: e.Time,
+			User: e.User,
+		})
+		for _, c := range o.channels() {
+			if roleOf(e.User, e.Identity, &c) == store.RoleNone {
+				continue
+			}
+			o.hooks.Send(&webhook.Event{
+				Type:    webhook.ChannelJoin,
+				Time:    e.Time,
+				User:    e.User,
+				Channel: c.Name,
+			})
+		}
+	case EventOffline:
+		o.hooks.Send(&webhook.Event{
+			Type: webhook.UserOffline,
+			Time: e.Time,
+			User: e.User,
+		})
+	}
+}
+
+// authFailed reports a failed login attempt.
+func (o *webhookObserver) authFailed(user string, r *http.Request) {
+	o.hooks.Send(&webhook.Event{
+		Type: webhook.AuthFailure,
+		Time: time.Now(),
+		User: user,
+		Src:  r.RemoteAddr,
+	})
+}
+
+func (o *webhookObserver) answered(c *Call) {
+	o.hooks.Send(&webhook.Event{
+		Type: webhook.CallStarted,
+		Time: c.Answer,
+		User: c.Caller,
+		Peer: c.Callee,
+	})
+}
+
+func (o *webhookObserver) ended(c *Call) {
+	if !c.Answered() {
+		return
+	}
+	o.hooks.Send(&webhook.Event{
+		Type:   webhook.CallEnded,
+		Time:   c.End,
+		User:   c.Caller,
+		Peer:   c.Callee,
+		Reason: c.Reason,
+	})
+}
@@ -0,0 +1,74 @@
+package signaling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/store"
+	"github.com/lx7/devnet/internal/webhook"
+	"github.com/lx7/devnet/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookObserver(t *testing.T) {
+	var mu sync.Mutex
+	var have []webhook.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var e webhook.Event
+		require.NoError(t, json.Unmarshal(body, &e))
+		mu.Lock()
+		have = append(have, e)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	d := webhook.New(&webhook.Config{Hooks: []webhook.Hook{{URL: srv.URL}}})
+	o := newWebhookObserver(d, func() []store.Channel {
+		return []store.Channel{
+			{Name: "Lobby", Default: true},
+			{Name: "Private"},
+			{Name: "Team", Members: []string{"user1"}},
+			{Name: "Board", Owner: "user1"},
+		}
+	})
+
+	now := time.Now()
+	o.Notify(&Event{Type: EventOnline, Time: now, User: "user1"})
+	o.Notify(&Event{
+		Type:     EventOnline,
+		Time:     now,
+		User:     "guest",
+		Identity: &auth.Identity{Guest: true, Channel: "Team"},
+	})
+	o.Notify(callEvent(now, "user1", "user2", proto.SDP_OFFER))
+	o.Notify(callEvent(now, "user2", "user1", proto.SDP_ANSWER))
+	o.Notify(&Event{Type: EventOffline, Time: now, User: "user1"})
+	o.authFailed("user3", httptest.NewRequest("GET", "/", nil))
+	d.Close()
+
+	want := []webhook.Event{
+		{Type: webhook.UserOnline, User: "user1"},
+		{Type: webhook.ChannelJoin, User: "user1", Channel: "Lobby"},
+		{Type: webhook.ChannelJoin, User: "user1", Channel: "Team"},
+		{Type: webhook.ChannelJoin, User: "user1", Channel: "Board"},
+		{Type: webhook.UserOnline, User: "guest"},
+		{Type: webhook.ChannelJoin, User: "guest", Channel: "Team"},
+		{Type: webhook.CallStarted, User: "user1", Peer: "user2"},
+		{Type: webhook.CallEnded, User: "user1", Peer: "user2", Reason: EndOffline},
+		{Type: webhook.UserOffline, User: "user1"},
+		{Type: webhook.AuthFailure, User: "user3", Src: "192.0.2.1:1234"},
+	}
+	require.Len(t, have, len(want))
+	for i := range want {
+		have[i].Time = time.Time{}
+		assert.Equal(t, want[i], have[i])
+	}
+}
@@ -0,0 +1,58 @@
+package signaling
+
+import (
+	"io"
+
+	"github.com/rs/zerolog/log"
+)
+
+const writeQueueSize = 256
+
+// writeQueue implements an io.Writer that passes writes to the underlying
+// writer from its own goroutine, so that observers do not block the switch
+// on file I/O. Writes are discarded while the queue is full.
+type writeQueue struct {
+	w     io.Writer
+	name  string
+	queue chan []byte
+	done  chan bool
+}
+
+// newWriteQueue returns a new writeQueue writing to w. name identifies the
+// queue in log messages.
+func newWriteQueue(w io.Writer, name string) *writeQueue {
+	q := &writeQueue{
+		w:     w,
+		name:  name,
+		queue: make(chan []byte, writeQueueSize),
+		done:  make(chan bool),
+	}
+	go q.run()
+	return q
+}
+
+// Write queues a copy of p. It never fails.
+func (q *writeQueue) Write(p []byte) (int, error) {
+	select {
+	case q.queue <- append([]byte(nil), p...):
+	default:
+		log.Warn().Str("queue", q.name).Msg("write queue full, discarding record")
+	}
+	return len(p), nil
+}
+
+// Close writes all queued data and stops writing. Write must not be called
+// after Close.
+func (q *writeQueue) Close() {
+	close(q.queue)
+	<-q.done
+}
+
+func (q *writeQueue) run() {
+	defer close(q.done)
+	for p := range q.queue {
+		if _, err := q.w.Write(p); err != nil {
+			log.Error().Err(err).Str("queue", q.name).Msg("write")
+		}
+	}
+}
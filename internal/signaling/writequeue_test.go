@@ -0,0 +1,38 @@
+package signaling
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	buf     bytes.Buffer
+	release chan bool
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(p)
+}
+
+func TestWriteQueue(t *testing.T) {
+	w := &blockingWriter{release: make(chan bool)}
+	q := newWriteQueue(w, "test")
+
+	// writes do not wait for the underlying writer and are discarded
+	// while the queue is full
+	for i := 0; i < writeQueueSize+2; i++ {
+		n, err := q.Write([]byte("x"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+
+	close(w.release)
+	q.Close()
+	n := w.buf.Len()
+	assert.GreaterOrEqual(t, n, writeQueueSize)
+	assert.Less(t, n, writeQueueSize+2)
+}
@@ -0,0 +1,300 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketUsers    = []byte("users")
+	bucketChannels = []byte("channels")
+	bucketMembers  = []byte("members")
+	bucketEvents   = []byte("events")
+)
+
+// Bolt implements the Store interface on a bbolt database file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the database at path.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{
+			bucketUsers,
+			bucketChannels,
+			bucketMembers,
+			bucketEvents,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// User implements auth.Provider.
+func (s *Bolt) User(name string) (auth.User, bool) {
+	var u auth.User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(bucketUsers), name, &u)
+	})
+	if err != nil && err != ErrNotFound {
+		log.Error().Err(err).Str("user", name).Msg("store: user lookup")
+	}
+	return u, err == nil
+}
+
+// Users returns all users.
+func (s *Bolt) Users() ([]auth.User, error) {
+	var users []auth.User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+			var u auth.User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return err
+			}
+			users = append(users, u)
+			return nil
+		})
+	})
+	return users, err
+}
+
+// PutUser creates or updates u.
+func (s *Bolt) PutUser(u auth.User) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(bucketUsers), u.Name, u)
+	})
+}
+
+// DeleteUser removes the user and all channel memberships.
+func (s *Bolt) DeleteUser(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(bucketMembers).ForEach(func(k, v []byte) error {
+			return tx.Bucket(bucketMembers).Bucket(k).Delete([]byte(name))
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketUsers).Delete([]byte(name))
+	})
+}
+
+// Channel returns the channel with the given name and its members.
+func (s *Bolt) Channel(name string) (Channel, error) {
+	var c Channel
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if err := get(tx.Bucket(bucketChannels), name, &c); err != nil {
+			return err
+		}
+		c.Members = members(tx, name)
+		return nil
+	})
+	return c, err
+}
+
+// Channels returns all channels and their members.
+func (s *Bolt) Channels() ([]Channel, error) {
+	var channels []Channel
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketChannels).ForEach(func(k, v []byte) error {
+			var c Channel
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			c.Members = members(tx, c.Name)
+			channels = append(channels, c)
+			return nil
+		})
+	})
+	return channels, err
+}
+
+// PutChannel creates or updates c. The members of c are ignored, see Join
+// and Leave.
+func (s *Bolt) PutChannel(c Channel) error {
+	c.Members = nil
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.Bucket(bucketMembers).CreateBucketIfNotExists([]byte(c.Name)); err != nil {
+			return err
+		}
+		return put(tx.Bucket(bucketChannels), c.Name, c)
+	})
+}
+
+// DeleteChannel removes the channel and its member list.
+func (s *Bolt) DeleteChannel(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(bucketMembers).DeleteBucket([]byte(name))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return tx.Bucket(bucketChannels).Delete([]byte(name))
+	})
+}
+
+// Join adds user to the members of channel.
+func (s *Bolt) Join(channel, user string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMembers).Bucket([]byte(channel))
+		if b == nil {
+			return ErrNotFound
+		}
+		return b.Put([]byte(user), []byte{})
+	})
+}
+
+// Leave removes user from the members of channel.
+func (s *Bolt) Leave(channel, user string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMembers).Bucket([]byte(channel))
+		if b == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(user))
+	})
+}
+
+// Members returns the names of all members of channel.
+func (s *Bolt) Members(channel string) ([]string, error) {
+	var m []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketMembers).Bucket([]byte(channel)) == nil {
+			return ErrNotFound
+		}
+		m = members(tx, channel)
+		return nil
+	})
+	return m, err
+}
+
+// Record appends e to the event history.
+func (s *Bolt) Record(e Event) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketEvents)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return b.Put(key, data)
+	})
+}
+
+// History returns the most recent events since the given time in
+// chronological order. A limit <= 0 returns all events.
+func (s *Bolt) History(since time.Time, limit int) ([]Event, error) {
+	var events []Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketEvents).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(events) >= limit {
+				break
+			}
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if e.Time.Before(since) {
+				break
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, err
+}
+
+// Prune deletes the events before the given time and all but the max most
+// recent events. A max <= 0 keeps any number of events. Returns the number
+// of deleted events.
+func (s *Bolt) Prune(before time.Time, max int) (int, error) {
+	var n int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketEvents)
+		excess := b.Stats().KeyN - max
+		var keys [][]byte
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if max <= 0 || len(keys) >= excess {
+				var e Event
+				if err := json.Unmarshal(v, &e); err != nil {
+					return err
+				}
+				if !e.Time.Before(before) {
+					break
+				}
+			}
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(keys)
+		return nil
+	})
+	return n, err
+}
+
+// Close closes the database.
+func (s *Bolt) Close() error {
+	return s.db.Close()
+}
+
+// members returns the names of the members of channel in tx.
+func members(tx *bolt.Tx, channel string) []string {
+	b := tx.Bucket(bucketMembers).Bucket([]byte(channel))
+	if b == nil {
+		return nil
+	}
+	var m []string
+	b.ForEach(func(k, v []byte) error {
+		m = append(m, string(k))
+		return nil
+	})
+	return m
+}
+
+func get(b *bolt.Bucket, key string, v interface{}) error {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, v)
+}
+
+func put(b *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
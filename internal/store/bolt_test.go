@@ -0,0 +1,189 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestBolt(t *testing.T) *Bolt {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestBolt_Users(t *testing.T) {
+	s := openTestBolt(t)
+
+	u := auth.User{Name: "user1", Hash: "hash", Key: "key"}
+	require.NoError(t, s.PutUser(u))
+
+	have, ok := s.User("user1")
+	assert.True(t, ok)
+	assert.Equal(t, u, have)
+
+	_, ok = s.User("unknown")
+	assert.False(t, ok)
+
+	users, err := s.Users()
+	require.NoError(t, err)
+	assert.Equal(t, []auth.User{u}, users)
+
+	require.NoError(t, s.DeleteUser("user1"))
+	_, ok = s.User("user1")
+	assert.False(t, ok)
+}
+
+func TestBolt_Channels(t *testing.T) {
+	s := openTestBolt(t)
+
+	c := Channel{Name: "Lobby", Desc: "This is the lobby.", Default: true}
+	require.NoError(t, s.PutChannel(c))
+
+	have, err := s.Channel("Lobby")
+	require.NoError(t, err)
+	assert.Equal(t, c, have)
+
+	_, err = s.Channel("unknown")
+	assert.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, s.Join("Lobby", "user1"))
+	require.NoError(t, s.Join("Lobby", "user2"))
+	require.NoError(t, s.Leave("Lobby", "user1"))
+	assert.Equal(t, ErrNotFound, s.Join("unknown", "user1"))
+
+	members, err := s.Members("Lobby")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, members)
+
+	have, err = s.Channel("Lobby")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, have.Members)
+	require.NoError(t, s.PutChannel(have))
+	members, err = s.Members("Lobby")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, members, "put channel should keep members")
+
+	require.NoError(t, s.PutUser(auth.User{Name: "user2"}))
+	require.NoError(t, s.DeleteUser("user2"))
+	members, err = s.Members("Lobby")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+
+	require.NoError(t, s.DeleteChannel("Lobby"))
+	channels, err := s.Channels()
+	require.NoError(t, err)
+	assert.Empty(t, channels)
+	_, err = s.Members("Lobby")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestBolt_History(t *testing.T) {
+	s := openTestBolt(t)
+
+	t0 := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	var events []Event
+	for i := 0; i < 5; i++ {
+		e := Event{
+			Time: t0.Add(time.Duration(i) * time.Minute),
+			Type: "online",
+			User: "user1",
+		}
+		events = append(events, e)
+		require.NoError(t, s.Record(e))
+	}
+
+	tests := []struct {
+		desc      string
+		giveSince time.Time
+		giveLimit int
+		want      []Event
+	}{
+		{
+			desc: "all events",
+			want: events,
+		},
+		{
+			desc:      "since",
+			giveSince: t0.Add(3 * time.Minute),
+			want:      events[3:],
+		},
+		{
+			desc:      "limit",
+			giveLimit: 2,
+			want:      events[3:],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			have, err := s.History(tt.giveSince, tt.giveLimit)
+			require.NoError(t, err)
+			require.Equal(t, len(tt.want), len(have))
+			for i := range tt.want {
+				assert.True(t, tt.want[i].Time.Equal(have[i].Time))
+				assert.Equal(t, tt.want[i].User, have[i].User)
+			}
+		})
+	}
+}
+
+func TestBolt_Prune(t *testing.T) {
+	t0 := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc       string
+		giveBefore time.Time
+		giveMax    int
+		want       int
+	}{
+		{
+			desc: "keep all",
+			want: 5,
+		},
+		{
+			desc:       "before",
+			giveBefore: t0.Add(3 * time.Minute),
+			want:       2,
+		},
+		{
+			desc:    "max",
+			giveMax: 4,
+			want:    4,
+		},
+		{
+			desc:       "before and max",
+			giveBefore: t0.Add(1 * time.Minute),
+			giveMax:    2,
+			want:       2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := openTestBolt(t)
+			for i := 0; i < 5; i++ {
+				require.NoError(t, s.Record(Event{
+					Time: t0.Add(time.Duration(i) * time.Minute),
+					Type: "online",
+					User: "user1",
+				}))
+			}
+
+			n, err := s.Prune(tt.giveBefore, tt.giveMax)
+			require.NoError(t, err)
+			assert.Equal(t, 5-tt.want, n)
+
+			have, err := s.History(time.Time{}, 0)
+			require.NoError(t, err)
+			require.Len(t, have, tt.want)
+			assert.True(t, t0.Add(4*time.Minute).Equal(have[len(have)-1].Time),
+				"most recent event should be kept")
+		})
+	}
+}
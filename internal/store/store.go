@@ -0,0 +1,161 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// ErrNotFound is returned if a requested item does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store provides persistent storage for users, channels and the event
+// history. It implements auth.Provider.
+type Store interface {
+	auth.Provider
+
+	Users() ([]auth.User, error)
+	PutUser(auth.User) error
+	DeleteUser(name string) error
+
+	Channel(name string) (Channel, error)
+	Channels() ([]Channel, error)
+	PutChannel(Channel) error
+	DeleteChannel(name string) error
+	Join(channel, user string) error
+	Leave(channel, user string) error
+	Members(channel string) ([]string, error)
+
+	Record(Event) error
+	History(since time.Time, limit int) ([]Event, error)
+	Prune(before time.Time, max int) (int, error)
+
+	Close() error
+}
+
+// Channel defines a channel users can join.
+type Channel struct {
+	Name    string `json:"name"`
+	Desc    string `json:"desc"`
+	Hash    string `json:"hash"`
+	Default bool   `json:"default"`
+
+	// Owner, Moderators and Viewers assign roles to users. Members lists
+	// the other users of the channel. All users are members of default
+	// channels. In a store, members are kept apart from the channel and
+	// changed with Join and Leave.
+	Owner      string   `json:"owner,omitempty"`
+	Moderators []string `json:"moderators,omitempty"`
+	Viewers    []string `json:"viewers,omitempty"`
+	Members    []string `json:"members,omitempty"`
+}
+
+// Role is the role of a user in a channel. Higher roles include the
+// permissions of lower roles.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleMember
+	RoleModerator
+	RoleOwner
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleMember:
+		return "member"
+	case RoleModerator:
+		return "moderator"
+	case RoleOwner:
+		return "owner"
+	default:
+		return "none"
+	}
+}
+
+// Role returns the role of user in the channel or RoleNone if the user
+// is not part of it.
+func (c *Channel) Role(user string) Role {
+	switch {
+	case c.Owner == user:
+		return RoleOwner
+	case contains(c.Moderators, user):
+		return RoleModerator
+	case contains(c.Viewers, user):
+		return RoleViewer
+	case c.Default || contains(c.Members, user):
+		return RoleMember
+	default:
+		return RoleNone
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is an entry in the event history.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	User string    `json:"user"`
+	Peer string    `json:"peer,omitempty"`
+}
+
+// Import copies the users and channels defined in conf into s. Items that
+// already exist in s are not modified.
+func Import(s Store, conf *viper.Viper) error {
+	var users []auth.User
+	if err := conf.UnmarshalKey("auth.users", &users); err != nil {
+		return fmt.Errorf("unmarshal user list: %v", err)
+	}
+	var channels []Channel
+	if err := conf.UnmarshalKey("channels", &channels); err != nil {
+		return fmt.Errorf("unmarshal channel list: %v", err)
+	}
+
+	nu := 0
+	for _, u := range users {
+		if _, ok := s.User(u.Name); ok {
+			continue
+		}
+		if err := s.PutUser(u); err != nil {
+			return err
+		}
+		nu++
+	}
+
+	nc := 0
+	for _, c := range channels {
+		if _, err := s.Channel(c.Name); err == nil {
+			continue
+		} else if err != ErrNotFound {
+			return err
+		}
+		if err := s.PutChannel(c); err != nil {
+			return err
+		}
+		for _, m := range c.Members {
+			if err := s.Join(c.Name, m); err != nil {
+				return err
+			}
+		}
+		nc++
+	}
+
+	log.Info().Int("users", nu).Int("channels", nc).Msg("config imported")
+	return nil
+}
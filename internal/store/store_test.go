@@ -0,0 +1,77 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lx7/devnet/internal/auth"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{
+		Out:        os.Stderr,
+		TimeFormat: time.RFC3339,
+	})
+}
+
+func TestStore_Import(t *testing.T) {
+	conf := viper.New()
+	conf.SetConfigFile("../../configs/signald.yaml")
+	require.NoError(t, conf.ReadInConfig())
+
+	s := openTestBolt(t)
+	changed := auth.User{Name: "user1", Hash: "changed"}
+	require.NoError(t, s.PutUser(changed))
+
+	require.NoError(t, Import(s, conf))
+
+	users, err := s.Users()
+	require.NoError(t, err)
+	assert.Len(t, users, 3)
+
+	u, ok := s.User("user1")
+	assert.True(t, ok)
+	assert.Equal(t, changed, u, "existing user must not be modified")
+
+	c, err := s.Channel("Lobby")
+	require.NoError(t, err)
+	assert.True(t, c.Default)
+	assert.Equal(t, "This is the lobby.", c.Desc)
+}
+
+func TestStore_ChannelRole(t *testing.T) {
+	c := Channel{
+		Name:       "Standup",
+		Owner:      "user1",
+		Moderators: []string{"user2"},
+		Viewers:    []string{"user3"},
+		Members:    []string{"user4"},
+	}
+
+	tests := []struct {
+		give string
+		want Role
+	}{
+		{give: "user1", want: RoleOwner},
+		{give: "user2", want: RoleModerator},
+		{give: "user3", want: RoleViewer},
+		{give: "user4", want: RoleMember},
+		{give: "user5", want: RoleNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			assert.Equal(t, tt.want, c.Role(tt.give))
+		})
+	}
+	assert.Equal(t, "moderator", RoleModerator.String())
+
+	c.Default = true
+	assert.Equal(t, RoleMember, c.Role("user5"), "all users are members of default channels")
+}
@@ -23,6 +23,7 @@ func Echo(w http.ResponseWriter, r *http.Request) {
 				websocket.CloseNormalClosure,
 				websocket.CloseGoingAway,
 				websocket.CloseAbnormalClosure,
+				websocket.ClosePolicyViolation,
 			) {
 				log.Fatal().Err(err).Msg("testutil echohandler close error")
 			}
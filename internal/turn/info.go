@@ -0,0 +1,141 @@
+package turn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pion/turn/v2"
+)
+
+// HealthPath is the path of the health endpoint of a turn server.
+const HealthPath = "/health"
+
+// Info describes how clients reach a turn server. It is served by the
+// health endpoint and used by signaling servers to advertise the server.
+type Info struct {
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	Realm string `json:"realm,omitempty"`
+
+	// Transports lists the transports of the TURN urls, "udp" or "tcp".
+	// Defaults to udp.
+	Transports []string `json:"transports,omitempty"`
+}
+
+// URLs returns the STUN url and a TURN url per transport of the server.
+func (i *Info) URLs() []string {
+	hp := net.JoinHostPort(i.Host, strconv.Itoa(i.Port))
+	urls := []string{"stun:" + hp}
+	for _, t := range i.transports() {
+		urls = append(urls, "turn:"+hp+"?transport="+t)
+	}
+	return urls
+}
+
+// Check verifies that the server is reachable on all transports within
+// timeout. UDP is checked with a STUN binding request, TCP by connecting.
+func (i *Info) Check(timeout time.Duration) error {
+	if i.Host == "" || i.Port == 0 {
+		return fmt.Errorf("host or port missing")
+	}
+	hp := net.JoinHostPort(i.Host, strconv.Itoa(i.Port))
+	for _, t := range i.transports() {
+		var err error
+		switch t {
+		case "udp":
+			err = checkUDP(hp, timeout)
+		case "tcp":
+			var conn net.Conn
+			if conn, err = net.DialTimeout("tcp", hp, timeout); err == nil {
+				conn.Close()
+			}
+		default:
+			err = fmt.Errorf("unknown transport")
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", t, hp, err)
+		}
+	}
+	return nil
+}
+
+func (i *Info) transports() []string {
+	if len(i.Transports) == 0 {
+		return []string{"udp"}
+	}
+	return i.Transports
+}
+
+// checkUDP sends a STUN binding request to addr.
+func checkUDP(addr string, timeout time.Duration) error {
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	c, err := turn.NewClient(&turn.ClientConfig{
+		Conn:          conn,
+		LoggerFactory: LoggerFactory{},
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Listen(); err != nil {
+		return err
+	}
+
+	res := make(chan error, 1)
+	go func() {
+		_, err := c.SendBindingRequestTo(raddr)
+		res <- err
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no response within %v", timeout)
+	}
+}
+
+// FetchInfo retrieves the Info served by the health endpoint at url. The
+// host defaults to the host of url.
+func FetchInfo(url string, timeout time.Duration) (*Info, error) {
+	c := http.Client{Timeout: timeout}
+	res, err := c.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("health check: %s", res.Status)
+	}
+
+	var i Info
+	if err := json.NewDecoder(res.Body).Decode(&i); err != nil {
+		return nil, fmt.Errorf("decode info: %v", err)
+	}
+	if i.Host == "" {
+		i.Host = res.Request.URL.Hostname()
+	}
+	return &i, nil
+}
+
+// HealthHandler returns a http.Handler serving info as JSON.
+func HealthHandler(info *Info) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package turn
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfo_URLs(t *testing.T) {
+	i := &Info{Host: "devnet.test", Port: 3478}
+	assert.Equal(t, []string{
+		"stun:devnet.test:3478",
+		"turn:devnet.test:3478?transport=udp",
+	}, i.URLs())
+
+	i.Transports = []string{"udp", "tcp"}
+	assert.Equal(t, []string{
+		"stun:devnet.test:3478",
+		"turn:devnet.test:3478?transport=udp",
+		"turn:devnet.test:3478?transport=tcp",
+	}, i.URLs())
+}
+
+func TestInfo_Check(t *testing.T) {
+	s, err := NewServer(net.IPv4(127, 0, 0, 1), "127.0.0.1:40300", "devnet.test")
+	require.NoError(t, err)
+	defer s.Close()
+
+	i := &Info{Host: "127.0.0.1", Port: 40300}
+	assert.NoError(t, i.Check(time.Second))
+
+	i.Port = 40301
+	assert.Error(t, i.Check(100*time.Millisecond))
+
+	i.Transports = []string{"sctp"}
+	assert.Error(t, i.Check(100*time.Millisecond))
+}
+
+func TestFetchInfo(t *testing.T) {
+	hs := httptest.NewServer(HealthHandler(&Info{
+		Port:  3478,
+		Realm: "devnet.test",
+	}))
+	defer hs.Close()
+
+	i, err := FetchInfo(hs.URL+HealthPath, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, &Info{
+		Host:  "127.0.0.1",
+		Port:  3478,
+		Realm: "devnet.test",
+	}, i)
+
+	_, err = FetchInfo("http://127.0.0.1:1/health", time.Second)
+	assert.Error(t, err)
+}
@@ -7,7 +7,8 @@ import (
 )
 
 // LoggerFactory exists to provide compatibility with the pion LoggerFactory
-// interface that is required for the turn module
+// interface. It routes the logs of the turn module and of the webrtc peers
+// of the client through the global logger.
 type LoggerFactory struct {
 }
 
@@ -3,35 +3,38 @@ package turn
 import (
 	"fmt"
 	"net"
-	"strconv"
 
 	"github.com/lx7/devnet/internal/auth"
+	"github.com/lx7/devnet/internal/listen"
 	"github.com/pion/turn/v2"
 	"github.com/rs/zerolog/log"
 )
 
 type Server struct {
+	stats counters // first for 64 bit alignment
 	*turn.Server
 
 	ip    net.IP
-	port  int
+	addr  string
 	realm string
 }
 
-func NewServer(ip net.IP, port int, realm string) (*Server, error) {
+// NewServer starts a turn server listening on addr and relaying on ip.
+// addr may refer to a socket passed by systemd socket activation.
+func NewServer(ip net.IP, addr string, realm string) (*Server, error) {
 	log.Info().
 		Stringer("ip", ip).
-		Int("port", port).
+		Str("addr", addr).
 		Msg("starting turn server")
 
-	listener, err := net.ListenPacket("udp4", "0.0.0.0:"+strconv.Itoa(port))
+	listener, err := listen.ListenPacket("udp4", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create udp listener: %v", err)
 	}
 
 	s := &Server{
 		ip:    ip,
-		port:  port,
+		addr:  addr,
 		realm: realm,
 	}
 
@@ -41,9 +44,12 @@ func NewServer(ip net.IP, port int, realm string) (*Server, error) {
 		PacketConnConfigs: []turn.PacketConnConfig{
 			{
 				PacketConn: listener,
-				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
-					RelayAddress: ip,
-					Address:      "0.0.0.0",
+				RelayAddressGenerator: &countingGenerator{
+					RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+						RelayAddress: ip,
+						Address:      "0.0.0.0",
+					},
+					stats: &s.stats,
 				},
 			},
 		},
@@ -39,7 +39,7 @@ func TestServer(t *testing.T) {
 	hook := &testutil.LogHook{}
 	log.Logger = log.Hook(hook)
 
-	s, err := NewServer(net.IPv4(127, 0, 0, 1), 3478, "devnet.test")
+	s, err := NewServer(net.IPv4(127, 0, 0, 1), "0.0.0.0:3478", "devnet.test")
 	assert.NoError(t, err)
 
 	t.Run("stun binding request", func(t *testing.T) {
@@ -111,6 +111,9 @@ func TestServer(t *testing.T) {
 		require.NoError(t, err)
 
 		log.Debug().Msgf("laddr: %s", conn.LocalAddr().String())
+		stats := s.Stats()
+		assert.Equal(t, int64(1), stats.Allocations)
+		assert.Equal(t, uint64(1), stats.AllocationsTotal)
 
 		c.Close()
 		assert.NoError(t, listener.Close())
@@ -122,4 +125,5 @@ func TestServer(t *testing.T) {
 	})
 
 	assert.NoError(t, s.Close())
+	assert.Zero(t, s.Stats().Allocations, "allocations released on close")
 }
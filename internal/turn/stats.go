@@ -0,0 +1,63 @@
+package turn
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/turn/v2"
+)
+
+// Stats holds the counters of a turn server.
+type Stats struct {
+	// Allocations is the number of relay allocations in use.
+	Allocations int64 `json:"allocations"`
+
+	// AllocationsTotal is the number of relay allocations since start.
+	AllocationsTotal uint64 `json:"allocations_total"`
+}
+
+// counters are updated atomically and must be 64 bit aligned.
+type counters struct {
+	allocations      int64
+	allocationsTotal uint64
+}
+
+// Stats returns the current counters of s.
+func (s *Server) Stats() Stats {
+	return Stats{
+		Allocations:      atomic.LoadInt64(&s.stats.allocations),
+		AllocationsTotal: atomic.LoadUint64(&s.stats.allocationsTotal),
+	}
+}
+
+// countingGenerator counts the relay connections allocated by the embedded
+// generator until they are closed.
+type countingGenerator struct {
+	turn.RelayAddressGenerator
+	stats *counters
+}
+
+func (g *countingGenerator) AllocatePacketConn(network string, port int) (net.PacketConn, net.Addr, error) {
+	conn, addr, err := g.RelayAddressGenerator.AllocatePacketConn(network, port)
+	if err != nil {
+		return nil, nil, err
+	}
+	atomic.AddInt64(&g.stats.allocations, 1)
+	atomic.AddUint64(&g.stats.allocationsTotal, 1)
+	return &countedConn{PacketConn: conn, stats: g.stats}, addr, nil
+}
+
+// countedConn releases its allocation count on the first Close.
+type countedConn struct {
+	net.PacketConn
+	stats *counters
+	once  sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.stats.allocations, -1)
+	})
+	return c.PacketConn.Close()
+}
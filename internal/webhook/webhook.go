@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Event types.
+const (
+	UserOnline  = "user.online"
+	UserOffline = "user.offline"
+	CallStarted = "call.started"
+	CallEnded   = "call.ended"
+	ChannelJoin = "channel.join"
+	AuthFailure = "auth.failure"
+)
+
+// Headers set on every request.
+const (
+	EventHeader     = "X-Devnet-Event"
+	SignatureHeader = "X-Devnet-Signature"
+)
+
+// Defaults for unset Config values.
+const (
+	DefaultQueue   = 64
+	DefaultBackoff = time.Second
+	DefaultTimeout = 10 * time.Second
+)
+
+// Config defines the webhook receivers and the delivery behaviour.
+type Config struct {
+	Hooks []Hook
+
+	// Queue is the maximum number of pending events per hook. Events are
+	// discarded if the queue is full.
+	Queue int
+
+	// Retries is the number of delivery retries. The delay starts at Backoff
+	// and doubles with every retry.
+	Retries int
+	Backoff time.Duration
+
+	// Timeout limits the duration of a single request.
+	Timeout time.Duration
+}
+
+// Hook defines a receiver URL.
+type Hook struct {
+	URL string
+
+	// Secret is used to sign the request body. See Sign.
+	Secret string
+
+	// Events lists the event types sent to the hook. All events are sent if
+	// the list is empty.
+	Events []string
+}
+
+// Event is the JSON body posted to the hooks.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user,omitempty"`
+	Peer    string    `json:"peer,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Src     string    `json:"src,omitempty"`
+}
+
+// Dispatcher posts events to the configured hooks.
+type Dispatcher struct {
+	hooks []*hook
+	quit  chan bool
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type hook struct {
+	Hook
+	events  map[string]bool
+	queue   chan *Event
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// New returns a new Dispatcher instance and starts delivery.
+func New(conf *Config) *Dispatcher {
+	c := *conf
+	if c.Queue <= 0 {
+		c.Queue = DefaultQueue
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	d := &Dispatcher{
+		quit: make(chan bool),
+	}
+	for _, h := range c.Hooks {
+		hk := &hook{
+			Hook:    h,
+			events:  make(map[string]bool),
+			queue:   make(chan *Event, c.Queue),
+			client:  &http.Client{Timeout: c.Timeout},
+			retries: c.Retries,
+			backoff: c.Backoff,
+		}
+		for _, t := range h.Events {
+			hk.events[t] = true
+		}
+		d.hooks = append(d.hooks, hk)
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.run(hk)
+		}()
+	}
+	return d
+}
+
+// Send queues e for delivery to all hooks subscribed to the event type.
+// It does not block. Events sent after Close are discarded.
+func (d *Dispatcher) Send(e *Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+
+	for _, h := range d.hooks {
+		if len(h.events) > 0 && !h.events[e.Type] {
+			continue
+		}
+		select {
+		case h.queue <- e:
+		default:
+			log.Warn().
+				Str("url", h.URL).
+				Str("type", e.Type).
+				Msg("webhook queue full, discarding event")
+		}
+	}
+}
+
+// Close stops delivery. Pending events are sent without retries and
+// retries in progress are abandoned.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.quit)
+	for _, h := range d.hooks {
+		close(h.queue)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) run(h *hook) {
+	for e := range h.queue {
+		body, err := json.Marshal(e)
+		if err != nil {
+			log.Error().Err(err).Msg("marshal webhook event")
+			continue
+		}
+
+		delay := h.backoff
+	retry:
+		for try := 0; ; try++ {
+			err = h.post(e.Type, body)
+			if err == nil || try >= h.retries {
+				break
+			}
+			log.Debug().Str("url", h.URL).Err(err).Msg("webhook failed, retrying")
+
+			select {
+			case <-time.After(delay):
+			case <-d.quit:
+				break retry
+			}
+			delay *= 2
+		}
+		if err != nil {
+			log.Warn().
+				Str("url", h.URL).
+				Str("type", e.Type).
+				Err(err).
+				Msg("webhook failed")
+		}
+	}
+}
+
+// post sends a single request. Client errors are not retried.
+func (h *hook) post(typ string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, typ)
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode < 300:
+		return nil
+	case res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests:
+		log.Warn().
+			Str("url", h.URL).
+			Int("status", res.StatusCode).
+			Msg("webhook rejected")
+		return nil
+	default:
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+}
+
+// Sign returns the value of the signature header for body, i.e. the hex
+// encoded HMAC-SHA256 of the body prefixed with "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
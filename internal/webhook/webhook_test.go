@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{
+		Out:        os.Stderr,
+		TimeFormat: time.RFC3339,
+	})
+}
+
+type receiver struct {
+	sync.Mutex
+	fail   int
+	status int
+	reqs   []*http.Request
+	bodies [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.Lock()
+	defer r.Unlock()
+	r.reqs = append(r.reqs, req)
+	r.bodies = append(r.bodies, body)
+	if r.fail > 0 {
+		r.fail--
+		w.WriteHeader(r.status)
+	}
+}
+
+func (r *receiver) count() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.reqs)
+}
+
+func TestWebhook_Send(t *testing.T) {
+	recv := &receiver{}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := New(&Config{
+		Hooks: []Hook{
+			{URL: srv.URL, Secret: "secret", Events: []string{UserOnline}},
+		},
+		Queue:   4,
+		Timeout: time.Second,
+	})
+
+	e := &Event{Type: UserOnline, Time: time.Now().UTC(), User: "user1"}
+	d.Send(e)
+	d.Send(&Event{Type: UserOffline, User: "user1"})
+	d.Close()
+
+	require.Equal(t, 1, recv.count(), "only subscribed events should be sent")
+	req, body := recv.reqs[0], recv.bodies[0]
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, UserOnline, req.Header.Get(EventHeader))
+	assert.Equal(t, Sign("secret", body), req.Header.Get(SignatureHeader))
+
+	var have Event
+	require.NoError(t, json.Unmarshal(body, &have))
+	assert.Equal(t, e.User, have.User)
+	assert.True(t, e.Time.Equal(have.Time))
+}
+
+func TestWebhook_Retry(t *testing.T) {
+	tests := []struct {
+		desc       string
+		giveFail   int
+		giveStatus int
+		want       int
+	}{
+		{
+			desc:       "server error",
+			giveFail:   2,
+			giveStatus: http.StatusServiceUnavailable,
+			want:       3,
+		},
+		{
+			desc:       "retries exhausted",
+			giveFail:   5,
+			giveStatus: http.StatusInternalServerError,
+			want:       3,
+		},
+		{
+			desc:       "client error",
+			giveFail:   1,
+			giveStatus: http.StatusBadRequest,
+			want:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			recv := &receiver{fail: tt.giveFail, status: tt.giveStatus}
+			srv := httptest.NewServer(recv)
+			defer srv.Close()
+
+			d := New(&Config{
+				Hooks:   []Hook{{URL: srv.URL}},
+				Queue:   1,
+				Retries: 2,
+				Backoff: time.Millisecond,
+				Timeout: time.Second,
+			})
+			d.Send(&Event{Type: UserOnline})
+
+			assert.Eventually(t, func() bool {
+				return recv.count() == tt.want
+			}, time.Second, time.Millisecond)
+			d.Close()
+			assert.Equal(t, tt.want, recv.count())
+		})
+	}
+}
+
+func TestWebhook_QueueFull(t *testing.T) {
+	block := make(chan bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+
+	d := New(&Config{
+		Hooks:   []Hook{{URL: srv.URL}},
+		Queue:   1,
+		Timeout: time.Second,
+	})
+
+	for i := 0; i < 5; i++ {
+		d.Send(&Event{Type: UserOnline})
+	}
+	assert.LessOrEqual(t, len(d.hooks[0].queue), 1)
+	close(block)
+	d.Close()
+}
+
+func TestWebhook_Close(t *testing.T) {
+	recv := &receiver{fail: 5, status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := New(&Config{
+		Hooks:   []Hook{{URL: srv.URL}},
+		Queue:   4,
+		Retries: 5,
+		Backoff: time.Hour,
+		Timeout: time.Second,
+	})
+	d.Send(&Event{Type: UserOnline})
+	d.Send(&Event{Type: UserOffline})
+	assert.Eventually(t, func() bool {
+		return recv.count() == 1
+	}, time.Second, time.Millisecond)
+
+	done := make(chan bool)
+	go func() {
+		d.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close should not wait for retries")
+	}
+	assert.Equal(t, 2, recv.count(), "pending events should be sent once")
+
+	assert.NotPanics(t, func() { d.Send(&Event{Type: UserOnline}) })
+	d.Close()
+}
+
+func TestWebhook_Sign(t *testing.T) {
+	have := Sign("It's a Secret to Everybody", []byte("Hello, World!"))
+	want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	assert.Equal(t, want, have)
+}
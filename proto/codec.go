@@ -0,0 +1,65 @@
+package proto
+
+import (
+	"google.golang.org/protobuf/encoding/protojson"
+	pb "google.golang.org/protobuf/proto"
+)
+
+// Websocket subprotocols of the signaling service.
+const (
+	// SubprotocolProto transfers frames as binary protobuf messages. It is
+	// used if no subprotocol was negotiated.
+	SubprotocolProto = "devnet.proto.v1"
+
+	// SubprotocolJSON transfers frames as protojson text messages.
+	SubprotocolJSON = "devnet.json.v1"
+)
+
+// Subprotocols lists the supported subprotocols in order of preference.
+var Subprotocols = []string{SubprotocolProto, SubprotocolJSON}
+
+// Codec encodes frames for a websocket subprotocol.
+type Codec interface {
+	Marshal(*Frame) ([]byte, error)
+	Unmarshal([]byte, *Frame) error
+
+	// Text reports whether frames are sent as text messages.
+	Text() bool
+}
+
+// CodecFor returns the codec of the given subprotocol. The binary protobuf
+// codec is returned for unknown or empty subprotocols.
+func CodecFor(subprotocol string) Codec {
+	if subprotocol == SubprotocolJSON {
+		return jsonCodec{}
+	}
+	return protoCodec{}
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(f *Frame) ([]byte, error) {
+	return pb.Marshal(f)
+}
+
+func (protoCodec) Unmarshal(data []byte, f *Frame) error {
+	return pb.Unmarshal(data, f)
+}
+
+func (protoCodec) Text() bool {
+	return false
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(f *Frame) ([]byte, error) {
+	return protojson.Marshal(f)
+}
+
+func (jsonCodec) Unmarshal(data []byte, f *Frame) error {
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, f)
+}
+
+func (jsonCodec) Text() bool {
+	return true
+}
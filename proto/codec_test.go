@@ -0,0 +1,78 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestCodec(t *testing.T) {
+	give := &Frame{
+		Src: "user1",
+		Dst: "user2",
+		Id:  3,
+		Payload: &Frame_Sdp{Sdp: &SDP{
+			Type: SDP_OFFER,
+			Desc: "v=0",
+		}},
+	}
+
+	tests := []struct {
+		desc     string
+		give     string
+		wantText bool
+		wantJSON string
+	}{
+		{
+			desc:     "proto",
+			give:     SubprotocolProto,
+			wantText: false,
+		},
+		{
+			desc:     "default",
+			give:     "",
+			wantText: false,
+		},
+		{
+			desc:     "json",
+			give:     SubprotocolJSON,
+			wantText: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c := CodecFor(tt.give)
+			assert.Equal(t, tt.wantText, c.Text())
+
+			data, err := c.Marshal(give)
+			require.NoError(t, err)
+			have := &Frame{}
+			require.NoError(t, c.Unmarshal(data, have))
+			assert.True(t, pb.Equal(give, have), "have: %v", have)
+		})
+	}
+}
+
+func TestCodec_JSON(t *testing.T) {
+	c := CodecFor(SubprotocolJSON)
+	have := &Frame{}
+	err := c.Unmarshal([]byte(`{
+		"src": "user1",
+		"dst": "user2",
+		"wantAck": true,
+		"sdp": {"type": "ANSWER", "desc": "v=0"},
+		"unknown": 1
+	}`), have)
+	require.NoError(t, err)
+
+	want := &Frame{
+		Src:     "user1",
+		Dst:     "user2",
+		WantAck: true,
+		Payload: &Frame_Sdp{Sdp: &SDP{Type: SDP_ANSWER, Desc: "v=0"}},
+	}
+	assert.True(t, pb.Equal(want, have), "have: %v", have)
+}
@@ -0,0 +1,15 @@
+package proto
+
+func PayloadWithModeration(a Control_Moderation_Action, channel string) *Frame_Control {
+	return &Frame_Control{&Control{
+		Moderation: &Control_Moderation{
+			Action:  a,
+			Channel: channel,
+		},
+	}}
+}
+
+// Moderation returns the moderator action carried by f or nil.
+func (f *Frame) Moderation() *Control_Moderation {
+	return f.GetControl().GetModeration()
+}
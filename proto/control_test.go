@@ -0,0 +1,23 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestControl_Moderation(t *testing.T) {
+	f := &Frame{Payload: PayloadWithModeration(Control_Moderation_KICK, "Lobby")}
+	want := &Control_Moderation{
+		Action:  Control_Moderation_KICK,
+		Channel: "Lobby",
+	}
+	assert.True(t, pb.Equal(want, f.Moderation()))
+
+	f = &Frame{Payload: &Frame_Control{&Control{Key: &Control_Key{Code: 1}}}}
+	assert.Nil(t, f.Moderation())
+
+	f = &Frame{Payload: PayloadWithAck(1)}
+	assert.Nil(t, f.Moderation())
+}
@@ -0,0 +1,19 @@
+package proto
+
+import "fmt"
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Code, e.Message)
+}
+
+func PayloadWithError(c Error_Code, msg string, ref uint64) *Frame_Error {
+	return &Frame_Error{&Error{
+		Code:    c,
+		Message: msg,
+		Ref:     ref,
+	}}
+}
+
+func PayloadWithAck(ref uint64) *Frame_Ack {
+	return &Frame_Ack{&Ack{Ref: ref}}
+}
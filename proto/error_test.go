@@ -0,0 +1,44 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestError_Error(t *testing.T) {
+	var err error = &Error{Code: Error_PEER_OFFLINE, Message: "peer offline"}
+	assert.EqualError(t, err, "PEER_OFFLINE: peer offline")
+}
+
+func TestError_Payload(t *testing.T) {
+	tests := []struct {
+		desc string
+		give isFrame_Payload
+		want isFrame_Payload
+	}{
+		{
+			desc: "error payload",
+			give: PayloadWithError(Error_RATE_LIMITED, "rate limited", 5),
+			want: &Frame_Error{&Error{
+				Code:    Error_RATE_LIMITED,
+				Message: "rate limited",
+				Ref:     5,
+			}},
+		},
+		{
+			desc: "ack payload",
+			give: PayloadWithAck(7),
+			want: &Frame_Ack{&Ack{Ref: 7}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			give := &Frame{Payload: tt.give}
+			want := &Frame{Payload: tt.want}
+			assert.True(t, pb.Equal(want, give))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package proto
+
+// ProtocolVersion is the version of the signaling protocol implemented by
+// this package. It is incremented on changes that older implementations
+// cannot handle.
+const ProtocolVersion = 1
+
+// CloseIncompatible is the websocket close code sent to a client that
+// speaks an unsupported protocol version. Clients must not reconnect
+// automatically.
+const CloseIncompatible = 4001
+
+// Features offered by the signaling service.
+const (
+	FeatureAck        = "payload:ack"
+	FeatureResume     = "payload:resume"
+	FeatureModeration = "payload:moderation"
+	FeatureNotice     = "payload:notice"
+)
+
+// Features negotiated between peers.
+const (
+	FeatureCodecOpus = "codec:opus"
+	FeatureCodecH264 = "codec:h264"
+	FeatureCodecVP8  = "codec:vp8"
+	FeatureRCon      = "dc:rcon"
+)
+
+func PayloadWithHello(version, device string, features []string) *Frame_Hello {
+	return &Frame_Hello{&Hello{
+		Protocol: ProtocolVersion,
+		Version:  version,
+		Device:   device,
+		Features: features,
+	}}
+}
+
+// Welcome returns the answer to h by an implementation of version that
+// supports features. The answer carries the features supported by both
+// sides.
+func (h *Hello) Welcome(version string, features []string) *Frame_Welcome {
+	return &Frame_Welcome{&Welcome{
+		Protocol: ProtocolVersion,
+		Version:  version,
+		Features: Negotiate(h.GetFeatures(), features),
+	}}
+}
+
+// Negotiate returns the features of a that are also contained in b.
+func Negotiate(a, b []string) []string {
+	var common []string
+	for _, f := range a {
+		for _, g := range b {
+			if f == g {
+				common = append(common, f)
+				break
+			}
+		}
+	}
+	return common
+}
+
+// Supports reports whether feature was negotiated.
+func (w *Welcome) Supports(feature string) bool {
+	for _, f := range w.GetFeatures() {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
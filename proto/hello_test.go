@@ -0,0 +1,51 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHello_Welcome(t *testing.T) {
+	h := PayloadWithHello("1.0", "device", []string{
+		FeatureCodecH264,
+		FeatureCodecVP8,
+		FeatureRCon,
+	}).Hello
+	assert.Equal(t, uint32(ProtocolVersion), h.Protocol)
+
+	tests := []struct {
+		desc string
+		give []string
+		want []string
+	}{
+		{
+			desc: "common features",
+			give: []string{FeatureRCon, FeatureCodecH264, FeatureCodecOpus},
+			want: []string{FeatureCodecH264, FeatureRCon},
+		},
+		{
+			desc: "no common features",
+			give: []string{FeatureCodecOpus},
+			want: nil,
+		},
+		{
+			desc: "no features",
+			give: nil,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			w := h.Welcome("2.0", tt.give).Welcome
+			assert.Equal(t, uint32(ProtocolVersion), w.Protocol)
+			assert.Equal(t, "2.0", w.Version)
+			assert.Equal(t, tt.want, w.Features)
+			for _, f := range tt.want {
+				assert.True(t, w.Supports(f))
+			}
+			assert.False(t, w.Supports(FeatureCodecOpus))
+		})
+	}
+}
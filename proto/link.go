@@ -0,0 +1,13 @@
+package proto
+
+import (
+	pb "google.golang.org/protobuf/proto"
+)
+
+func (l *Link) Marshal() ([]byte, error) {
+	return pb.Marshal(l)
+}
+
+func (l *Link) Unmarshal(in []byte) error {
+	return pb.Unmarshal(in, l)
+}
@@ -0,0 +1,14 @@
+package proto
+
+func PayloadWithChat(text string) *Frame_Chat {
+	return &Frame_Chat{&Chat{Text: text}}
+}
+
+func PayloadWithFileOffer(id, name string, size uint64, mime string) *Frame_FileOffer {
+	return &Frame_FileOffer{&FileOffer{
+		Id:   id,
+		Name: name,
+		Size: size,
+		Mime: mime,
+	}}
+}
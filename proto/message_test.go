@@ -0,0 +1,40 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestMessage_Payload(t *testing.T) {
+	tests := []struct {
+		desc string
+		give isFrame_Payload
+		want isFrame_Payload
+	}{
+		{
+			desc: "chat payload",
+			give: PayloadWithChat("hello"),
+			want: &Frame_Chat{&Chat{Text: "hello"}},
+		},
+		{
+			desc: "file offer payload",
+			give: PayloadWithFileOffer("f1", "notes.txt", 42, "text/plain"),
+			want: &Frame_FileOffer{&FileOffer{
+				Id:   "f1",
+				Name: "notes.txt",
+				Size: 42,
+				Mime: "text/plain",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			give := &Frame{Payload: tt.give}
+			want := &Frame{Payload: tt.want}
+			assert.True(t, pb.Equal(want, give))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package proto
+
+import "time"
+
+// PayloadWithNotice returns a notice payload. A zero expires denotes a
+// notice that does not expire.
+func PayloadWithNotice(s Notice_Severity, text string, expires time.Time) *Frame_Notice {
+	n := &Notice{Severity: s, Text: text}
+	if !expires.IsZero() {
+		n.Expires = expires.Unix()
+	}
+	return &Frame_Notice{n}
+}
+
+// ExpiresAt returns the expiry of the notice or the zero time if it does
+// not expire.
+func (n *Notice) ExpiresAt() time.Time {
+	if n.GetExpires() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(n.GetExpires(), 0)
+}
+
+// Expired reports whether the notice is obsolete at t.
+func (n *Notice) Expired(t time.Time) bool {
+	return n.GetExpires() != 0 && !t.Before(n.ExpiresAt())
+}
@@ -0,0 +1,54 @@
+package proto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "google.golang.org/protobuf/proto"
+)
+
+func TestNotice_Payload(t *testing.T) {
+	expires := time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		desc string
+		give isFrame_Payload
+		want isFrame_Payload
+	}{
+		{
+			desc: "expiring notice",
+			give: PayloadWithNotice(Notice_WARNING, "restart at 12:00", expires),
+			want: &Frame_Notice{&Notice{
+				Severity: Notice_WARNING,
+				Text:     "restart at 12:00",
+				Expires:  expires.Unix(),
+			}},
+		},
+		{
+			desc: "permanent notice",
+			give: PayloadWithNotice(Notice_INFO, "welcome", time.Time{}),
+			want: &Frame_Notice{&Notice{Text: "welcome"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			give := &Frame{Payload: tt.give}
+			want := &Frame{Payload: tt.want}
+			assert.True(t, pb.Equal(want, give))
+		})
+	}
+}
+
+func TestNotice_Expired(t *testing.T) {
+	now := time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	n := &Notice{Expires: now.Unix()}
+	assert.True(t, n.ExpiresAt().Equal(now))
+	assert.False(t, n.Expired(now.Add(-time.Second)))
+	assert.True(t, n.Expired(now))
+
+	n = &Notice{}
+	assert.True(t, n.ExpiresAt().IsZero())
+	assert.False(t, n.Expired(now))
+}
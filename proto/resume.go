@@ -0,0 +1,15 @@
+package proto
+
+const (
+	// ResumeTokenHeader carries the token of a signaling session to resume.
+	ResumeTokenHeader = "X-Devnet-Resume-Token"
+
+	// ResumeSeqHeader carries the sequence number of the last frame received
+	// in the session to resume.
+	ResumeSeqHeader = "X-Devnet-Resume-Seq"
+)
+
+// CloseReplaced is the websocket close code sent to a connection that was
+// replaced by a newer connection of the same user. Clients must not
+// reconnect automatically.
+const CloseReplaced = 4000
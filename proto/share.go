@@ -0,0 +1,5 @@
+package proto
+
+func PayloadWithShare(active bool) *Frame_Share {
+	return &Frame_Share{&Share{Active: active}}
+}
@@ -0,0 +1,18 @@
+package proto
+
+// Event stream transport for clients that cannot establish a websocket
+// connection. Frames to the client are sent as server-sent events in the
+// JSON format of SubprotocolJSON, frames from the client are posted to the
+// same path. Deleting the stream closes it.
+const (
+	// StreamPath is appended to the websocket path of the signaling service.
+	StreamPath = "/events"
+
+	// StreamHeader carries the id of an event stream. It is set on the
+	// stream response and identifies the stream in posts and deletes.
+	StreamHeader = "X-Devnet-Stream"
+
+	// StreamCloseEvent is the event type of the close message. Its data is
+	// the close code and reason separated by a space.
+	StreamCloseEvent = "close"
+)